@@ -0,0 +1,151 @@
+//go:build !appengine
+// +build !appengine
+
+// Command lingrimage renders the bot's templates without Lingr.
+//
+//	lingrimage render -t komei -o out.png "text"
+//	echo text | lingrimage render -t komei > out.png
+//	lingrimage list
+//	lingrimage fonts
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-lingrimagebot"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: lingrimage <command> [options]
+
+commands:
+  render -t name [-o file] [text...]  render text (or stdin) with a template
+  list                                list the templates
+  fonts [-fonts dir]                  list the fonts which templates can use
+`)
+	os.Exit(2)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "lingrimage:", err)
+	os.Exit(1)
+}
+
+func loadRegistry(fs *flag.FlagSet, args []string) (*lingrimagebot.Registry, error) {
+	dir := fs.String("dir", ".", "directory of templates, fonts and images")
+	manifest := fs.String("templates", "templates.json", "template manifest, relative to -dir")
+	fs.Parse(args)
+	if err := os.Chdir(*dir); err != nil {
+		return nil, err
+	}
+	return lingrimagebot.LoadRegistry(*manifest)
+}
+
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	name := fs.String("t", "image", "template name or alias")
+	output := fs.String("o", "-", "output file, - for stdout")
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	registry, err := loadRegistry(fs, args)
+	if err != nil {
+		return err
+	}
+	t := registry.Lookup(*name)
+	if t == nil {
+		return fmt.Errorf("unknown template: %s", *name)
+	}
+
+	var text string
+	if fs.NArg() == 0 || fs.NArg() == 1 && fs.Arg(0) == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimSuffix(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+	} else {
+		text = strings.Join(fs.Args(), " ")
+	}
+	rgba, err := t.Render(text)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		// -o is relative to where we were started, not to -dir.
+		filename := *output
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(wd, filename)
+		}
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return png.Encode(w, rgba)
+}
+
+func list(args []string) error {
+	registry, err := loadRegistry(flag.NewFlagSet("list", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	for _, t := range registry.Templates() {
+		if len(t.Aliases) > 0 {
+			fmt.Printf("%s (%s)\n", t.Name, strings.Join(t.Aliases, ", "))
+		} else {
+			fmt.Println(t.Name)
+		}
+	}
+	return nil
+}
+
+func fonts(args []string) error {
+	fs := flag.NewFlagSet("fonts", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory of templates, fonts and images")
+	fontDir := fs.String("fonts", "font", "directory of fonts, relative to -dir")
+	fs.Parse(args)
+	if err := os.Chdir(*dir); err != nil {
+		return err
+	}
+	faces, err := lingrimagebot.ListFonts(*fontDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range faces {
+		fmt.Printf("%s\t%s (%s, weight %d)\n", f.Path, f.Info.FullName, f.Info.Style, f.Info.Weight)
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = render(os.Args[2:])
+	case "list":
+		err = list(os.Args[2:])
+	case "fonts":
+		err = fonts(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
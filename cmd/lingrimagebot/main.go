@@ -0,0 +1,45 @@
+//go:build !appengine
+// +build !appengine
+
+// Command lingrimagebot runs the bot as a standalone HTTP server.
+//
+// Templates, fonts, images and index.html are read relative to -dir, the
+// same layout as the App Engine application.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"go-lingrimagebot"
+)
+
+func env(name, value string) string {
+	if s := os.Getenv(name); s != "" {
+		return s
+	}
+	return value
+}
+
+func main() {
+	addr := flag.String("addr", env("LINGRIMAGEBOT_ADDR", ":"+env("PORT", "8080")), "address to listen on ($LINGRIMAGEBOT_ADDR)")
+	dir := flag.String("dir", env("LINGRIMAGEBOT_DIR", "."), "directory of templates, fonts and images ($LINGRIMAGEBOT_DIR)")
+	config := flag.String("config", env("LINGRIMAGEBOT_CONFIG", "config.json"), "configuration file, relative to -dir ($LINGRIMAGEBOT_CONFIG)")
+	flag.Parse()
+
+	if err := os.Chdir(*dir); err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := lingrimagebot.LoadConfig(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bot, err := lingrimagebot.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, bot.Handler()))
+}
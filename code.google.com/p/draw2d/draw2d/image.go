@@ -30,7 +30,11 @@ type ImageGraphicContext struct {
 	fillRasterizer   *raster.Rasterizer
 	strokeRasterizer *raster.Rasterizer
 	glyphBuf         *truetype.GlyphBuf
+	segs             []truetype.Segment
 	DPI              int
+	// synthetic is the style the current font does not have, and which
+	// is made by emboldening or slanting its glyphs.
+	synthetic FontStyle
 }
 
 /**
@@ -58,7 +62,9 @@ func NewGraphicContextWithPainter(img draw.Image, painter Painter) *ImageGraphic
 		raster.NewRasterizer(width, height),
 		raster.NewRasterizer(width, height),
 		truetype.NewGlyphBuf(),
+		nil,
 		dpi,
+		FontStyleNormal,
 	}
 	return gc
 }
@@ -103,6 +109,16 @@ func (gc *ImageGraphicContext) StrokeStringAt(text string, x, y float64) (cursor
 
 func (gc *ImageGraphicContext) loadCurrentFont() (*truetype.Font, error) {
 	font := GetFont(gc.Current.FontData)
+	gc.synthetic = FontStyleNormal
+	if font == nil && gc.Current.FontData.Style != FontStyleNormal {
+		// Without a bold or italic font, make the glyphs of the normal one
+		// bolder or slanted.
+		normal := gc.Current.FontData
+		normal.Style = FontStyleNormal
+		if font = GetFont(normal); font != nil {
+			gc.synthetic = gc.Current.FontData.Style
+		}
+	}
 	if font == nil {
 		font = GetFont(defaultFontData)
 	}
@@ -126,55 +142,42 @@ func pointToF64Point(p truetype.Point) (x, y float64) {
 	return fUnitsToFloat64(p.X), -fUnitsToFloat64(p.Y)
 }
 
-// drawContour draws the given closed contour at the given sub-pixel offset.
-func (gc *ImageGraphicContext) drawContour(ps []truetype.Point, dx, dy float64) {
-	if len(ps) == 0 {
-		return
+// loadGlyph loads the glyph into gc.glyphBuf, in the synthetic style if
+// any.
+func (gc *ImageGraphicContext) loadGlyph(glyph truetype.Index) error {
+	if err := gc.glyphBuf.Load(gc.Current.font, gc.Current.scale, glyph, truetype.NoHinting); err != nil {
+		return err
 	}
-	startX, startY := pointToF64Point(ps[0])
-	gc.MoveTo(startX+dx, startY+dy)
-	q0X, q0Y, on0 := startX, startY, true
-	for _, p := range ps[1:] {
-		qX, qY := pointToF64Point(p)
-		on := p.Flags&0x01 != 0
-		if on {
-			if on0 {
-				gc.LineTo(qX+dx, qY+dy)
-			} else {
-				gc.QuadCurveTo(q0X+dx, q0Y+dy, qX+dx, qY+dy)
-			}
-		} else {
-			if on0 {
-				// No-op.
-			} else {
-				midX := (q0X + qX) / 2
-				midY := (q0Y + qY) / 2
-				gc.QuadCurveTo(q0X+dx, q0Y+dy, midX+dx, midY+dy)
-			}
-		}
-		q0X, q0Y, on0 = qX, qY, on
+	if gc.synthetic&FontStyleBold != 0 {
+		gc.glyphBuf.Embolden(gc.emboldenStrength())
 	}
-	// Close the curve.
-	if on0 {
-		gc.LineTo(startX+dx, startY+dy)
-	} else {
-		gc.QuadCurveTo(q0X+dx, q0Y+dy, startX+dx, startY+dy)
+	if gc.synthetic&FontStyleItalic != 0 {
+		gc.glyphBuf.Oblique(truetype.ObliqueSlant)
 	}
+	return nil
+}
+
+// emboldenStrength returns how much wider glyphs are in the synthetic
+// bold style, in 26.6 fixed point units.
+func (gc *ImageGraphicContext) emboldenStrength() int32 {
+	if gc.synthetic&FontStyleBold == 0 {
+		return 0
+	}
+	return int32(truetype.EmboldenStrength * float64(gc.Current.scale))
 }
 
 func (gc *ImageGraphicContext) drawGlyph(glyph truetype.Index, dx, dy float64) error {
-	if err := gc.glyphBuf.Load(gc.Current.font, gc.Current.scale, glyph, truetype.NoHinting); err != nil {
+	if err := gc.loadGlyph(glyph); err != nil {
 		return err
 	}
-	e0 := 0
-	for _, e1 := range gc.glyphBuf.End {
-		gc.drawContour(gc.glyphBuf.Point[e0:e1], dx, dy)
-		e0 = e1
-	}
+	gc.segs = gc.glyphBuf.Segments(gc.segs[:0])
+	gc.Current.Path.AppendOutline(gc.segs, dx, dy)
 	return nil
 }
 
 // CreateStringPath creates a path from the string s at x, y, and returns the string width.
+// The string is shaped with the font's default OpenType features, such as
+// ligatures and kerning.
 // The text is placed so that the left edge of the em square of the first character of s
 // and the baseline intersect at x, y. The majority of the affected pixels will be
 // above and to the right of the point, but some may be below or to the left.
@@ -187,19 +190,13 @@ func (gc *ImageGraphicContext) CreateStringPath(s string, x, y float64) float64
 		return 0.0
 	}
 	startx := x
-	prev, hasPrev := truetype.Index(0), false
-	for _, rune := range s {
-		index := font.Index(rune)
-		if hasPrev {
-			x += fUnitsToFloat64(font.Kerning(gc.Current.scale, prev, index))
-		}
-		err := gc.drawGlyph(index, x, y)
+	for _, g := range font.Shape(gc.Current.scale, s, nil) {
+		err := gc.drawGlyph(g.Index, x+fUnitsToFloat64(g.XOffset), y-fUnitsToFloat64(g.YOffset))
 		if err != nil {
 			log.Println(err)
 			return startx - x
 		}
-		x += fUnitsToFloat64(font.HMetric(gc.Current.scale, index).AdvanceWidth)
-		prev, hasPrev = index, true
+		x += fUnitsToFloat64(g.XAdvance + gc.emboldenStrength())
 	}
 	return x - startx
 }
@@ -216,13 +213,8 @@ func (gc *ImageGraphicContext) GetStringBounds(s string) (left, top, right, bott
 	}
 	top, left, bottom, right = 10e6, 10e6, -10e6, -10e6
 	cursor := 0.0
-	prev, hasPrev := truetype.Index(0), false
-	for _, rune := range s {
-		index := font.Index(rune)
-		if hasPrev {
-			cursor += fUnitsToFloat64(font.Kerning(gc.Current.scale, prev, index))
-		}
-		if err := gc.glyphBuf.Load(gc.Current.font, gc.Current.scale, index, truetype.NoHinting); err != nil {
+	for _, g := range font.Shape(gc.Current.scale, s, nil) {
+		if err := gc.loadGlyph(g.Index); err != nil {
 			log.Println(err)
 			return 0, 0, 0, 0
 		}
@@ -231,14 +223,15 @@ func (gc *ImageGraphicContext) GetStringBounds(s string) (left, top, right, bott
 			ps := gc.glyphBuf.Point[e0:e1]
 			for _, p := range ps {
 				x, y := pointToF64Point(p)
+				x += cursor + fUnitsToFloat64(g.XOffset)
+				y -= fUnitsToFloat64(g.YOffset)
 				top = math.Min(top, y)
 				bottom = math.Max(bottom, y)
-				left = math.Min(left, x+cursor)
-				right = math.Max(right, x+cursor)
+				left = math.Min(left, x)
+				right = math.Max(right, x)
 			}
 		}
-		cursor += fUnitsToFloat64(font.HMetric(gc.Current.scale, index).AdvanceWidth)
-		prev, hasPrev = index, true
+		cursor += fUnitsToFloat64(g.XAdvance + gc.emboldenStrength())
 	}
 	return left, top, right, bottom
 }
@@ -4,6 +4,7 @@
 package draw2d
 
 import (
+	"code.google.com/p/freetype-go/freetype/truetype"
 	"fmt"
 	"math"
 )
@@ -162,6 +163,32 @@ func (p *PathStorage) RArcTo(dcx, dcy, rx, ry, startAngle, angle float64) *PathS
 	return p
 }
 
+// AppendOutline appends a glyph outline, as returned by
+// truetype.Font.Outline or truetype.GlyphBuf.Segments, with the glyph's
+// origin at x, y. The outline is measured in 26.6 fixed point units with
+// positive Y going upwards, and is turned into pixels with positive Y going
+// downwards. Each contour is closed.
+func (p *PathStorage) AppendOutline(segs []truetype.Segment, x, y float64) *PathStorage {
+	for i, s := range segs {
+		switch s.Op {
+		case truetype.SegmentOpMoveTo:
+			if i > 0 {
+				p.Close()
+			}
+			p.MoveTo(x+fUnitsToFloat64(s.Args[0].X), y-fUnitsToFloat64(s.Args[0].Y))
+		case truetype.SegmentOpLineTo:
+			p.LineTo(x+fUnitsToFloat64(s.Args[0].X), y-fUnitsToFloat64(s.Args[0].Y))
+		case truetype.SegmentOpQuadTo:
+			p.QuadCurveTo(x+fUnitsToFloat64(s.Args[0].X), y-fUnitsToFloat64(s.Args[0].Y),
+				x+fUnitsToFloat64(s.Args[1].X), y-fUnitsToFloat64(s.Args[1].Y))
+		}
+	}
+	if len(segs) > 0 {
+		p.Close()
+	}
+	return p
+}
+
 func (p *PathStorage) String() string {
 	s := ""
 	j := 0
@@ -0,0 +1,35 @@
+// Copyright 2010 The draw2d Authors. All rights reserved.
+
+package draw2d
+
+import (
+	"testing"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+func TestAppendOutline(t *testing.T) {
+	pt := func(x, y int32) truetype.Point { return truetype.Point{X: 64 * x, Y: 64 * y} }
+	segs := []truetype.Segment{
+		{Op: truetype.SegmentOpMoveTo, Args: [2]truetype.Point{pt(0, 0)}},
+		{Op: truetype.SegmentOpQuadTo, Args: [2]truetype.Point{pt(2, 0), pt(3, 1)}},
+		{Op: truetype.SegmentOpLineTo, Args: [2]truetype.Point{pt(0, 0)}},
+		{Op: truetype.SegmentOpMoveTo, Args: [2]truetype.Point{pt(1, 1)}},
+		{Op: truetype.SegmentOpLineTo, Args: [2]truetype.Point{pt(1, 2)}},
+	}
+	p := new(PathStorage).AppendOutline(segs, 10, 20)
+	// Y goes downwards from the origin, and each contour is closed.
+	want := "MoveTo: 10.000000, 20.000000\n" +
+		"QuadCurveTo: 12.000000, 20.000000, 13.000000, 19.000000\n" +
+		"LineTo: 10.000000, 20.000000\n" +
+		"Close\n" +
+		"MoveTo: 11.000000, 19.000000\n" +
+		"LineTo: 11.000000, 18.000000\n" +
+		"Close\n"
+	if got := p.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := new(PathStorage).AppendOutline(nil, 10, 20).String(); got != "" {
+		t.Errorf("no segments: got %q", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"image"
+	"math"
+
+	"code.google.com/p/freetype-go/freetype/raster"
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// A bitmapKey identifies a glyph of a font in the font set.
+type bitmapKey struct {
+	face  int
+	glyph truetype.Index
+}
+
+// A scaledBitmap is a color bitmap glyph scaled to the font size.
+type scaledBitmap struct {
+	img *image.RGBA
+	// offset is from the pen position on the baseline to the top left
+	// corner of img.
+	offset       image.Point
+	advanceWidth raster.Fix32
+}
+
+// bitmap returns the color bitmap of the given glyph of the face'th font,
+// scaled to the font size, or nil if it has none.
+func (c *Context) bitmap(face int, glyph truetype.Index) (*scaledBitmap, error) {
+	f := c.fonts[face].Font
+	if !f.HasBitmaps() {
+		return nil, nil
+	}
+	k := bitmapKey{face, glyph}
+	if b, ok := c.bitmaps[k]; ok {
+		return b, nil
+	}
+	em := float64(c.scale) / 64
+	bm, err := f.Bitmap(glyph, int(em+0.5))
+	if err != nil {
+		return nil, err
+	}
+	var b *scaledBitmap
+	if bm != nil && bm.PPEM > 0 {
+		ratio := em / float64(bm.PPEM)
+		size := bm.Image.Bounds().Size()
+		b = &scaledBitmap{
+			img: scaleImage(bm.Image,
+				int(math.Ceil(float64(size.X)*ratio)),
+				int(math.Ceil(float64(size.Y)*ratio))),
+			offset: image.Point{
+				X: int(math.Floor(float64(bm.BearingX)*ratio + 0.5)),
+				Y: -int(math.Floor(float64(bm.BearingY)*ratio + 0.5)),
+			},
+			advanceWidth: raster.Fix32(float64(bm.Advance) * ratio * 256),
+		}
+	}
+	if c.bitmaps == nil {
+		c.bitmaps = make(map[bitmapKey]*scaledBitmap)
+	}
+	c.bitmaps[k] = b
+	return b, nil
+}
+
+// scaleImage resizes src to w by h pixels. Each destination pixel is the
+// average of the source pixels under it.
+func scaleImage(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, ((y+1)*sh+h-1)/h
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, ((x+1)*sw+w-1)/w
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+sr, g+sg, b+sb, a+sa, n+1
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,127 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"container/list"
+	"image"
+	"sync"
+
+	"code.google.com/p/freetype-go/freetype/raster"
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// A GlyphCache holds rasterized glyphs for any number of Contexts, which
+// may draw at the same time from different goroutines. When the masks it
+// holds take more than its size in bytes, the least recently used glyphs
+// are dropped.
+type GlyphCache struct {
+	mu sync.Mutex
+	// size is the limit on bytes, the sum of the entries' sizes.
+	size, bytes int
+	// lru holds the *glyphEntry values, most recently used first.
+	lru   *list.List
+	index map[glyphKey]*list.Element
+	stats GlyphCacheStats
+}
+
+// GlyphCacheStats tells how well a GlyphCache works.
+type GlyphCacheStats struct {
+	// Hits and Misses count the glyphs which were and were not found, and
+	// Evictions the glyphs dropped to make space for others.
+	Hits, Misses, Evictions uint64
+	// Glyphs is the number of glyphs held, and Bytes the size of their
+	// masks.
+	Glyphs, Bytes int
+}
+
+// A glyphKey is everything a glyph's mask depends on. The sub-pixel
+// offsets are exact, from 0 to 255.
+type glyphKey struct {
+	font    *truetype.Font
+	scale   int32
+	hinting Hinting
+	glyph   truetype.Index
+	fx, fy  raster.Fix32
+	// embolden and slant are the synthetic bold and oblique of the glyph.
+	embolden int32
+	slant    float64
+	// layer is the layer of the glyph, and outline and blur the width of
+	// its outline and the blur radius of its shadow, if they are drawn.
+	layer   layer
+	outline raster.Fix32
+	blur    int
+}
+
+type glyphEntry struct {
+	key          glyphKey
+	advanceWidth raster.Fix32
+	mask         *image.Alpha
+	offset       image.Point
+}
+
+// NewGlyphCache returns a GlyphCache which holds up to size bytes of masks.
+func NewGlyphCache(size int) *GlyphCache {
+	return &GlyphCache{
+		size:  size,
+		lru:   list.New(),
+		index: make(map[glyphKey]*list.Element),
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (g *GlyphCache) Stats() GlyphCacheStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.stats
+	s.Glyphs, s.Bytes = g.lru.Len(), g.bytes
+	return s
+}
+
+// get returns the entry for k, if there is one.
+func (g *GlyphCache) get(k glyphKey) (*glyphEntry, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	el, ok := g.index[k]
+	if !ok {
+		g.stats.Misses++
+		return nil, false
+	}
+	g.stats.Hits++
+	g.lru.MoveToFront(el)
+	return el.Value.(*glyphEntry), true
+}
+
+// put adds e to the cache, dropping the least recently used entries to
+// make space for it. A mask bigger than the whole cache is not kept.
+func (g *GlyphCache) put(e *glyphEntry) {
+	n := entrySize(e)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if n > g.size {
+		return
+	}
+	if el, ok := g.index[e.key]; ok {
+		// Another Context rasterized the same glyph meanwhile.
+		g.lru.MoveToFront(el)
+		return
+	}
+	for g.bytes+n > g.size {
+		el := g.lru.Back()
+		old := g.lru.Remove(el).(*glyphEntry)
+		delete(g.index, old.key)
+		g.bytes -= entrySize(old)
+		g.stats.Evictions++
+	}
+	g.index[e.key] = g.lru.PushFront(e)
+	g.bytes += n
+}
+
+// entrySize returns the number of bytes e is counted for: its mask plus
+// about as much as the entry itself takes.
+func entrySize(e *glyphEntry) int {
+	return len(e.mask.Pix) + 64
+}
@@ -0,0 +1,96 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"image"
+	"sync"
+	"testing"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// testEntry returns an entry for glyph i with a mask of n bytes.
+func testEntry(i, n int) *glyphEntry {
+	return &glyphEntry{
+		key:  glyphKey{glyph: truetype.Index(i)},
+		mask: image.NewAlpha(image.Rect(0, 0, n, 1)),
+	}
+}
+
+func TestGlyphCacheLRU(t *testing.T) {
+	const n = 100
+	size := entrySize(testEntry(0, n))
+	g := NewGlyphCache(3 * size)
+	for i := 0; i < 3; i++ {
+		g.put(testEntry(i, n))
+	}
+	// Glyph 0 becomes the most recently used, so glyph 1 is dropped for
+	// glyph 3.
+	if _, ok := g.get(glyphKey{glyph: 0}); !ok {
+		t.Fatal("glyph 0 is not in the cache")
+	}
+	g.put(testEntry(3, n))
+	for i, want := range []bool{true, false, true, true} {
+		if _, ok := g.get(glyphKey{glyph: truetype.Index(i)}); ok != want {
+			t.Errorf("glyph %d: got %v, want %v", i, ok, want)
+		}
+	}
+	want := GlyphCacheStats{Hits: 4, Misses: 1, Evictions: 1, Glyphs: 3, Bytes: 3 * size}
+	if s := g.Stats(); s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	// Putting a glyph again does not count it twice.
+	g.put(testEntry(3, n))
+	if s := g.Stats(); s.Glyphs != 3 || s.Bytes != 3*size {
+		t.Errorf("put again: got %+v", s)
+	}
+	// A glyph which takes two places drops the two least recent ones.
+	g.put(testEntry(4, 2*n+64))
+	if s := g.Stats(); s.Glyphs != 2 || s.Bytes != 3*size || s.Evictions != 3 {
+		t.Errorf("big glyph: got %+v", s)
+	}
+	// A glyph bigger than the cache is not kept, and drops nothing.
+	g.put(testEntry(5, 3*size))
+	if _, ok := g.get(glyphKey{glyph: 5}); ok {
+		t.Error("a glyph bigger than the cache is kept")
+	}
+	if s := g.Stats(); s.Glyphs != 2 {
+		t.Errorf("too big glyph: got %+v", s)
+	}
+}
+
+func TestGlyphCacheConcurrent(t *testing.T) {
+	const n = 10
+	size := entrySize(testEntry(0, n))
+	g := NewGlyphCache(20 * size)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := (i*7 + w) % 50
+				if e, ok := g.get(glyphKey{glyph: truetype.Index(k)}); ok {
+					if e.key.glyph != truetype.Index(k) {
+						t.Errorf("got glyph %d for %d", e.key.glyph, k)
+					}
+					continue
+				}
+				g.put(testEntry(k, n))
+			}
+		}(w)
+	}
+	wg.Wait()
+	s := g.Stats()
+	if s.Hits+s.Misses != 8*1000 {
+		t.Errorf("got %d hits and %d misses, want 8000 in all", s.Hits, s.Misses)
+	}
+	if s.Glyphs != 20 || s.Bytes != 20*size || len(g.index) != s.Glyphs {
+		t.Errorf("got %+v with %d indexed", s, len(g.index))
+	}
+}
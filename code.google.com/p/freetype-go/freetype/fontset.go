@@ -0,0 +1,92 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"unicode/utf8"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// A Face is one of the fonts in a FontSet.
+type Face struct {
+	Font *truetype.Font
+	// Baseline moves the glyphs of the font down by this fraction of an
+	// em, so that they line up with the glyphs of the other fonts. It is
+	// negative to move them up.
+	Baseline float64
+}
+
+// A FontSet is an ordered list of fonts. Each rune is drawn with the first
+// font that has a glyph for it, so that a symbol or emoji font can fill in
+// for what the primary font lacks.
+type FontSet []Face
+
+// NewFontSet returns a FontSet of the given fonts, in order of preference,
+// all sharing the same baseline.
+func NewFontSet(fonts ...*truetype.Font) FontSet {
+	s := make(FontSet, len(fonts))
+	for i, f := range fonts {
+		s[i].Font = f
+	}
+	return s
+}
+
+// Lookup returns the position in s of the first font with a glyph for x,
+// and the glyph's index in that font. If no font has one, it returns the
+// first font's index for x, which is typically that font's missing glyph.
+func (s FontSet) Lookup(x rune) (int, truetype.Index) {
+	for i, face := range s {
+		if index := face.Font.Index(x); index != 0 {
+			return i, index
+		}
+	}
+	if len(s) == 0 {
+		return -1, 0
+	}
+	return 0, s[0].Font.Index(x)
+}
+
+// LookupVariant is like Lookup, but for x followed by the variation
+// selector vs. The font is chosen by x alone, and then its glyph for the
+// sequence is used if it has one.
+func (s FontSet) LookupVariant(x, vs rune) (int, truetype.Index) {
+	for i, face := range s {
+		if face.Font.Index(x) != 0 {
+			return i, face.Font.IndexVariant(x, vs)
+		}
+	}
+	if len(s) == 0 {
+		return -1, 0
+	}
+	return 0, s[0].Font.IndexVariant(x, vs)
+}
+
+// next looks up the rune at the start of str, together with a variation
+// selector after it, and returns the number of bytes they take. A variation
+// selector with no rune before it is skipped, returning a face of -1.
+func (s FontSet) next(str string) (face int, index truetype.Index, n int) {
+	x, n := utf8.DecodeRuneInString(str)
+	if truetype.IsVariationSelector(x) {
+		return -1, 0, n
+	}
+	if vs, m := utf8.DecodeRuneInString(str[n:]); truetype.IsVariationSelector(vs) {
+		face, index = s.LookupVariant(x, vs)
+		return face, index, n + m
+	}
+	face, index = s.Lookup(x)
+	return face, index, n
+}
+
+// Has returns whether any font in s has a glyph for x.
+func (s FontSet) Has(x rune) bool {
+	for _, face := range s {
+		if face.Font.Index(x) != 0 {
+			return true
+		}
+	}
+	return false
+}
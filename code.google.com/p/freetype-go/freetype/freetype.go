@@ -12,6 +12,7 @@ import (
 	"errors"
 	"image"
 	"image/draw"
+	"math"
 
 	"code.google.com/p/freetype-go/freetype/raster"
 	"code.google.com/p/freetype-go/freetype/truetype"
@@ -27,11 +28,11 @@ const (
 	nYFractions = 1
 )
 
-// An entry in the glyph cache is keyed explicitly by the glyph index and
-// implicitly by the quantized x and y fractional offset. It maps to a mask
-// image and an offset.
+// An entry in the glyph cache is keyed explicitly by the font's position in
+// the font set and the glyph index, and implicitly by the quantized x and y
+// fractional offset. It maps to a mask image and an offset.
 type cacheEntry struct {
-	valid        bool
+	face         int
 	glyph        truetype.Index
 	advanceWidth raster.Fix32
 	mask         *image.Alpha
@@ -66,9 +67,13 @@ const (
 
 // A Context holds the state for drawing text in a given font and size.
 type Context struct {
-	r        *raster.Rasterizer
+	r *raster.Rasterizer
+	// fonts is the font set, and font is the first font in it.
+	fonts    FontSet
 	font     *truetype.Font
 	glyphBuf *truetype.GlyphBuf
+	// segs holds the outline of the glyph being rasterized.
+	segs []truetype.Segment
 	// clip is the clip rectangle for drawing.
 	clip image.Rectangle
 	// dst and src are the destination and source images for drawing.
@@ -79,8 +84,29 @@ type Context struct {
 	fontSize, dpi float64
 	scale         int32
 	hinting       Hinting
-	// cache is the glyph cache.
-	cache [nGlyphs * nXFractions * nYFractions]cacheEntry
+	// shaping chooses the OpenType features to draw text with.
+	shaping truetype.ShapeOptions
+	// outlineWidth and outlineSrc are the width in points and the source
+	// image of the outline around the glyphs. shadowX, shadowY and
+	// shadowBlur are the offset and blur in points of their shadow, and
+	// shadowSrc its source image. A nil source means none.
+	outlineWidth                 float64
+	outlineSrc                   image.Image
+	shadowX, shadowY, shadowBlur float64
+	shadowSrc                    image.Image
+	// embolden is the strength in ems of synthetic bold, and slant the
+	// slant of synthetic oblique.
+	embolden, slant float64
+	// path is scratch space for stroking outlines.
+	path raster.Path
+	// cache is the glyph cache of each layer, indexed like an array of
+	// nGlyphs * nXFractions * nYFractions entries but only holding those
+	// which are used, and bitmaps caches color bitmap glyphs. glyphCache,
+	// if not nil, is where glyphs missing from cache are looked up before
+	// they are rasterized.
+	cache      [nLayers]map[int]cacheEntry
+	glyphCache *GlyphCache
+	bitmaps    map[bitmapKey]*scaledBitmap
 }
 
 // PointToFix32 converts the given number of points (as in ``a 12 point font'')
@@ -89,60 +115,61 @@ func (c *Context) PointToFix32(x float64) raster.Fix32 {
 	return raster.Fix32(x * float64(c.dpi) * (256.0 / 72.0))
 }
 
-// drawContour draws the given closed contour with the given offset.
-func (c *Context) drawContour(ps []truetype.Point, dx, dy raster.Fix32) {
-	if len(ps) == 0 {
-		return
-	}
-	// ps[0] is a truetype.Point measured in FUnits and positive Y going upwards.
-	// start is the same thing measured in fixed point units and positive Y
-	// going downwards, and offset by (dx, dy)
-	start := raster.Point{
-		X: dx + raster.Fix32(ps[0].X<<2),
-		Y: dy - raster.Fix32(ps[0].Y<<2),
-	}
-	c.r.Start(start)
-	q0, on0 := start, true
-	for _, p := range ps[1:] {
-		q := raster.Point{
+// drawOutline adds the given glyph outline with the given offset to a.
+func drawOutline(a raster.Adder, segs []truetype.Segment, dx, dy raster.Fix32) {
+	// The segments are measured in FUnits and positive Y going upwards.
+	// pt returns a point measured in fixed point units and positive Y
+	// going downwards, and offset by (dx, dy).
+	pt := func(p truetype.Point) raster.Point {
+		return raster.Point{
 			X: dx + raster.Fix32(p.X<<2),
 			Y: dy - raster.Fix32(p.Y<<2),
 		}
-		on := p.Flags&0x01 != 0
-		if on {
-			if on0 {
-				c.r.Add1(q)
-			} else {
-				c.r.Add2(q0, q)
-			}
-		} else {
-			if on0 {
-				// No-op.
-			} else {
-				mid := raster.Point{
-					X: (q0.X + q.X) / 2,
-					Y: (q0.Y + q.Y) / 2,
-				}
-				c.r.Add2(q0, mid)
-			}
+	}
+	for _, s := range segs {
+		switch s.Op {
+		case truetype.SegmentOpMoveTo:
+			a.Start(pt(s.Args[0]))
+		case truetype.SegmentOpLineTo:
+			a.Add1(pt(s.Args[0]))
+		case truetype.SegmentOpQuadTo:
+			a.Add2(pt(s.Args[0]), pt(s.Args[1]))
 		}
-		q0, on0 = q, on
 	}
-	// Close the curve.
-	if on0 {
-		c.r.Add1(start)
-	} else {
-		c.r.Add2(q0, start)
+}
+
+// load loads the given glyph of the face'th font into c.glyphBuf, made
+// bold or oblique if so set.
+func (c *Context) load(face int, glyph truetype.Index) error {
+	if err := c.glyphBuf.Load(c.fonts[face].Font, c.scale, glyph, truetype.Hinting(c.hinting)); err != nil {
+		return err
 	}
+	c.glyphBuf.Embolden(c.emboldenStrength())
+	c.glyphBuf.Oblique(c.slant)
+	return nil
 }
 
 // rasterize returns the advance width, glyph mask and integer-pixel offset
-// to render the given glyph at the given sub-pixel offsets.
-// The 24.8 fixed point arguments fx and fy must be in the range [0, 1).
-func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (
+// to render the given layer of the given glyph of the face'th font at the
+// given sub-pixel offsets. The 24.8 fixed point arguments fx and fy must be
+// in the range [0, 1).
+func (c *Context) rasterize(l layer, face int, glyph truetype.Index, fx, fy raster.Fix32) (
 	raster.Fix32, *image.Alpha, image.Point, error) {
 
-	if err := c.glyphBuf.Load(c.font, c.scale, glyph, truetype.Hinting(c.hinting)); err != nil {
+	if l == shadowLayer {
+		// The shadow is the blurred glyph, or its outline if it has one.
+		base := fillLayer
+		if c.outlineSrc != nil {
+			base = outlineLayer
+		}
+		advanceWidth, a, offset, err := c.rasterize(base, face, glyph, fx, fy)
+		if err != nil {
+			return 0, nil, image.Point{}, err
+		}
+		r := c.blurRadius()
+		return advanceWidth, blur(a, r), offset.Sub(image.Point{3 * r, 3 * r}), nil
+	}
+	if err := c.load(face, glyph); err != nil {
 		return 0, nil, image.Point{}, err
 	}
 	// Calculate the integer-pixel bounds for the glyph.
@@ -153,6 +180,8 @@ func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (
 	if xmin > xmax || ymin > ymax {
 		return 0, nil, image.Point{}, errors.New("freetype: negative sized glyph")
 	}
+	pad := c.pad(l)
+	xmin, ymin, xmax, ymax = xmin-pad, ymin-pad, xmax+pad, ymax+pad
 	// A TrueType's glyph's nodes can have negative co-ordinates, but the
 	// rasterizer clips anything left of x=0 or above y=0. xmin and ymin
 	// are the pixel offsets, based on the font's FUnit metrics, that let
@@ -162,10 +191,16 @@ func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (
 	fy += raster.Fix32(-ymin << 8)
 	// Rasterize the glyph's vectors.
 	c.r.Clear()
-	e0 := 0
-	for _, e1 := range c.glyphBuf.End {
-		c.drawContour(c.glyphBuf.Point[e0:e1], fx, fy)
-		e0 = e1
+	c.segs = c.glyphBuf.Segments(c.segs[:0])
+	drawOutline(c.r, c.segs, fx, fy)
+	if l == outlineLayer {
+		// The outline is the glyph and a stroke along its contours, which
+		// overlap.
+		c.path.Clear()
+		drawOutline(&c.path, c.segs, fx, fy)
+		raster.Stroke(c.r, c.path, 2*c.outlinePixels(), nil, nil)
+		c.r.UseNonZeroWinding = true
+		defer func() { c.r.UseNonZeroWinding = false }()
 	}
 	a := image.NewAlpha(image.Rect(0, 0, xmax-xmin, ymax-ymin))
 	c.r.Rasterize(raster.NewAlphaSrcPainter(a))
@@ -173,30 +208,58 @@ func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (
 }
 
 // glyph returns the advance width, glyph mask and integer-pixel offset to
-// render the given glyph at the given sub-pixel point. It is a cache for the
-// rasterize method. Unlike rasterize, p's co-ordinates do not have to be in
-// the range [0, 1).
-func (c *Context) glyph(glyph truetype.Index, p raster.Point) (
+// render the given layer of the given glyph of the face'th font at the
+// given sub-pixel point. It is a cache for the rasterize method. Unlike
+// rasterize, p's co-ordinates do not have to be in the range [0, 1).
+func (c *Context) glyph(l layer, face int, glyph truetype.Index, p raster.Point) (
 	raster.Fix32, *image.Alpha, image.Point, error) {
 
 	// Split p.X and p.Y into their integer and fractional parts.
 	ix, fx := int(p.X>>8), p.X&0xff
 	iy, fy := int(p.Y>>8), p.Y&0xff
-	// Calculate the index t into the cache array.
-	tg := int(glyph) % nGlyphs
 	tx := int(fx) / (256 / nXFractions)
 	ty := int(fy) / (256 / nYFractions)
+	// Calculate the index t into the cache.
+	tg := (int(glyph) + face) % nGlyphs
 	t := ((tg*nXFractions)+tx)*nYFractions + ty
 	// Check for a cache hit.
-	if e := c.cache[t]; e.valid && e.glyph == glyph {
+	if e := c.cache[l][t]; e.face == face && e.glyph == glyph && e.mask != nil {
 		return e.advanceWidth, e.mask, e.offset.Add(image.Point{ix, iy}), nil
 	}
-	// Rasterize the glyph and put the result into the cache.
-	advanceWidth, mask, offset, err := c.rasterize(glyph, fx, fy)
-	if err != nil {
-		return 0, nil, image.Point{}, err
+	// Rasterize the glyph, or take it from the GlyphCache, and put the
+	// result into the cache. The GlyphCache is keyed by the exact offset,
+	// so that the glyph is the same as if it were rasterized here.
+	var (
+		advanceWidth raster.Fix32
+		mask         *image.Alpha
+		offset       image.Point
+		k            glyphKey
+		ok           bool
+	)
+	if c.glyphCache != nil {
+		k = glyphKey{c.fonts[face].Font, c.scale, c.hinting, glyph, fx, fy, c.emboldenStrength(), c.slant, l, 0, 0}
+		if l != fillLayer {
+			k.outline, k.blur = c.outlinePixels(), c.blurRadius()
+		}
+		var e *glyphEntry
+		if e, ok = c.glyphCache.get(k); ok {
+			advanceWidth, mask, offset = e.advanceWidth, e.mask, e.offset
+		}
+	}
+	if !ok {
+		var err error
+		advanceWidth, mask, offset, err = c.rasterize(l, face, glyph, fx, fy)
+		if err != nil {
+			return 0, nil, image.Point{}, err
+		}
+		if c.glyphCache != nil {
+			c.glyphCache.put(&glyphEntry{k, advanceWidth, mask, offset})
+		}
 	}
-	c.cache[t] = cacheEntry{true, glyph, advanceWidth, mask, offset}
+	if c.cache[l] == nil {
+		c.cache[l] = make(map[int]cacheEntry)
+	}
+	c.cache[l][t] = cacheEntry{face, glyph, advanceWidth, mask, offset}
 	return advanceWidth, mask, offset.Add(image.Point{ix, iy}), nil
 }
 
@@ -207,36 +270,220 @@ func (c *Context) glyph(glyph truetype.Index, p raster.Point) (
 // For example, drawing a string that starts with a 'J' in an italic font may
 // affect pixels below and left of the point.
 // p is a raster.Point and can therefore represent sub-pixel positions.
+// Each rune is drawn with the first font in the font set that has it, in the
+// variant chosen by a following variation selector. The runs of runes of
+// each font are shaped with the font's OpenType features.
+// The shadows and outlines of all the glyphs, if set, are drawn before the
+// glyphs themselves.
 func (c *Context) DrawString(s string, p raster.Point) (raster.Point, error) {
 	if c.font == nil {
 		return raster.Point{}, errors.New("freetype: DrawText called with a nil font")
 	}
-	prev, hasPrev := truetype.Index(0), false
-	for _, rune := range s {
-		index := c.font.Index(rune)
-		if hasPrev {
-			kern := raster.Fix32(c.font.Kerning(c.scale, prev, index)) << 2
-			if c.hinting != NoHinting {
-				kern = (kern + 128) &^ 255
+	runs := c.runs(s)
+	glyphs := make([][]truetype.GlyphPos, len(runs))
+	for i, r := range runs {
+		glyphs[i] = c.shape(r)
+	}
+	var q raster.Point
+	for _, l := range c.layers() {
+		q = p
+		for i, r := range runs {
+			var err error
+			q, err = c.drawGlyphs(l, r.face, glyphs[i], q)
+			if err != nil {
+				return raster.Point{}, err
+			}
+		}
+	}
+	return q, nil
+}
+
+// DrawGlyphs draws glyphs of the face'th font of the font set, as shaped by
+// its Shape method at the context's scale, and returns p advanced past them.
+// p is on the baseline, as for DrawString.
+func (c *Context) DrawGlyphs(face int, glyphs []truetype.GlyphPos, p raster.Point) (raster.Point, error) {
+	if c.font == nil {
+		return raster.Point{}, errors.New("freetype: DrawGlyphs called with a nil font")
+	}
+	var q raster.Point
+	for _, l := range c.layers() {
+		var err error
+		if q, err = c.drawGlyphs(l, face, glyphs, p); err != nil {
+			return raster.Point{}, err
+		}
+	}
+	return q, nil
+}
+
+// drawGlyphs draws the layer l of glyphs, as for DrawGlyphs. Color bitmap
+// glyphs have no shadow or outline.
+func (c *Context) drawGlyphs(l layer, face int, glyphs []truetype.GlyphPos, p raster.Point) (raster.Point, error) {
+	src := c.layerSrc(l)
+	for _, g := range glyphs {
+		q := raster.Point{
+			X: p.X + raster.Fix32(g.XOffset<<2),
+			Y: p.Y - raster.Fix32(g.YOffset<<2) + c.baseline(face),
+		}
+		if l == shadowLayer {
+			q = q.Add(c.shadowOffset())
+		}
+		b, err := c.bitmap(face, g.Index)
+		if err != nil {
+			return raster.Point{}, err
+		}
+		if b != nil {
+			// Color bitmaps are drawn as they are, not in the src color.
+			r := b.img.Bounds().Add(b.offset).Add(image.Point{
+				X: int(q.X+128) >> 8,
+				Y: int(q.Y+128) >> 8,
+			})
+			if dr := c.clip.Intersect(r); l == fillLayer && !dr.Empty() {
+				draw.Draw(c.dst, dr, b.img, dr.Min.Sub(r.Min), draw.Over)
 			}
-			p.X += kern
+			p.X += b.advanceWidth + c.adjustment(face, g)
+			p.Y -= raster.Fix32(g.YAdvance << 2)
+			continue
 		}
-		advanceWidth, mask, offset, err := c.glyph(index, p)
+		advanceWidth, mask, offset, err := c.glyph(l, face, g.Index, q)
 		if err != nil {
 			return raster.Point{}, err
 		}
-		p.X += advanceWidth
+		p.X += advanceWidth + c.adjustment(face, g)
+		p.Y -= raster.Fix32(g.YAdvance << 2)
 		glyphRect := mask.Bounds().Add(offset)
 		dr := c.clip.Intersect(glyphRect)
 		if !dr.Empty() {
 			mp := image.Point{0, dr.Min.Y - glyphRect.Min.Y}
-			draw.DrawMask(c.dst, dr, c.src, image.ZP, mask, mp, draw.Over)
+			draw.DrawMask(c.dst, dr, src, image.ZP, mask, mp, draw.Over)
 		}
-		prev, hasPrev = index, true
 	}
 	return p, nil
 }
 
+// Extents are the dimensions of a string as it would be drawn by DrawString.
+// All values are relative to the point the string would be drawn at, with
+// positive Y going downwards.
+type Extents struct {
+	// Advance is how far the pen moves, including kerning.
+	Advance raster.Fix32
+	// Min and Max are the corners of the bounding box of the ink, including
+	// any outline and shadow. They are both zero if the string draws
+	// nothing, e.g. it is all spaces.
+	Min, Max raster.Point
+}
+
+// MeasureString returns the extents of s, shaped and positioned in the same
+// way as DrawString, without drawing it.
+func (c *Context) MeasureString(s string) (Extents, error) {
+	var e Extents
+	if c.font == nil {
+		return e, errors.New("freetype: MeasureString called with a nil font")
+	}
+	inked := false
+	for _, r := range c.runs(s) {
+		for _, g := range c.shape(r) {
+			b, err := c.bitmap(r.face, g.Index)
+			if err != nil {
+				return Extents{}, err
+			}
+			// min and max are the corners of the glyph's ink, relative to
+			// the pen position.
+			var min, max raster.Point
+			var advanceWidth raster.Fix32
+			if b != nil {
+				r := b.img.Bounds().Add(b.offset)
+				min = raster.Point{X: raster.Fix32(r.Min.X << 8), Y: raster.Fix32(r.Min.Y << 8)}
+				max = raster.Point{X: raster.Fix32(r.Max.X << 8), Y: raster.Fix32(r.Max.Y << 8)}
+				advanceWidth = b.advanceWidth
+			} else {
+				if err := c.load(r.face, g.Index); err != nil {
+					return Extents{}, err
+				}
+				advanceWidth = raster.Fix32(c.glyphBuf.AdvanceWidth << 2)
+				if len(c.glyphBuf.Point) == 0 {
+					e.Advance += advanceWidth + c.adjustment(r.face, g)
+					continue
+				}
+				gb := c.glyphBuf.B
+				min = raster.Point{X: raster.Fix32(gb.XMin << 2), Y: -raster.Fix32(gb.YMax << 2)}
+				max = raster.Point{X: raster.Fix32(gb.XMax << 2), Y: -raster.Fix32(gb.YMin << 2)}
+			}
+			d := raster.Point{
+				X: e.Advance + raster.Fix32(g.XOffset<<2),
+				Y: c.baseline(r.face) - raster.Fix32(g.YOffset<<2),
+			}
+			min, max = min.Add(d), max.Add(d)
+			if !inked {
+				e.Min, e.Max, inked = min, max, true
+			} else {
+				if min.X < e.Min.X {
+					e.Min.X = min.X
+				}
+				if min.Y < e.Min.Y {
+					e.Min.Y = min.Y
+				}
+				if max.X > e.Max.X {
+					e.Max.X = max.X
+				}
+				if max.Y > e.Max.Y {
+					e.Max.Y = max.Y
+				}
+			}
+			e.Advance += advanceWidth + c.adjustment(r.face, g)
+		}
+	}
+	if inked {
+		e.Min, e.Max = c.inkBounds(e.Min, e.Max)
+	}
+	return e, nil
+}
+
+// A run is a part of a string whose runes all use the same font.
+type run struct {
+	face int
+	s    string
+}
+
+// runs splits s into runs of the fonts of the font set.
+func (c *Context) runs(s string) []run {
+	var runs []run
+	start, face := 0, -1
+	for i := 0; i < len(s); {
+		f, _, n := c.fonts.next(s[i:])
+		if f >= 0 && f != face {
+			if face >= 0 {
+				runs = append(runs, run{face, s[start:i]})
+			}
+			start, face = i, f
+		}
+		i += n
+	}
+	if face >= 0 {
+		runs = append(runs, run{face, s[start:]})
+	}
+	return runs
+}
+
+// shape shapes a run at the context's scale.
+func (c *Context) shape(r run) []truetype.GlyphPos {
+	return c.fonts[r.face].Font.Shape(c.scale, r.s, &c.shaping)
+}
+
+// adjustment returns how much the shaped advance of g differs from the
+// glyph's own advance width, e.g. by kerning.
+func (c *Context) adjustment(face int, g truetype.GlyphPos) raster.Fix32 {
+	d := raster.Fix32(g.XAdvance-c.fonts[face].Font.HMetric(c.scale, g.Index).AdvanceWidth) << 2
+	if c.hinting != NoHinting {
+		d = (d + 128) &^ 255
+	}
+	return d
+}
+
+// baseline returns how far the glyphs of the face'th font are moved down.
+func (c *Context) baseline(face int) raster.Fix32 {
+	return raster.Fix32(c.fonts[face].Baseline * float64(c.scale<<2))
+}
+
 // recalc recalculates scale and bounds values from the font size, screen
 // resolution and font metrics, and invalidates the glyph cache.
 func (c *Context) recalc() {
@@ -244,16 +491,36 @@ func (c *Context) recalc() {
 	if c.font == nil {
 		c.r.SetBounds(0, 0)
 	} else {
-		// Set the rasterizer's bounds to be big enough to handle the largest glyph.
-		b := c.font.Bounds(c.scale)
-		xmin := +int(b.XMin) >> 6
-		ymin := -int(b.YMax) >> 6
-		xmax := +int(b.XMax+63) >> 6
-		ymax := -int(b.YMin-63) >> 6
-		c.r.SetBounds(xmax-xmin, ymax-ymin)
+		// Set the rasterizer's bounds to be big enough to handle the largest
+		// glyph of any font.
+		width, height := 0, 0
+		for _, face := range c.fonts {
+			b := face.Font.Bounds(c.scale)
+			xmin := +int(b.XMin) >> 6
+			ymin := -int(b.YMax) >> 6
+			xmax := +int(b.XMax+63) >> 6
+			ymax := -int(b.YMin-63) >> 6
+			if width < xmax-xmin {
+				width = xmax - xmin
+			}
+			if height < ymax-ymin {
+				height = ymax - ymin
+			}
+		}
+		// Bold and oblique glyphs, outlines and shadows reach further.
+		width += int(c.emboldenStrength()+63)>>6 + int(math.Abs(c.slant)*float64(height)+1)
+		height += int(c.emboldenStrength()+63) >> 6
+		pad := 2 * c.pad(shadowLayer)
+		c.r.SetBounds(width+pad, height+pad)
 	}
-	for i := range c.cache {
-		c.cache[i] = cacheEntry{}
+	c.clearCache()
+	c.bitmaps = nil
+}
+
+// clearCache invalidates the Context's own glyph cache.
+func (c *Context) clearCache() {
+	for l := range c.cache {
+		c.cache[l] = nil
 	}
 }
 
@@ -268,13 +535,34 @@ func (c *Context) SetDPI(dpi float64) {
 
 // SetFont sets the font used to draw text.
 func (c *Context) SetFont(font *truetype.Font) {
-	if c.font == font {
+	if c.font == font && len(c.fonts) == 1 {
+		return
+	}
+	if font == nil {
+		c.SetFontSet(nil)
 		return
 	}
-	c.font = font
+	c.SetFontSet(NewFontSet(font))
+}
+
+// SetFontSet sets the fonts used to draw text. Each rune is drawn with the
+// first font in the set that has a glyph for it.
+func (c *Context) SetFontSet(fonts FontSet) {
+	c.fonts = fonts
+	c.font = nil
+	if len(fonts) > 0 {
+		c.font = fonts[0].Font
+	}
 	c.recalc()
 }
 
+// SetShapeOptions sets the OpenType features used to draw text, such as
+// the language and proportional widths. The default is the font's default
+// features of horizontal text.
+func (c *Context) SetShapeOptions(opt truetype.ShapeOptions) {
+	c.shaping = opt
+}
+
 // SetFontSize sets the font size in points (as in ``a 12 point font'').
 func (c *Context) SetFontSize(fontSize float64) {
 	if c.fontSize == fontSize {
@@ -287,9 +575,16 @@ func (c *Context) SetFontSize(fontSize float64) {
 // SetHinting sets the hinting policy.
 func (c *Context) SetHinting(hinting Hinting) {
 	c.hinting = hinting
-	for i := range c.cache {
-		c.cache[i] = cacheEntry{}
-	}
+	c.clearCache()
+}
+
+// SetGlyphCache sets a cache of rasterized glyphs to look up glyphs in
+// besides the Context's own, which is small and dropped when the font or
+// its size changes. The same GlyphCache can be shared by many Contexts.
+// Glyphs are drawn the same with or without it. A nil cache goes back to
+// the Context's own one only.
+func (c *Context) SetGlyphCache(cache *GlyphCache) {
+	c.glyphCache = cache
 }
 
 // SetDst sets the destination image for draw operations.
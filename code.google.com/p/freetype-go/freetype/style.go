@@ -0,0 +1,211 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"image"
+
+	"code.google.com/p/freetype-go/freetype/raster"
+)
+
+// A layer is one of the passes text is drawn in. The shadows of all the
+// glyphs are drawn first, then their outlines, and then the glyphs
+// themselves, so that nothing covers a neighbouring glyph.
+type layer int
+
+const (
+	shadowLayer layer = iota
+	outlineLayer
+	fillLayer
+	nLayers
+)
+
+// SetOutline sets the outline drawn around the glyphs, width points wide,
+// in the colors of src, which is typically an image.Uniform. A nil src or
+// a zero width draws no outline.
+func (c *Context) SetOutline(width float64, src image.Image) {
+	if width <= 0 {
+		src = nil
+	}
+	c.outlineWidth, c.outlineSrc = width, src
+	c.recalc()
+}
+
+// SetShadow sets the shadow drawn under the glyphs and their outline,
+// moved dx points right and dy points down, and blurred over blur points,
+// in the colors of src. A nil src draws no shadow.
+func (c *Context) SetShadow(dx, dy, blur float64, src image.Image) {
+	c.shadowX, c.shadowY, c.shadowBlur, c.shadowSrc = dx, dy, blur, src
+	c.recalc()
+}
+
+// SetEmbolden makes glyphs bolder by moving their contours out by half of
+// strength, a fraction of an em such as truetype.EmboldenStrength, which
+// is useful for fonts with no bold style. Zero, the default, leaves them
+// as they are.
+func (c *Context) SetEmbolden(strength float64) {
+	c.embolden = strength
+	c.recalc()
+}
+
+// SetOblique slants glyphs to the right by slant, the ratio of how far the
+// top of a glyph moves to its height, such as truetype.ObliqueSlant. It is
+// useful for fonts with no italic style. Zero, the default, leaves them
+// upright.
+func (c *Context) SetOblique(slant float64) {
+	c.slant = slant
+	c.recalc()
+}
+
+// emboldenStrength returns the strength of synthetic bold in 26.6 fixed
+// point units.
+func (c *Context) emboldenStrength() int32 {
+	return int32(c.embolden * float64(c.scale))
+}
+
+// layers returns the layers to draw, in order.
+func (c *Context) layers() []layer {
+	ls := make([]layer, 0, nLayers)
+	if c.shadowSrc != nil {
+		ls = append(ls, shadowLayer)
+	}
+	if c.outlineSrc != nil {
+		ls = append(ls, outlineLayer)
+	}
+	return append(ls, fillLayer)
+}
+
+// layerSrc returns the source image of the layer l.
+func (c *Context) layerSrc(l layer) image.Image {
+	switch l {
+	case shadowLayer:
+		return c.shadowSrc
+	case outlineLayer:
+		return c.outlineSrc
+	}
+	return c.src
+}
+
+// outlinePixels returns the width of the outline in fixed point pixels, or
+// zero if there is none.
+func (c *Context) outlinePixels() raster.Fix32 {
+	if c.outlineSrc == nil {
+		return 0
+	}
+	return c.PointToFix32(c.outlineWidth)
+}
+
+// blurRadius returns the radius in whole pixels of each of the three box
+// blurs which make up the blur of the shadow.
+func (c *Context) blurRadius() int {
+	if c.shadowSrc == nil || c.shadowBlur <= 0 {
+		return 0
+	}
+	return (int(c.PointToFix32(c.shadowBlur)) + 3*256 - 1) / (3 * 256)
+}
+
+// shadowOffset returns how far the shadow is moved.
+func (c *Context) shadowOffset() raster.Point {
+	return raster.Point{X: c.PointToFix32(c.shadowX), Y: c.PointToFix32(c.shadowY)}
+}
+
+// pad returns how many pixels the mask of the layer l reaches beyond the
+// glyph on each side.
+func (c *Context) pad(l layer) int {
+	n := 0
+	if l == outlineLayer || l == shadowLayer {
+		n += int(c.outlinePixels()+0xff) >> 8
+	}
+	if l == shadowLayer {
+		n += 3 * c.blurRadius()
+	}
+	return n
+}
+
+// inkBounds grows the bounding box min, max of glyphs to take in their
+// outline and shadow.
+func (c *Context) inkBounds(min, max raster.Point) (raster.Point, raster.Point) {
+	w := c.outlinePixels()
+	min, max = min.Sub(raster.Point{X: w, Y: w}), max.Add(raster.Point{X: w, Y: w})
+	if c.shadowSrc == nil {
+		return min, max
+	}
+	b := raster.Fix32(3*c.blurRadius()) << 8
+	d := c.shadowOffset()
+	smin := min.Add(d).Sub(raster.Point{X: b, Y: b})
+	smax := max.Add(d).Add(raster.Point{X: b, Y: b})
+	if smin.X < min.X {
+		min.X = smin.X
+	}
+	if smin.Y < min.Y {
+		min.Y = smin.Y
+	}
+	if smax.X > max.X {
+		max.X = smax.X
+	}
+	if smax.Y > max.Y {
+		max.Y = smax.Y
+	}
+	return min, max
+}
+
+// blur returns a blurred copy of a, which is larger by 3*r pixels on each
+// side. Three box blurs of radius r come close to a Gaussian blur.
+func blur(a *image.Alpha, r int) *image.Alpha {
+	if r <= 0 {
+		return a
+	}
+	b := a.Bounds()
+	w, h := b.Dx()+6*r, b.Dy()+6*r
+	dst := image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		copy(dst.Pix[(y+3*r)*dst.Stride+3*r:], a.Pix[y*a.Stride:y*a.Stride+b.Dx()])
+	}
+	line := make([]uint8, max(w, h))
+	tmp := make([]uint8, len(line))
+	for pass := 0; pass < 3; pass++ {
+		for y := 0; y < h; y++ {
+			row := dst.Pix[y*dst.Stride : y*dst.Stride+w]
+			boxBlur(row, tmp[:w], r)
+		}
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				line[y] = dst.Pix[y*dst.Stride+x]
+			}
+			boxBlur(line[:h], tmp[:h], r)
+			for y := 0; y < h; y++ {
+				dst.Pix[y*dst.Stride+x] = line[y]
+			}
+		}
+	}
+	return dst
+}
+
+// boxBlur replaces each value of p by the mean of the values within r of
+// it, using tmp, which is as long as p, as scratch space.
+func boxBlur(p, tmp []uint8, r int) {
+	copy(tmp, p)
+	n, sum := 2*r+1, 0
+	for i := 0; i < r && i < len(p); i++ {
+		sum += int(tmp[i])
+	}
+	for i := range p {
+		if j := i + r; j < len(p) {
+			sum += int(tmp[j])
+		}
+		if j := i - r - 1; j >= 0 {
+			sum -= int(tmp[j])
+		}
+		p[i] = uint8((sum + n/2) / n)
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
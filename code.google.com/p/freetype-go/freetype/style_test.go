@@ -0,0 +1,137 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package freetype
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"testing"
+)
+
+var red = image.NewUniform(color.RGBA{0xff, 0, 0, 0xff})
+
+// drawTest draws "A" in black at 48 points on a white 200 by 200 image,
+// after calling style on the Context.
+func drawTest(t *testing.T, style func(c *Context)) *image.RGBA {
+	b, err := ioutil.ReadFile("../../draw2d/resource/font/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := ParseFont(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+	c := NewContext()
+	c.SetDPI(72)
+	c.SetFont(font)
+	c.SetFontSize(48)
+	c.SetDst(dst)
+	c.SetClip(dst.Bounds())
+	c.SetSrc(image.Black)
+	style(c)
+	if _, err := c.DrawString("A", Pt(20, 60)); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// bounds returns the bounds of the pixels of img for which f is true.
+func bounds(img *image.RGBA, f func(p color.RGBA) bool) image.Rectangle {
+	var r image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if f(img.RGBAAt(x, y)) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// gray and reddish tell the pixels drawn in black from those drawn in red,
+// on white.
+func gray(p color.RGBA) bool    { return p.R == p.G && p.G != 0xff }
+func reddish(p color.RGBA) bool { return p.R > p.G }
+
+func TestBlurZero(t *testing.T) {
+	a := image.NewAlpha(image.Rect(0, 0, 3, 3))
+	a.SetAlpha(1, 1, color.Alpha{0xff})
+	if b := blur(a, 0); b != a {
+		t.Error("blur of radius 0 is not the mask itself")
+	}
+
+	// A blur of radius 1 spreads the pixel over 3 more pixels on each
+	// side, evenly, and keeps about as much ink.
+	b := blur(a, 1)
+	if b.Bounds() != image.Rect(0, 0, 9, 9) {
+		t.Fatalf("got bounds %v", b.Bounds())
+	}
+	sum := 0
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			v := b.AlphaAt(x, y).A
+			if v != b.AlphaAt(8-x, y).A || v != b.AlphaAt(x, 8-y).A {
+				t.Fatalf("blur is not symmetric at %d, %d", x, y)
+			}
+			sum += int(v)
+		}
+	}
+	if sum < 0xff-20 || sum > 0xff+20 {
+		t.Errorf("got %d in all, want about %d", sum, 0xff)
+	}
+	if b.AlphaAt(4, 4).A <= b.AlphaAt(3, 4).A || b.AlphaAt(3, 4).A <= b.AlphaAt(1, 4).A {
+		t.Error("blur does not fall off from the center")
+	}
+}
+
+func TestOutlineZero(t *testing.T) {
+	plain := drawTest(t, func(c *Context) {})
+	zero := drawTest(t, func(c *Context) {
+		c.SetOutline(0, red)
+		if c.outlineSrc != nil || c.outlinePixels() != 0 || len(c.layers()) != 1 {
+			t.Errorf("an outline of width 0 is drawn: %v", c.layers())
+		}
+	})
+	if !bytes.Equal(plain.Pix, zero.Pix) {
+		t.Error("an outline of width 0 changes the glyph")
+	}
+
+	// A real outline goes around the glyph.
+	outlined := drawTest(t, func(c *Context) { c.SetOutline(2, red) })
+	glyph, outline := bounds(plain, gray), bounds(outlined, reddish)
+	if outline.Empty() || !glyph.In(outline) || outline.Dx() > glyph.Dx()+6 || outline.Dy() > glyph.Dy()+6 {
+		t.Errorf("outline %v around glyph %v", outline, glyph)
+	}
+}
+
+func TestShadowOffset(t *testing.T) {
+	plain := drawTest(t, func(c *Context) {})
+	// The shadow is farther away than the glyph is big.
+	shadowed := drawTest(t, func(c *Context) { c.SetShadow(100, 80, 0, red) })
+	glyph, shadow := bounds(plain, gray), bounds(shadowed, reddish)
+	if want := glyph.Add(image.Pt(100, 80)); shadow != want {
+		t.Errorf("got shadow %v, want %v", shadow, want)
+	}
+	if glyph.Overlaps(shadow) {
+		t.Errorf("shadow %v overlaps glyph %v", shadow, glyph)
+	}
+	// The glyph itself stays where it was.
+	if got := bounds(shadowed, gray); got != glyph {
+		t.Errorf("got glyph %v, want %v", got, glyph)
+	}
+
+	// A shadow off the image is clipped.
+	off := drawTest(t, func(c *Context) { c.SetShadow(300, -300, 2, red) })
+	if r := bounds(off, reddish); !r.Empty() {
+		t.Errorf("got shadow %v off the image", r)
+	}
+}
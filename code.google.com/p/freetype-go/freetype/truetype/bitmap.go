@@ -0,0 +1,331 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// A Bitmap is a glyph's embedded color image, such as an emoji, from the
+// CBDT or sbix table. All measurements are in pixels at PPEM pixels per
+// em; the image must be scaled by the ratio of the wanted size to PPEM.
+type Bitmap struct {
+	Image image.Image
+	PPEM  int
+	// BearingX is from the pen position to the left edge of the image, and
+	// BearingY is from the baseline up to the top edge of the image.
+	BearingX, BearingY int
+	// Advance is the glyph's advance width.
+	Advance int
+}
+
+// bitmapStrike is a set of glyph images for one size.
+type bitmapStrike struct {
+	ppem int
+	// offset is the start of the strike in the CBLC or sbix table.
+	offset int
+	// first and last are the range of glyph indexes in the strike.
+	first, last Index
+}
+
+func (f *Font) parseCblc() error {
+	if len(f.cblc) == 0 {
+		return nil
+	}
+	if len(f.cblc) < 8 {
+		return FormatError("CBLC data too short")
+	}
+	n := int(u32(f.cblc, 4))
+	if 8+48*n > len(f.cblc) {
+		return FormatError(fmt.Sprintf("bad CBLC numSizes: %d", n))
+	}
+	for i := 0; i < n; i++ {
+		x := 8 + 48*i
+		f.cbdtStrikes = append(f.cbdtStrikes, bitmapStrike{
+			ppem:   int(f.cblc[x+44]),
+			offset: x,
+			first:  Index(u16(f.cblc, x+40)),
+			last:   Index(u16(f.cblc, x+42)),
+		})
+	}
+	return nil
+}
+
+func (f *Font) parseSbix() error {
+	if len(f.sbix) == 0 {
+		return nil
+	}
+	if len(f.sbix) < 8 {
+		return FormatError("sbix data too short")
+	}
+	n := int(u32(f.sbix, 4))
+	if 8+4*n > len(f.sbix) {
+		return FormatError(fmt.Sprintf("bad sbix numStrikes: %d", n))
+	}
+	for i := 0; i < n; i++ {
+		x := int(u32(f.sbix, 8+4*i))
+		if x < 0 || x+4+4*(f.nGlyph+1) > len(f.sbix) {
+			return FormatError(fmt.Sprintf("bad sbix strike offset: %d", x))
+		}
+		f.sbixStrikes = append(f.sbixStrikes, bitmapStrike{
+			ppem:   int(u16(f.sbix, x)),
+			offset: x,
+			last:   Index(f.nGlyph - 1),
+		})
+	}
+	return nil
+}
+
+// HasBitmaps returns whether the font has embedded color bitmaps.
+func (f *Font) HasBitmaps() bool {
+	return len(f.cbdtStrikes) > 0 || len(f.sbixStrikes) > 0
+}
+
+// pickStrike returns the strike with glyph i which is the smallest of
+// those at least ppem pixels per em, or the biggest if there are none.
+func pickStrike(strikes []bitmapStrike, i Index, ppem int) (bitmapStrike, bool) {
+	var best bitmapStrike
+	found := false
+	for _, s := range strikes {
+		if i < s.first || s.last < i {
+			continue
+		}
+		switch {
+		case !found:
+		case best.ppem < ppem && best.ppem < s.ppem:
+		case ppem <= s.ppem && s.ppem < best.ppem:
+		default:
+			continue
+		}
+		best, found = s, true
+	}
+	return best, found
+}
+
+// Bitmap returns the color bitmap of the glyph with the given index from
+// the strike best for drawing at ppem pixels per em, or nil if there is
+// none.
+func (f *Font) Bitmap(i Index, ppem int) (*Bitmap, error) {
+	if s, ok := pickStrike(f.cbdtStrikes, i, ppem); ok {
+		b, err := f.cbdtBitmap(s, i)
+		if b != nil || err != nil {
+			return b, err
+		}
+	}
+	if s, ok := pickStrike(f.sbixStrikes, i, ppem); ok {
+		return f.sbixBitmap(s, i, 0)
+	}
+	return nil, nil
+}
+
+// cbdtBitmap looks glyph i up in the index subtables of the strike, and
+// decodes its image from the CBDT table.
+func (f *Font) cbdtBitmap(s bitmapStrike, i Index) (*Bitmap, error) {
+	arrayOffset := int(u32(f.cblc, s.offset))
+	nSubtables := int(u32(f.cblc, s.offset+8))
+	if arrayOffset+8*nSubtables > len(f.cblc) {
+		return nil, FormatError("bad CBLC indexSubTableArray")
+	}
+	for j := 0; j < nSubtables; j++ {
+		x := arrayOffset + 8*j
+		first, last := Index(u16(f.cblc, x)), Index(u16(f.cblc, x+2))
+		if i < first || last < i {
+			continue
+		}
+		h := arrayOffset + int(u32(f.cblc, x+4))
+		if h+8 > len(f.cblc) {
+			return nil, FormatError("bad CBLC indexSubTable offset")
+		}
+		indexFormat := u16(f.cblc, h)
+		imageFormat := u16(f.cblc, h+2)
+		imageOffset := int(u32(f.cblc, h+4))
+		k := int(i - first)
+		var start, end int
+		// metrics are the big glyph metrics of the subtable, which
+		// image format 19 uses.
+		var metrics []byte
+		switch indexFormat {
+		case 1:
+			if h+8+4*(k+2) > len(f.cblc) {
+				return nil, FormatError("CBLC indexSubTable too short")
+			}
+			start = imageOffset + int(u32(f.cblc, h+8+4*k))
+			end = imageOffset + int(u32(f.cblc, h+8+4*(k+1)))
+		case 2:
+			if h+20 > len(f.cblc) {
+				return nil, FormatError("CBLC indexSubTable too short")
+			}
+			size := int(u32(f.cblc, h+8))
+			metrics = f.cblc[h+12 : h+20]
+			start = imageOffset + size*k
+			end = start + size
+		case 3:
+			if h+8+2*(k+2) > len(f.cblc) {
+				return nil, FormatError("CBLC indexSubTable too short")
+			}
+			start = imageOffset + int(u16(f.cblc, h+8+2*k))
+			end = imageOffset + int(u16(f.cblc, h+8+2*(k+1)))
+		case 4, 5:
+			// The glyphs are sparse, and listed with their offsets or in
+			// the order of their images.
+			p := h + 8
+			var size int
+			if indexFormat == 5 {
+				if h+24 > len(f.cblc) {
+					return nil, FormatError("CBLC indexSubTable too short")
+				}
+				size = int(u32(f.cblc, h+8))
+				metrics = f.cblc[h+12 : h+20]
+				p = h + 20
+			}
+			if p+4 > len(f.cblc) {
+				return nil, FormatError("CBLC indexSubTable too short")
+			}
+			n := int(u32(f.cblc, p))
+			p += 4
+			found := false
+			if indexFormat == 4 {
+				if p+4*(n+1) > len(f.cblc) {
+					return nil, FormatError("CBLC indexSubTable too short")
+				}
+				for m := 0; m < n; m++ {
+					if Index(u16(f.cblc, p+4*m)) == i {
+						start = imageOffset + int(u16(f.cblc, p+4*m+2))
+						end = imageOffset + int(u16(f.cblc, p+4*m+6))
+						found = true
+						break
+					}
+				}
+			} else {
+				if p+2*n > len(f.cblc) {
+					return nil, FormatError("CBLC indexSubTable too short")
+				}
+				for m := 0; m < n; m++ {
+					if Index(u16(f.cblc, p+2*m)) == i {
+						start = imageOffset + size*m
+						end = start + size
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return nil, nil
+			}
+		default:
+			return nil, UnsupportedError(fmt.Sprintf("CBLC indexFormat: %d", indexFormat))
+		}
+		if start == end {
+			// The glyph has no image.
+			return nil, nil
+		}
+		if start < 0 || start > end || end > len(f.cbdt) {
+			return nil, FormatError("bad CBDT glyph offset")
+		}
+		return f.cbdtImage(f.cbdt[start:end], imageFormat, metrics, s.ppem)
+	}
+	return nil, nil
+}
+
+// cbdtImage decodes glyph data of the given CBDT image format.
+func (f *Font) cbdtImage(data []byte, format uint16, metrics []byte, ppem int) (*Bitmap, error) {
+	b := &Bitmap{PPEM: ppem}
+	switch format {
+	case 17:
+		// Small glyph metrics: height, width, bearingX, bearingY, advance.
+		if len(data) < 9 {
+			return nil, FormatError("CBDT glyph data too short")
+		}
+		b.BearingX = int(int8(data[2]))
+		b.BearingY = int(int8(data[3]))
+		b.Advance = int(data[4])
+		data = data[5:]
+	case 18:
+		if len(data) < 12 {
+			return nil, FormatError("CBDT glyph data too short")
+		}
+		metrics, data = data[:8], data[8:]
+		fallthrough
+	case 19:
+		if metrics == nil || len(data) < 4 {
+			return nil, FormatError("CBDT glyph data too short")
+		}
+		// Big glyph metrics: height, width, then the horizontal bearings
+		// and advance.
+		b.BearingX = int(int8(metrics[2]))
+		b.BearingY = int(int8(metrics[3]))
+		b.Advance = int(metrics[4])
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("CBDT image format: %d", format))
+	}
+	n := int(u32(data, 0))
+	if n > len(data)-4 {
+		return nil, FormatError("CBDT image data too short")
+	}
+	img, err := png.Decode(bytes.NewReader(data[4 : 4+n]))
+	if err != nil {
+		return nil, err
+	}
+	b.Image = img
+	return b, nil
+}
+
+// sbixBitmap decodes glyph i from the strike. dupe counts references to
+// other glyphs, which are followed only once.
+func (f *Font) sbixBitmap(s bitmapStrike, i Index, dupe int) (*Bitmap, error) {
+	x := s.offset + 4 + 4*int(i)
+	start := s.offset + int(u32(f.sbix, x))
+	end := s.offset + int(u32(f.sbix, x+4))
+	if start == end {
+		// The glyph has no image.
+		return nil, nil
+	}
+	if start+8 > end || end > len(f.sbix) {
+		return nil, FormatError("bad sbix glyph offset")
+	}
+	data := f.sbix[start:end]
+	b := &Bitmap{
+		PPEM: s.ppem,
+		// The advance is not in the table, so take it from hmtx.
+		Advance: int(f.scale(int32(s.ppem) * f.unscaledHMetric(i).AdvanceWidth)),
+	}
+	ox, oy := int(int16(u16(data, 0))), int(int16(u16(data, 2)))
+	var decode func(b []byte) (image.Image, error)
+	switch tag := string(data[4:8]); tag {
+	case "png ":
+		decode = func(b []byte) (image.Image, error) {
+			return png.Decode(bytes.NewReader(b))
+		}
+	case "jpg ":
+		decode = func(b []byte) (image.Image, error) {
+			return jpeg.Decode(bytes.NewReader(b))
+		}
+	case "dupe":
+		if dupe > 0 || len(data) < 10 {
+			return nil, FormatError("bad sbix dupe")
+		}
+		j := Index(u16(data, 8))
+		if int(j) >= f.nGlyph {
+			return nil, FormatError("bad sbix dupe")
+		}
+		return f.sbixBitmap(s, j, dupe+1)
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("sbix graphic type: %q", tag))
+	}
+	img, err := decode(data[8:])
+	if err != nil {
+		return nil, err
+	}
+	// The origin offsets are of the bottom left corner of the image.
+	b.Image = img
+	b.BearingX = ox
+	b.BearingY = oy + img.Bounds().Dy()
+	return b, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func be16(v int) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func be32(v int) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// testPNG returns a w by h PNG.
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.NRGBA{0xff, 0, 0, 0xff})
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// testCBLC returns CBLC and CBDT tables with one strike at 109 pixels per
+// em, of glyphs 1 and 2, of which only glyph 1 has an image, a 3 by 2 PNG
+// with small metrics.
+func testCBLC(t *testing.T) (cblc, cbdt []byte) {
+	img := testPNG(t, 3, 2)
+	// height, width, bearingX, bearingY, advance.
+	glyph := cat([]byte{2, 3, 1, 2, 4}, be32(len(img)), img)
+	cbdt = cat(be32(0x00030000), glyph)
+
+	const arrayOffset = 8 + 48
+	size := cat(be32(arrayOffset), be32(8+8+12), be32(1), be32(0),
+		make([]byte, 24), be16(1), be16(2), []byte{109, 109, 32, 1})
+	// The array has one subtable, right after it.
+	array := cat(be16(1), be16(2), be32(8))
+	subtable := cat(be16(1), be16(17), be32(4), be32(0), be32(len(glyph)), be32(len(glyph)))
+	cblc = cat(be32(0x00030000), be32(1), size, array, subtable)
+	return cblc, cbdt
+}
+
+// testSbix returns an sbix table for 3 glyphs with one strike at 64 pixels
+// per em, in which glyph 1 is a 2 by 2 PNG and glyph 2 a dupe of it.
+func testSbix(t *testing.T) []byte {
+	img := testPNG(t, 2, 2)
+	glyph1 := cat(be16(1), be16(0xffff), []byte("png "), img)
+	glyph2 := cat(be16(0), be16(0), []byte("dupe"), be16(1))
+	const header = 4 + 4*4
+	strike := cat(be16(64), be16(72),
+		be32(header), be32(header), be32(header+len(glyph1)), be32(header+len(glyph1)+len(glyph2)),
+		glyph1, glyph2)
+	return cat(be16(1), be16(1), be32(1), be32(12), strike)
+}
+
+// testBitmapFont returns a font of 3 glyphs, each 1000 units wide in an em
+// of 2000, with the given bitmap tables.
+func testBitmapFont(cblc, cbdt, sbix []byte) *Font {
+	return &Font{
+		nGlyph: 3, nHMetric: 1, fUnitsPerEm: 2000,
+		hmtx: cat(be16(1000), be16(0), be16(0), be16(0)),
+		cblc: cblc, cbdt: cbdt, sbix: sbix,
+	}
+}
+
+func TestCBDT(t *testing.T) {
+	cblc, cbdt := testCBLC(t)
+	f := testBitmapFont(cblc, cbdt, nil)
+	if err := f.parseCblc(); err != nil {
+		t.Fatal(err)
+	}
+	if !f.HasBitmaps() {
+		t.Fatal("HasBitmaps: got false")
+	}
+	for _, ppem := range []int{10, 109, 300} {
+		b, err := f.Bitmap(1, ppem)
+		if err != nil {
+			t.Fatalf("ppem %d: %v", ppem, err)
+		}
+		if b == nil {
+			t.Fatalf("ppem %d: got no bitmap", ppem)
+		}
+		if b.PPEM != 109 || b.BearingX != 1 || b.BearingY != 2 || b.Advance != 4 || b.Image.Bounds() != image.Rect(0, 0, 3, 2) {
+			t.Errorf("ppem %d: got %+v", ppem, b)
+		}
+	}
+	for _, i := range []Index{0, 2} {
+		if b, err := f.Bitmap(i, 109); b != nil || err != nil {
+			t.Errorf("glyph %d: got %v, %v, want none", i, b, err)
+		}
+	}
+}
+
+func TestSbix(t *testing.T) {
+	f := testBitmapFont(nil, nil, testSbix(t))
+	if err := f.parseSbix(); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []Index{1, 2} {
+		b, err := f.Bitmap(i, 20)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		// The origin is 1 right and 1 below the baseline, and the advance
+		// is half an em.
+		if b == nil || b.PPEM != 64 || b.BearingX != 1 || b.BearingY != 1 || b.Advance != 32 || b.Image.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Errorf("glyph %d: got %+v", i, b)
+		}
+	}
+	if b, err := f.Bitmap(0, 20); b != nil || err != nil {
+		t.Errorf("glyph 0: got %v, %v, want none", b, err)
+	}
+}
+
+func TestPickStrike(t *testing.T) {
+	strikes := []bitmapStrike{
+		{ppem: 64, first: 0, last: 9},
+		{ppem: 20, first: 0, last: 9},
+		{ppem: 128, first: 0, last: 4},
+	}
+	tests := []struct {
+		i          Index
+		ppem, want int
+	}{
+		{1, 10, 20},
+		{1, 20, 20},
+		{1, 21, 64},
+		{1, 64, 64},
+		{1, 100, 128},
+		{1, 200, 128},
+		// Glyph 5 is not in the biggest strike.
+		{5, 100, 64},
+		{5, 200, 64},
+	}
+	for _, tt := range tests {
+		s, ok := pickStrike(strikes, tt.i, tt.ppem)
+		if !ok || s.ppem != tt.want {
+			t.Errorf("glyph %d at %d: got %d, %v, want %d", tt.i, tt.ppem, s.ppem, ok, tt.want)
+		}
+	}
+	if _, ok := pickStrike(strikes, 10, 20); ok {
+		t.Error("glyph 10: got a strike")
+	}
+}
+
+// TestBitmapTruncated checks that every truncation of the bitmap tables
+// is an error, or gives no bitmap, and does not panic.
+func TestBitmapTruncated(t *testing.T) {
+	cblc, cbdt := testCBLC(t)
+	sbix := testSbix(t)
+	for n := 0; n < len(cblc); n++ {
+		f := testBitmapFont(cblc[:n], cbdt, nil)
+		if err := f.parseCblc(); err == nil {
+			f.Bitmap(1, 109)
+		}
+	}
+	for n := 0; n < len(sbix); n++ {
+		f := testBitmapFont(nil, nil, sbix[:n])
+		if err := f.parseSbix(); err == nil {
+			f.Bitmap(1, 64)
+			f.Bitmap(2, 64)
+		}
+	}
+
+	// A CBDT table cut in the image of glyph 1.
+	f := testBitmapFont(cblc, cbdt[:len(cbdt)-10], nil)
+	if err := f.parseCblc(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Bitmap(1, 109); err == nil {
+		t.Error("truncated CBDT: got no error")
+	}
+	// A CBLC table cut in the index subtable.
+	f = testBitmapFont(cblc[:len(cblc)-6], cbdt, nil)
+	if err := f.parseCblc(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Bitmap(1, 109); err == nil {
+		t.Error("truncated CBLC: got no error")
+	}
+	// A CBLC table cut in its sizes.
+	f = testBitmapFont(cblc[:40], cbdt, nil)
+	if err := f.parseCblc(); err == nil {
+		t.Error("truncated CBLC sizes: got no error")
+	}
+	// An sbix table cut in the image of glyph 1, whose dupe glyph 2 fails
+	// too.
+	f = testBitmapFont(nil, nil, sbix[:len(sbix)-20])
+	if err := f.parseSbix(); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []Index{1, 2} {
+		if _, err := f.Bitmap(i, 64); err == nil {
+			t.Errorf("truncated sbix: glyph %d: got no error", i)
+		}
+	}
+}
@@ -0,0 +1,767 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// This file reads the PostScript outlines of OpenType fonts from the CFF
+// table. Those formats are documented at
+// http://partners.adobe.com/public/developer/en/font/5176.CFF.pdf and
+// http://partners.adobe.com/public/developer/en/font/5177.Type2.pdf
+
+// A cffPrivate holds the values from a Private DICT which are needed to
+// interpret charstrings.
+type cffPrivate struct {
+	subrs [][]byte
+}
+
+// A cff holds the parsed CFF table.
+type cff struct {
+	charStrings [][]byte
+	gsubrs      [][]byte
+	// privates is one Private DICT for a name-keyed font, or one for each
+	// Font DICT of a CID-keyed font.
+	privates []cffPrivate
+	// fdSelect is the index into privates of each glyph of a CID-keyed font.
+	fdSelect []uint8
+}
+
+// cffIndex parses the INDEX at b[offset:], and returns its objects and
+// the offset of the byte after it.
+func cffIndex(b []byte, offset int) ([][]byte, int, error) {
+	if offset < 0 || offset+2 > len(b) {
+		return nil, 0, FormatError("CFF INDEX out of range")
+	}
+	n := int(u16(b, offset))
+	if n == 0 {
+		return nil, offset + 2, nil
+	}
+	if offset+3 > len(b) {
+		return nil, 0, FormatError("CFF INDEX too short")
+	}
+	offSize := int(b[offset+2])
+	if offSize < 1 || offSize > 4 {
+		return nil, 0, FormatError(fmt.Sprintf("bad CFF INDEX offSize: %d", offSize))
+	}
+	x := offset + 3
+	// The offsets are 1-based from the byte before the data.
+	base := x + (n+1)*offSize - 1
+	if base >= len(b) {
+		return nil, 0, FormatError("CFF INDEX too short")
+	}
+	readOffset := func(i int) int {
+		v := 0
+		for _, c := range b[x+i*offSize : x+(i+1)*offSize] {
+			v = v<<8 | int(c)
+		}
+		return base + v
+	}
+	objects := make([][]byte, n)
+	start := readOffset(0)
+	for i := range objects {
+		end := readOffset(i + 1)
+		if end < start || end > len(b) {
+			return nil, 0, FormatError("bad CFF INDEX offset")
+		}
+		objects[i] = b[start:end]
+		start = end
+	}
+	return objects, start, nil
+}
+
+// Operators of Top and Private DICTs. Two byte operators are 1200 plus the
+// second byte.
+const (
+	cffOpCharStrings    = 17
+	cffOpPrivate        = 18
+	cffOpSubrs          = 19
+	cffOpCharstringType = 1206
+	cffOpROS            = 1230
+	cffOpFDArray        = 1236
+	cffOpFDSelect       = 1237
+)
+
+// cffDict parses a DICT into its operands keyed by operator.
+func cffDict(b []byte) (map[int][]float64, error) {
+	d := make(map[int][]float64)
+	var operands []float64
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c <= 21:
+			op := int(c)
+			i++
+			if c == 12 {
+				if i >= len(b) {
+					return nil, FormatError("CFF DICT too short")
+				}
+				op, i = 1200+int(b[i]), i+1
+			}
+			d[op], operands = operands, nil
+			continue
+		case c == 28:
+			if i+3 > len(b) {
+				return nil, FormatError("CFF DICT too short")
+			}
+			operands = append(operands, float64(int16(u16(b, i+1))))
+			i += 3
+		case c == 29:
+			if i+5 > len(b) {
+				return nil, FormatError("CFF DICT too short")
+			}
+			operands = append(operands, float64(int32(u32(b, i+1))))
+			i += 5
+		case c == 30:
+			v, n, err := cffReal(b[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, v)
+			i += 1 + n
+		case 32 <= c && c <= 246:
+			operands = append(operands, float64(int(c)-139))
+			i++
+		case 247 <= c && c <= 254:
+			if i+2 > len(b) {
+				return nil, FormatError("CFF DICT too short")
+			}
+			v := (int(c)-247)&3*256 + int(b[i+1]) + 108
+			if c >= 251 {
+				v = -v
+			}
+			operands = append(operands, float64(v))
+			i += 2
+		default:
+			return nil, FormatError(fmt.Sprintf("bad CFF DICT byte: %d", c))
+		}
+	}
+	return d, nil
+}
+
+// cffReal parses a real number operand, which is packed BCD, and returns
+// it and the number of bytes it takes.
+func cffReal(b []byte) (float64, int, error) {
+	s := ""
+	for i, c := range b {
+		for _, nibble := range []byte{c >> 4, c & 0x0f} {
+			switch {
+			case nibble <= 9:
+				s += string('0' + nibble)
+			case nibble == 0xa:
+				s += "."
+			case nibble == 0xb:
+				s += "e"
+			case nibble == 0xc:
+				s += "e-"
+			case nibble == 0xe:
+				s += "-"
+			case nibble == 0xf:
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return 0, 0, FormatError("bad CFF real number")
+				}
+				return v, i + 1, nil
+			}
+		}
+	}
+	return 0, 0, FormatError("CFF real number too long")
+}
+
+// dictOffset returns the i'th operand of op as an offset, or -1.
+func dictOffset(d map[int][]float64, op, i int) int {
+	if len(d[op]) <= i {
+		return -1
+	}
+	return int(d[op][i])
+}
+
+func parseCFF(b []byte, nGlyph int) (*cff, error) {
+	if len(b) < 4 || b[0] != 1 {
+		return nil, UnsupportedError("CFF version")
+	}
+	// Skip the header and the Name INDEX.
+	_, offset, err := cffIndex(b, int(b[2]))
+	if err != nil {
+		return nil, err
+	}
+	topDicts, offset, err := cffIndex(b, offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) != 1 {
+		return nil, UnsupportedError("CFF with more than one font")
+	}
+	// Skip the String INDEX.
+	_, offset, err = cffIndex(b, offset)
+	if err != nil {
+		return nil, err
+	}
+	c := new(cff)
+	if c.gsubrs, _, err = cffIndex(b, offset); err != nil {
+		return nil, err
+	}
+	top, err := cffDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := top[cffOpCharstringType]; ok && (len(t) != 1 || t[0] != 2) {
+		return nil, UnsupportedError("CFF charstring type")
+	}
+	if c.charStrings, _, err = cffIndex(b, dictOffset(top, cffOpCharStrings, 0)); err != nil {
+		return nil, err
+	}
+	if len(c.charStrings) < nGlyph {
+		return nil, FormatError("CFF has too few charstrings")
+	}
+	if _, ok := top[cffOpROS]; !ok {
+		p, err := cffParsePrivate(b, top)
+		if err != nil {
+			return nil, err
+		}
+		c.privates = []cffPrivate{p}
+		return c, nil
+	}
+	// A CID-keyed font has a Font DICT, each with a Private DICT, for each
+	// group of glyphs.
+	fds, _, err := cffIndex(b, dictOffset(top, cffOpFDArray, 0))
+	if err != nil {
+		return nil, err
+	}
+	if len(fds) == 0 {
+		return nil, FormatError("CFF has no Font DICT")
+	}
+	for _, fd := range fds {
+		d, err := cffDict(fd)
+		if err != nil {
+			return nil, err
+		}
+		p, err := cffParsePrivate(b, d)
+		if err != nil {
+			return nil, err
+		}
+		c.privates = append(c.privates, p)
+	}
+	if c.fdSelect, err = cffParseFDSelect(b, dictOffset(top, cffOpFDSelect, 0), nGlyph); err != nil {
+		return nil, err
+	}
+	for _, fd := range c.fdSelect {
+		if int(fd) >= len(c.privates) {
+			return nil, FormatError("bad CFF FDSelect")
+		}
+	}
+	return c, nil
+}
+
+// cffParsePrivate reads the Private DICT which d points to.
+func cffParsePrivate(b []byte, d map[int][]float64) (cffPrivate, error) {
+	var p cffPrivate
+	size, offset := dictOffset(d, cffOpPrivate, 0), dictOffset(d, cffOpPrivate, 1)
+	if size <= 0 {
+		return p, nil
+	}
+	if offset < 0 || offset+size > len(b) {
+		return p, FormatError("bad CFF Private DICT offset")
+	}
+	private, err := cffDict(b[offset : offset+size])
+	if err != nil {
+		return p, err
+	}
+	// The Subrs offset is relative to the Private DICT.
+	if subrs := dictOffset(private, cffOpSubrs, 0); subrs >= 0 {
+		if p.subrs, _, err = cffIndex(b, offset+subrs); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func cffParseFDSelect(b []byte, offset, nGlyph int) ([]uint8, error) {
+	if offset < 0 || offset >= len(b) {
+		return nil, FormatError("bad CFF FDSelect offset")
+	}
+	fdSelect := make([]uint8, nGlyph)
+	switch b[offset] {
+	case 0:
+		if offset+1+nGlyph > len(b) {
+			return nil, FormatError("CFF FDSelect too short")
+		}
+		copy(fdSelect, b[offset+1:])
+	case 3:
+		if offset+3 > len(b) {
+			return nil, FormatError("CFF FDSelect too short")
+		}
+		n := int(u16(b, offset+1))
+		x := offset + 3
+		if x+3*n+2 > len(b) {
+			return nil, FormatError("CFF FDSelect too short")
+		}
+		for i := 0; i < n; i++ {
+			first, fd := int(u16(b, x+3*i)), b[x+3*i+2]
+			last := int(u16(b, x+3*i+3))
+			for j := first; j < last && j < nGlyph; j++ {
+				fdSelect[j] = fd
+			}
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("CFF FDSelect format: %d", b[offset]))
+	}
+	return fdSelect, nil
+}
+
+// subrBias is added to subroutine numbers, which are signed so that small
+// numbers encode in fewer bytes.
+func subrBias(subrs [][]byte) int {
+	switch n := len(subrs); {
+	case n < 1240:
+		return 107
+	case n < 33900:
+		return 1131
+	}
+	return 32768
+}
+
+// cffTolerance is how far, in FUnits, the quadratic curves which replace
+// a cubic curve may stray from it.
+const cffTolerance = 0.5
+
+// A cffInterp runs a Type 2 charstring, and turns its path into TrueType
+// contours: cubic curves become one or more quadratic curves.
+type cffInterp struct {
+	c       *cff
+	private *cffPrivate
+	stack   []float64
+	// x and y are the current point.
+	x, y float64
+	// nStems is the number of stem hints, which determines the length of
+	// a hintmask.
+	nStems int
+	// seenWidth is whether the optional width argument has been checked
+	// for; it can only come before the first stack-clearing operator.
+	seenWidth bool
+	// start is the index in points of the first point of the contour.
+	start  int
+	points []Point
+	ends   []int
+	done   bool
+}
+
+// loadCFF appends the contours of glyph i, in FUnits, to points and ends.
+func (f *Font) loadCFF(i Index, points []Point, ends []int) ([]Point, []int, error) {
+	if int(i) >= len(f.cff.charStrings) {
+		return points, ends, FormatError(fmt.Sprintf("bad glyph index: %d", i))
+	}
+	var p *cffPrivate
+	switch {
+	case f.cff.fdSelect != nil:
+		if int(i) >= len(f.cff.fdSelect) {
+			return points, ends, FormatError(fmt.Sprintf("CFF glyph %d has no Font DICT", i))
+		}
+		p = &f.cff.privates[f.cff.fdSelect[i]]
+	case len(f.cff.privates) > 0:
+		p = &f.cff.privates[0]
+	default:
+		return points, ends, FormatError("CFF has no Private DICT")
+	}
+	in := &cffInterp{
+		c:       f.cff,
+		private: p,
+		stack:   make([]float64, 0, 48),
+		start:   len(points),
+		points:  points,
+		ends:    ends,
+	}
+	if err := in.run(f.cff.charStrings[i], 0); err != nil {
+		return points, ends, err
+	}
+	in.closePath()
+	return in.points, in.ends, nil
+}
+
+// width drops the width argument from the bottom of the stack, if there
+// are more arguments than the operator takes; odd is whether the operator
+// takes an odd number of them.
+func (in *cffInterp) width(odd bool) {
+	if in.seenWidth {
+		return
+	}
+	in.seenWidth = true
+	if len(in.stack)%2 == 1 != odd && len(in.stack) > 0 {
+		in.stack = in.stack[1:]
+	}
+}
+
+func (in *cffInterp) point(x, y float64, on bool) {
+	p := Point{X: int32(math.Floor(x + 0.5)), Y: int32(math.Floor(y + 0.5))}
+	if on {
+		p.Flags = flagOnCurve
+	}
+	in.points = append(in.points, p)
+}
+
+func (in *cffInterp) moveTo(dx, dy float64) {
+	in.closePath()
+	in.x += dx
+	in.y += dy
+	in.point(in.x, in.y, true)
+}
+
+func (in *cffInterp) lineTo(dx, dy float64) {
+	in.x += dx
+	in.y += dy
+	in.point(in.x, in.y, true)
+}
+
+// curveTo adds a cubic curve from the current point, with control points
+// relative to the previous one.
+func (in *cffInterp) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	x0, y0 := in.x, in.y
+	x1, y1 := x0+dx1, y0+dy1
+	x2, y2 := x1+dx2, y1+dy2
+	x3, y3 := x2+dx3, y2+dy3
+	in.x, in.y = x3, y3
+	// The distance between a cubic and the quadratic through its ends and
+	// the midpoint of its control points is at most sqrt(3)/36 of this,
+	// and it shrinks with the cube of the number of pieces.
+	d := math.Max(math.Abs(x3-3*x2+3*x1-x0), math.Abs(y3-3*y2+3*y1-y0))
+	n := int(math.Ceil(math.Cbrt(d * math.Sqrt(3) / 36 / cffTolerance)))
+	if n < 1 {
+		n = 1
+	} else if n > 16 {
+		n = 16
+	}
+	at := func(t float64) (x, y, tx, ty float64) {
+		s := 1 - t
+		x = s*s*s*x0 + 3*s*s*t*x1 + 3*s*t*t*x2 + t*t*t*x3
+		y = s*s*s*y0 + 3*s*s*t*y1 + 3*s*t*t*y2 + t*t*t*y3
+		// tx and ty are the derivative.
+		tx = 3 * (s*s*(x1-x0) + 2*s*t*(x2-x1) + t*t*(x3-x2))
+		ty = 3 * (s*s*(y1-y0) + 2*s*t*(y2-y1) + t*t*(y3-y2))
+		return
+	}
+	ax, ay, atx, aty := at(0)
+	for k := 1; k <= n; k++ {
+		bx, by, btx, bty := at(float64(k) / float64(n))
+		// The control points of this piece of the cubic are a+ta/3n and
+		// b-tb/3n. The quadratic's control point is 3/4 of their sum less
+		// 1/4 of the end points.
+		h := 1 / (3 * float64(n))
+		cx := (3*(ax+atx*h+bx-btx*h) - ax - bx) / 4
+		cy := (3*(ay+aty*h+by-bty*h) - ay - by) / 4
+		in.point(cx, cy, false)
+		in.point(bx, by, true)
+		ax, ay, atx, aty = bx, by, btx, bty
+	}
+}
+
+// closePath ends the current contour. A contour is closed implicitly, so
+// a last point on top of the first one is dropped.
+func (in *cffInterp) closePath() {
+	n := len(in.points) - in.start
+	if n > 1 {
+		first, last := in.points[in.start], in.points[len(in.points)-1]
+		if first.X == last.X && first.Y == last.Y && last.Flags&flagOnCurve != 0 {
+			in.points = in.points[:len(in.points)-1]
+			n--
+		}
+	}
+	if n < 2 {
+		// Drop a lone move.
+		in.points = in.points[:in.start]
+	} else {
+		in.ends = append(in.ends, len(in.points))
+	}
+	in.start = len(in.points)
+}
+
+func (in *cffInterp) run(b []byte, depth int) error {
+	// The Type 2 specification limits subroutine nesting to 10.
+	if depth > 10 {
+		return FormatError("CFF subroutines nest too deep")
+	}
+	for i := 0; i < len(b) && !in.done; {
+		c := b[i]
+		i++
+		if c >= 32 || c == 28 {
+			// A number.
+			var v float64
+			switch {
+			case c == 28:
+				if i+2 > len(b) {
+					return FormatError("CFF charstring too short")
+				}
+				v, i = float64(int16(u16(b, i))), i+2
+			case c <= 246:
+				v = float64(int(c) - 139)
+			case c <= 254:
+				if i+1 > len(b) {
+					return FormatError("CFF charstring too short")
+				}
+				w := (int(c)-247)&3*256 + int(b[i]) + 108
+				if c >= 251 {
+					w = -w
+				}
+				v, i = float64(w), i+1
+			default:
+				if i+4 > len(b) {
+					return FormatError("CFF charstring too short")
+				}
+				v, i = float64(int32(u32(b, i)))/65536, i+4
+			}
+			if len(in.stack) >= 48 {
+				return FormatError("CFF charstring stack overflow")
+			}
+			in.stack = append(in.stack, v)
+			continue
+		}
+		s := in.stack
+		n := len(s)
+		switch c {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			in.width(false)
+			in.nStems += len(in.stack) / 2
+		case 19, 20: // hintmask, cntrmask
+			// Arguments are an implied vstem.
+			in.width(false)
+			in.nStems += len(in.stack) / 2
+			i += (in.nStems + 7) / 8
+		case 21: // rmoveto
+			in.width(false)
+			if s = in.stack; len(s) < 2 {
+				return FormatError("CFF rmoveto")
+			}
+			in.moveTo(s[0], s[1])
+		case 22: // hmoveto
+			in.width(true)
+			if s = in.stack; len(s) < 1 {
+				return FormatError("CFF hmoveto")
+			}
+			in.moveTo(s[0], 0)
+		case 4: // vmoveto
+			in.width(true)
+			if s = in.stack; len(s) < 1 {
+				return FormatError("CFF vmoveto")
+			}
+			in.moveTo(0, s[0])
+		case 5: // rlineto
+			for j := 0; j+2 <= n; j += 2 {
+				in.lineTo(s[j], s[j+1])
+			}
+		case 6, 7: // hlineto, vlineto
+			horizontal := c == 6
+			for j := 0; j < n; j++ {
+				if horizontal {
+					in.lineTo(s[j], 0)
+				} else {
+					in.lineTo(0, s[j])
+				}
+				horizontal = !horizontal
+			}
+		case 8: // rrcurveto
+			for j := 0; j+6 <= n; j += 6 {
+				in.curveTo(s[j], s[j+1], s[j+2], s[j+3], s[j+4], s[j+5])
+			}
+		case 24: // rcurveline
+			j := 0
+			for ; j+6 <= n-2; j += 6 {
+				in.curveTo(s[j], s[j+1], s[j+2], s[j+3], s[j+4], s[j+5])
+			}
+			if j+2 <= n {
+				in.lineTo(s[j], s[j+1])
+			}
+		case 25: // rlinecurve
+			j := 0
+			for ; j+2 <= n-6; j += 2 {
+				in.lineTo(s[j], s[j+1])
+			}
+			if j+6 <= n {
+				in.curveTo(s[j], s[j+1], s[j+2], s[j+3], s[j+4], s[j+5])
+			}
+		case 26: // vvcurveto
+			j, dx1 := 0, 0.0
+			if n%2 == 1 {
+				j, dx1 = 1, s[0]
+			}
+			for ; j+4 <= n; j += 4 {
+				in.curveTo(dx1, s[j], s[j+1], s[j+2], 0, s[j+3])
+				dx1 = 0
+			}
+		case 27: // hhcurveto
+			j, dy1 := 0, 0.0
+			if n%2 == 1 {
+				j, dy1 = 1, s[0]
+			}
+			for ; j+4 <= n; j += 4 {
+				in.curveTo(s[j], dy1, s[j+1], s[j+2], s[j+3], 0)
+				dy1 = 0
+			}
+		case 30, 31: // vhcurveto, hvcurveto
+			horizontal := c == 31
+			for j := 0; j+4 <= n; j += 4 {
+				last := 0.0
+				if j+5 == n {
+					last = s[j+4]
+				}
+				if horizontal {
+					in.curveTo(s[j], 0, s[j+1], s[j+2], last, s[j+3])
+				} else {
+					in.curveTo(0, s[j], s[j+1], s[j+2], s[j+3], last)
+				}
+				horizontal = !horizontal
+			}
+		case 10, 29: // callsubr, callgsubr
+			if n < 1 {
+				return FormatError("CFF subroutine call")
+			}
+			subrs := in.private.subrs
+			if c == 29 {
+				subrs = in.c.gsubrs
+			}
+			k := int(s[n-1]) + subrBias(subrs)
+			if k < 0 || k >= len(subrs) {
+				return FormatError(fmt.Sprintf("bad CFF subroutine: %d", k))
+			}
+			in.stack = s[:n-1]
+			if err := in.run(subrs[k], depth+1); err != nil {
+				return err
+			}
+			// Subroutines leave their results on the stack.
+			continue
+		case 11: // return
+			return nil
+		case 14: // endchar
+			in.width(false)
+			if len(in.stack) >= 4 {
+				return UnsupportedError("CFF endchar accent composition")
+			}
+			in.closePath()
+			in.done = true
+		case 12:
+			if i >= len(b) {
+				return FormatError("CFF charstring too short")
+			}
+			c2 := b[i]
+			i++
+			if err := in.escape(c2); err != nil {
+				return err
+			}
+			continue
+		default:
+			return UnsupportedError(fmt.Sprintf("CFF charstring operator: %d", c))
+		}
+		in.stack = in.stack[:0]
+	}
+	return nil
+}
+
+// escape runs the two byte operator 12 c.
+func (in *cffInterp) escape(c byte) error {
+	s := in.stack
+	n := len(s)
+	need := func(k int) error {
+		if n < k {
+			return FormatError(fmt.Sprintf("CFF operator 12 %d needs %d arguments", c, k))
+		}
+		return nil
+	}
+	switch c {
+	case 35: // flex
+		if err := need(13); err != nil {
+			return err
+		}
+		in.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+		in.curveTo(s[6], s[7], s[8], s[9], s[10], s[11])
+	case 34: // hflex
+		if err := need(7); err != nil {
+			return err
+		}
+		in.curveTo(s[0], 0, s[1], s[2], s[3], 0)
+		in.curveTo(s[4], 0, s[5], -s[2], s[6], 0)
+	case 36: // hflex1
+		if err := need(9); err != nil {
+			return err
+		}
+		in.curveTo(s[0], s[1], s[2], s[3], s[4], 0)
+		in.curveTo(s[5], 0, s[6], s[7], s[8], -(s[1] + s[3] + s[7]))
+	case 37: // flex1
+		if err := need(11); err != nil {
+			return err
+		}
+		dx := s[0] + s[2] + s[4] + s[6] + s[8]
+		dy := s[1] + s[3] + s[5] + s[7] + s[9]
+		in.curveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+		if math.Abs(dx) > math.Abs(dy) {
+			in.curveTo(s[6], s[7], s[8], s[9], s[10], -dy)
+		} else {
+			in.curveTo(s[6], s[7], s[8], s[9], -dx, s[10])
+		}
+	// The arithmetic operators leave their result on the stack.
+	case 9: // abs
+		if err := need(1); err != nil {
+			return err
+		}
+		s[n-1] = math.Abs(s[n-1])
+		return nil
+	case 10, 11, 12, 24: // add, sub, div, mul
+		if err := need(2); err != nil {
+			return err
+		}
+		a, b := s[n-2], s[n-1]
+		switch c {
+		case 10:
+			a += b
+		case 11:
+			a -= b
+		case 12:
+			if b == 0 {
+				return FormatError("CFF division by zero")
+			}
+			a /= b
+		case 24:
+			a *= b
+		}
+		s[n-2] = a
+		in.stack = s[:n-1]
+		return nil
+	case 14: // neg
+		if err := need(1); err != nil {
+			return err
+		}
+		s[n-1] = -s[n-1]
+		return nil
+	case 26: // sqrt
+		if err := need(1); err != nil {
+			return err
+		}
+		s[n-1] = math.Sqrt(math.Abs(s[n-1]))
+		return nil
+	case 18: // drop
+		if err := need(1); err != nil {
+			return err
+		}
+		in.stack = s[:n-1]
+		return nil
+	case 27: // dup
+		if err := need(1); err != nil {
+			return err
+		}
+		in.stack = append(s, s[n-1])
+		return nil
+	case 28: // exch
+		if err := need(2); err != nil {
+			return err
+		}
+		s[n-2], s[n-1] = s[n-1], s[n-2]
+		return nil
+	default:
+		return UnsupportedError(fmt.Sprintf("CFF charstring operator: 12 %d", c))
+	}
+	in.stack = in.stack[:0]
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cffInt encodes v as a 5 byte DICT integer, so that offsets can be put in
+// a DICT before they are known.
+func cffInt(v int) []byte {
+	return []byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// cffIndexOf encodes objects as an INDEX with 2 byte offsets.
+func cffIndexOf(objects ...[]byte) []byte {
+	if len(objects) == 0 {
+		return []byte{0, 0}
+	}
+	b := []byte{byte(len(objects) >> 8), byte(len(objects)), 2}
+	off := 1
+	b = append(b, byte(off>>8), byte(off))
+	for _, o := range objects {
+		off += len(o)
+		b = append(b, byte(off>>8), byte(off))
+	}
+	for _, o := range objects {
+		b = append(b, o...)
+	}
+	return b
+}
+
+func cat(bs ...[]byte) []byte {
+	var b []byte
+	for _, x := range bs {
+		b = append(b, x...)
+	}
+	return b
+}
+
+// Charstrings of the test font. Numbers from -107 to 107 are one byte,
+// n+139, and 500 and -500 are 248 136 and 252 136.
+var (
+	// A square from (100, 0) to (600, 500):
+	// 100 0 rmoveto 500 500 -500 hlineto endchar
+	cffSquare = []byte{239, 139, 21, 248, 136, 248, 136, 252, 136, 6, 14}
+	// The same square with its right side in a subroutine:
+	// 100 0 rmoveto 500 0 rlineto -107 callsubr -500 0 rlineto endchar
+	cffSquareSubr = []byte{239, 139, 21, 248, 136, 139, 5, 32, 10, 252, 136, 139, 5, 14}
+	// 0 500 rlineto return
+	cffSubr = []byte{139, 248, 136, 5, 11}
+	// An arch: 0 0 rmoveto 0 100 100 0 0 -100 rrcurveto endchar
+	cffArch = []byte{139, 139, 21, 139, 239, 239, 139, 139, 39, 8, 14}
+)
+
+// testCFF returns a name-keyed CFF table with charStrings and one local
+// subroutine, cffSubr.
+func testCFF(charStrings ...[]byte) []byte {
+	header := []byte{1, 0, 4, 2}
+	names := cffIndexOf([]byte("Test"))
+	// The Top DICT is CharStrings and Private, 17 bytes.
+	const topSize = 5 + 1 + 5 + 5 + 1
+	stringIndex := cffIndexOf()
+	gsubrs := cffIndexOf()
+	csOffset := len(header) + len(names) + len(cffIndexOf(make([]byte, topSize))) + len(stringIndex) + len(gsubrs)
+	cs := cffIndexOf(charStrings...)
+	// The Private DICT is only Subrs, which follow it.
+	private := cat(cffInt(6), []byte{19})
+	privateOffset := csOffset + len(cs)
+	top := cat(cffInt(csOffset), []byte{17}, cffInt(len(private)), cffInt(privateOffset), []byte{18})
+	return cat(header, names, cffIndexOf(top), stringIndex, gsubrs, cs, private, cffIndexOf(cffSubr))
+}
+
+// testCIDCFF returns a CID-keyed CFF table with charStrings, whose first
+// glyph uses the first Font DICT and the others the second. Only the
+// second Private DICT has the local subroutine, cffSubr.
+func testCIDCFF(charStrings ...[]byte) []byte {
+	header := []byte{1, 0, 4, 2}
+	names := cffIndexOf([]byte("Test"))
+	// The Top DICT is ROS, CharStrings, FDArray and FDSelect, 37 bytes.
+	const topSize = 17 + 6 + 7 + 7
+	stringIndex := cffIndexOf([]byte("Adobe"), []byte("Identity"))
+	gsubrs := cffIndexOf()
+	csOffset := len(header) + len(names) + len(cffIndexOf(make([]byte, topSize))) + len(stringIndex) + len(gsubrs)
+	cs := cffIndexOf(charStrings...)
+	private0 := []byte{}
+	private1 := cat(cffInt(6), []byte{19})
+	subrs := cffIndexOf(cffSubr)
+	private1Offset := csOffset + len(cs)
+	private0Offset := private1Offset + len(private1) + len(subrs)
+	// The Font DICTs are only Private, 11 bytes each.
+	fdArrayOffset := private0Offset + len(private0)
+	fdArray := cffIndexOf(
+		cat(cffInt(len(private0)), cffInt(private0Offset), []byte{18}),
+		cat(cffInt(len(private1)), cffInt(private1Offset), []byte{18}),
+	)
+	fdSelectOffset := fdArrayOffset + len(fdArray)
+	n := len(charStrings)
+	// Format 3 with two ranges: [0, 1) and [1, n).
+	fdSelect := []byte{3, 0, 2, 0, 0, 0, 0, 1, 1, byte(n >> 8), byte(n)}
+	top := cat(cffInt(391), cffInt(392), cffInt(0), []byte{12, 30},
+		cffInt(csOffset), []byte{17},
+		cffInt(fdArrayOffset), []byte{12, 36},
+		cffInt(fdSelectOffset), []byte{12, 37})
+	return cat(header, names, cffIndexOf(top), stringIndex, gsubrs, cs,
+		private1, subrs, private0, fdArray, fdSelect)
+}
+
+var cffSquarePoints = []Point{
+	{X: 100, Y: 0, Flags: flagOnCurve},
+	{X: 600, Y: 0, Flags: flagOnCurve},
+	{X: 600, Y: 500, Flags: flagOnCurve},
+	{X: 100, Y: 500, Flags: flagOnCurve},
+}
+
+func loadTestCFF(t *testing.T, b []byte, nGlyph int) *Font {
+	c, err := parseCFF(b, nGlyph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Font{cff: c, nGlyph: nGlyph}
+}
+
+func TestLoadCFF(t *testing.T) {
+	f := loadTestCFF(t, testCFF([]byte{14}, cffSquare, cffSquareSubr, cffArch), 4)
+	for i := Index(1); i <= 2; i++ {
+		points, ends, err := f.loadCFF(i, nil, nil)
+		if err != nil {
+			t.Errorf("glyph %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(points, cffSquarePoints) || !reflect.DeepEqual(ends, []int{4}) {
+			t.Errorf("glyph %d: got %v %v, want %v [4]", i, points, ends, cffSquarePoints)
+		}
+	}
+
+	points, ends, err := f.loadCFF(0, nil, nil)
+	if err != nil || len(points) != 0 || len(ends) != 0 {
+		t.Errorf(".notdef: got %v %v %v, want no contours", points, ends, err)
+	}
+
+	// The cubic becomes n quadratics, whose ends are on it at 0, 1/n, ...
+	// 1: x = 300(1-t)t^2 + 100t^3, y = 300(1-t)t.
+	points, ends, err = f.loadCFF(3, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ends) != 1 || ends[0] != len(points) || len(points) < 3 || len(points)%2 != 1 {
+		t.Fatalf("arch: got %v %v", points, ends)
+	}
+	n := len(points) / 2
+	for k := 0; k <= n; k++ {
+		tt := float64(k) / float64(n)
+		x, y := 300*(1-tt)*tt*tt+100*tt*tt*tt, 300*(1-tt)*tt
+		want := Point{X: int32(math.Floor(x + 0.5)), Y: int32(math.Floor(y + 0.5)), Flags: flagOnCurve}
+		if got := points[2*k]; got != want {
+			t.Errorf("arch: got %v at %d/%d, want %v", got, k, n, want)
+		}
+	}
+}
+
+func TestLoadCIDCFF(t *testing.T) {
+	f := loadTestCFF(t, testCIDCFF(cffSquareSubr, cffSquare, cffSquareSubr), 3)
+	for i := Index(1); i <= 2; i++ {
+		points, _, err := f.loadCFF(i, nil, nil)
+		if err != nil {
+			t.Errorf("glyph %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(points, cffSquarePoints) {
+			t.Errorf("glyph %d: got %v, want %v", i, points, cffSquarePoints)
+		}
+	}
+	// Glyph 0 has the Private DICT with no subroutines.
+	if _, _, err := f.loadCFF(0, nil, nil); err == nil {
+		t.Error("glyph 0: got no error for a call to a missing subroutine")
+	}
+	if _, _, err := f.loadCFF(3, nil, nil); err == nil {
+		t.Error("glyph 3: got no error for a glyph out of range")
+	}
+}
+
+func TestParseCFFMalformed(t *testing.T) {
+	good := testCFF([]byte{14}, cffSquare)
+	cid := testCIDCFF([]byte{14}, cffSquare)
+	tests := []struct {
+		name   string
+		b      []byte
+		nGlyph int
+	}{
+		{"empty", nil, 0},
+		{"version 2", append([]byte{2}, good[1:]...), 2},
+		{"truncated", good[:len(good)/2], 2},
+		{"too few charstrings", good, 3},
+		{"bad header size", append([]byte{1, 0, 200}, good[3:]...), 2},
+		// Cut off the FDSelect.
+		{"truncated FDSelect", cid[:len(cid)-4], 2},
+		// Point glyph 1 at the third Font DICT, which does not exist.
+		{"bad FDSelect", append(cid[:len(cid)-3:len(cid)-3], 2, 0, 2), 2},
+	}
+	for _, tt := range tests {
+		if _, err := parseCFF(tt.b, tt.nGlyph); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+
+	// A CID-keyed font with an empty FDArray. The FDSelect stays where
+	// the Top DICT points.
+	b := testCIDCFF([]byte{14})
+	fdSelect := len(b) - 11
+	fdArray := fdSelect - len(cffIndexOf(make([]byte, 11), make([]byte, 11)))
+	b = cat(b[:fdArray], []byte{0, 0}, make([]byte, fdSelect-fdArray-2), []byte{3, 0, 1, 0, 0, 0, 0, 1})
+	if _, err := parseCFF(b, 1); err == nil || !strings.Contains(err.Error(), "no Font DICT") {
+		t.Errorf("empty FDArray: got %v, want no Font DICT", err)
+	}
+}
+
+func TestLoadCFFMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		charString []byte
+	}{
+		{"stack overflow", append(make([]byte, 60), 14)},
+		{"unknown operator", []byte{139, 139, 21, 2, 14}},
+		{"rmoveto with one argument", []byte{139, 21, 14}},
+		{"missing subroutine", []byte{139, 139, 21, 33, 10, 14}},
+		{"missing global subroutine", []byte{139, 139, 21, 32, 29, 14}},
+		{"truncated number", []byte{139, 139, 21, 28, 0}},
+		{"division by zero", []byte{139, 139, 12, 12, 14}},
+		{"seac", []byte{139, 139, 139, 139, 14}},
+	}
+	for _, tt := range tests {
+		f := loadTestCFF(t, testCFF(tt.charString), 1)
+		if _, _, err := f.loadCFF(0, nil, nil); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+
+	// A subroutine which calls itself.
+	f := loadTestCFF(t, testCFF([]byte{139, 139, 21, 32, 10, 14}), 1)
+	f.cff.privates[0].subrs = [][]byte{{32, 10, 11}}
+	if _, _, err := f.loadCFF(0, nil, nil); err == nil {
+		t.Error("recursive subroutine: got no error")
+	}
+
+	// A CID-keyed font with more charstrings than glyphs, which are not
+	// in the FDSelect.
+	f = loadTestCFF(t, testCIDCFF([]byte{14}, cffSquare), 1)
+	if _, _, err := f.loadCFF(1, nil, nil); err == nil {
+		t.Error("glyph not in FDSelect: got no error")
+	}
+
+	// A name-keyed font whose Private DICT is missing.
+	f = &Font{cff: &cff{charStrings: [][]byte{{14}}}, nGlyph: 1}
+	if _, _, err := f.loadCFF(0, nil, nil); err == nil {
+		t.Error("no Private DICT: got no error")
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"fmt"
+	"sort"
+)
+
+//go:generate python3 gentables.py
+
+// A 32-bit encoding consists of a most-significant 16-bit Platform ID and a
+// least-significant 16-bit Platform Specific ID. The magic numbers are
+// specified at https://www.microsoft.com/typography/otspec/name.htm
+const (
+	unicodeVariationEncoding = 0x00000005 // PID = 0 (Unicode), PSID = 5 (Variation Sequences)
+	unicodeFullEncoding      = 0x00000004 // PID = 0 (Unicode), PSID = 4 (Unicode 2.0 full repertoire)
+	unicodeBMPEncoding       = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0 BMP)
+	unicodeFullRepertoire    = 0x00000006 // PID = 0 (Unicode), PSID = 6 (Unicode full repertoire)
+	macRomanEncoding         = 0x00010000 // PID = 1 (Macintosh), PSID = 0 (Roman)
+	macJapaneseEncoding      = 0x00010001 // PID = 1 (Macintosh), PSID = 1 (Japanese)
+	microsoftSymbolEncoding  = 0x00030000 // PID = 3 (Microsoft), PSID = 0 (Symbol)
+	microsoftUCS2Encoding    = 0x00030001 // PID = 3 (Microsoft), PSID = 1 (UCS-2)
+	microsoftSJISEncoding    = 0x00030002 // PID = 3 (Microsoft), PSID = 2 (Shift-JIS)
+	microsoftUCS4Encoding    = 0x0003000a // PID = 3 (Microsoft), PSID = 10 (UCS-4)
+)
+
+// A cmapEncoding is how the character codes of a cmap subtable are
+// converted to Unicode.
+type cmapEncoding int
+
+const (
+	cmapUnicode cmapEncoding = iota
+	cmapSymbol
+	cmapSJIS
+	cmapMacRoman
+)
+
+// A cmapSubtable is a candidate subtable of the cmap table.
+type cmapSubtable struct {
+	// rank orders the subtables; a higher one is preferred.
+	rank     int
+	encoding cmapEncoding
+	offset   int
+}
+
+type byRank []cmapSubtable
+
+func (s byRank) Len() int           { return len(s) }
+func (s byRank) Less(i, j int) bool { return s[i].rank > s[j].rank }
+func (s byRank) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// cmapRank returns the rank and encoding of a subtable with the given
+// platform and encoding IDs, or a zero rank if it is not supported. Full
+// Unicode is preferred to the BMP, which is preferred to the symbol and
+// legacy encodings.
+func cmapRank(pidPsid uint32) (int, cmapEncoding) {
+	switch pidPsid {
+	case unicodeFullEncoding, unicodeFullRepertoire, microsoftUCS4Encoding:
+		return 7, cmapUnicode
+	case unicodeBMPEncoding, 0x00000000, 0x00000001, 0x00000002:
+		return 6, cmapUnicode
+	case microsoftUCS2Encoding:
+		return 5, cmapUnicode
+	case microsoftSymbolEncoding:
+		return 4, cmapSymbol
+	case microsoftSJISEncoding:
+		return 3, cmapSJIS
+	case macJapaneseEncoding:
+		return 2, cmapSJIS
+	case macRomanEncoding:
+		return 1, cmapMacRoman
+	}
+	return 0, 0
+}
+
+// cmapMappings returns the character codes and glyphs of a format 0, 2 or 6
+// subtable. These formats map at most 16-bit codes, and are found in older
+// and Macintosh fonts.
+func (f *Font) cmapMappings(offset int) (codes []uint32, glyphs []Index, err error) {
+	const (
+		cmapFormat0 = 0
+		cmapFormat2 = 2
+		cmapFormat6 = 6
+	)
+
+	if offset+6 > len(f.cmap) {
+		return nil, nil, FormatError("cmap too short")
+	}
+	cmapFormat := u16(f.cmap, offset)
+	length := int(u16(f.cmap, offset+2))
+	if offset+length > len(f.cmap) {
+		return nil, nil, FormatError("cmap too short")
+	}
+	b := f.cmap[offset : offset+length]
+	switch cmapFormat {
+	case cmapFormat0:
+		if len(b) < 6+256 {
+			return nil, nil, FormatError("cmap too short")
+		}
+		for c := 0; c < 256; c++ {
+			codes = append(codes, uint32(c))
+			glyphs = append(glyphs, Index(b[6+c]))
+		}
+	case cmapFormat6:
+		if len(b) < 10 {
+			return nil, nil, FormatError("cmap too short")
+		}
+		firstCode, entryCount := uint32(u16(b, 6)), int(u16(b, 8))
+		if len(b) < 10+2*entryCount {
+			return nil, nil, FormatError("cmap too short")
+		}
+		for i := 0; i < entryCount; i++ {
+			codes = append(codes, firstCode+uint32(i))
+			glyphs = append(glyphs, Index(u16(b, 10+2*i)))
+		}
+	case cmapFormat2:
+		// Each high byte selects a subHeader, which maps a range of low bytes.
+		// Subheader 0 maps single-byte codes.
+		if len(b) < 6+512+8 {
+			return nil, nil, FormatError("cmap too short")
+		}
+		for hi := 0; hi < 256; hi++ {
+			k := int(u16(b, 6+2*hi))
+			sh := 6 + 512 + k
+			if k%8 != 0 || sh+8 > len(b) {
+				return nil, nil, FormatError("bad cmap subHeaderKey")
+			}
+			firstCode, entryCount := int(u16(b, sh)), int(u16(b, sh+2))
+			idDelta, idRangeOffset := u16(b, sh+4), int(u16(b, sh+6))
+			for i := 0; i < entryCount; i++ {
+				lo := firstCode + i
+				if lo > 0xff || (k == 0 && lo != hi) {
+					continue
+				}
+				// idRangeOffset is relative to its own position.
+				x := sh + 6 + idRangeOffset + 2*i
+				if x+2 > len(b) {
+					return nil, nil, FormatError("bad cmap idRangeOffset")
+				}
+				g := u16(b, x)
+				if g != 0 {
+					g += idDelta
+				}
+				code := uint32(lo)
+				if k != 0 {
+					code |= uint32(hi) << 8
+				}
+				codes = append(codes, code)
+				glyphs = append(glyphs, Index(g))
+			}
+		}
+	default:
+		return nil, nil, UnsupportedError(fmt.Sprintf("cmap format: %d", cmapFormat))
+	}
+	return codes, glyphs, nil
+}
+
+// cmapCodes returns the character codes which f.cm maps, as read from a
+// format 4 subtable, and their glyphs.
+func (f *Font) cmapCodes() (codes []uint32, glyphs []Index) {
+	for _, cm := range f.cm {
+		for c := cm.start; c <= cm.end && c <= 0xffff; c++ {
+			if i := f.index(c); i != 0 {
+				codes = append(codes, c)
+				glyphs = append(glyphs, i)
+			}
+		}
+	}
+	return codes, glyphs
+}
+
+// A runeGlyph is a rune and the glyph it maps to.
+type runeGlyph struct {
+	r rune
+	i Index
+}
+
+type byRune []runeGlyph
+
+func (s byRune) Len() int           { return len(s) }
+func (s byRune) Less(i, j int) bool { return s[i].r < s[j].r }
+func (s byRune) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// setMappings sets f.cm from character codes of the given encoding and their
+// glyphs. Consecutive runes which map to consecutive glyphs are merged into
+// one range.
+func (f *Font) setMappings(codes []uint32, glyphs []Index, encoding cmapEncoding) error {
+	m := make([]runeGlyph, 0, len(codes))
+	for i, c := range codes {
+		var r rune
+		switch encoding {
+		case cmapSJIS:
+			r = decodeSJIS(c)
+		case cmapMacRoman:
+			r = rune(c)
+			if c >= 0x80 {
+				r = rune(macRomanTable[c-0x80])
+			}
+		default:
+			r = rune(c)
+		}
+		if r != 0 && glyphs[i] != 0 {
+			m = append(m, runeGlyph{r, glyphs[i]})
+		}
+	}
+	if len(m) == 0 {
+		return UnsupportedError("empty cmap")
+	}
+	sort.Stable(byRune(m))
+	f.cm = f.cm[:0]
+	for i, x := range m {
+		if i > 0 && x.r == m[i-1].r {
+			// The first code for a rune wins.
+			continue
+		}
+		if n := len(f.cm); n > 0 && uint32(x.r) == f.cm[n-1].end+1 &&
+			uint32(x.i) == uint32(x.r)+f.cm[n-1].delta {
+			f.cm[n-1].end++
+			continue
+		}
+		f.cm = append(f.cm, cm{
+			start: uint32(x.r),
+			end:   uint32(x.r),
+			delta: uint32(x.i) - uint32(x.r),
+		})
+	}
+	return nil
+}
+
+// decodeSJIS returns the rune of a Shift-JIS code, or 0 if it has none.
+func decodeSJIS(c uint32) rune {
+	switch {
+	case c < 0x80:
+		return rune(c)
+	case 0xa1 <= c && c <= 0xdf:
+		// Half-width katakana.
+		return rune(0xff61 + c - 0xa1)
+	case c < 0x100 || c > 0xffff:
+		return 0
+	}
+	lead, trail := c>>8, c&0xff
+	var row, col uint32
+	switch {
+	case 0x81 <= lead && lead <= 0x9f:
+		row = lead - 0x81
+	case 0xe0 <= lead && lead <= 0xef:
+		row = lead - 0xe0 + 31
+	case 0xfa <= lead && lead <= 0xfc:
+		row = lead - 0xfa + 47
+	default:
+		return 0
+	}
+	switch {
+	case 0x40 <= trail && trail <= 0x7e:
+		col = trail - 0x40
+	case 0x80 <= trail && trail <= 0xfc:
+		col = trail - 0x80 + 63
+	default:
+		return 0
+	}
+	return rune(sjisTable[row*188+col])
+}
+
+// parseUVS parses a format 14 subtable, which maps Unicode Variation
+// Sequences of a base character and a variation selector.
+func (f *Font) parseUVS(offset int) error {
+	const cmapFormat14 = 14
+
+	if offset+10 > len(f.cmap) {
+		return FormatError("cmap too short")
+	}
+	if u16(f.cmap, offset) != cmapFormat14 {
+		// Only format 14 may use this encoding; ignore anything else.
+		return nil
+	}
+	length := int(u32(f.cmap, offset+2))
+	n := int(u32(f.cmap, offset+6))
+	if length < 10+11*n || offset+length > len(f.cmap) {
+		return FormatError("inconsistent cmap length")
+	}
+	f.uvs = f.cmap[offset : offset+length]
+	return nil
+}
+
+// IndexVariant returns a Font's index for the given rune followed by the
+// variation selector vs, such as U+E0100 for one of the glyphs of a kanji
+// registered in the Ideographic Variation Database. It returns Index(x)
+// if the font has no glyph specific to the sequence.
+func (f *Font) IndexVariant(x, vs rune) Index {
+	if len(f.uvs) < 10 {
+		return f.Index(x)
+	}
+	n := int(u32(f.uvs, 6))
+	rec := sort.Search(n, func(i int) bool {
+		return u24(f.uvs, 10+11*i) >= uint32(vs)
+	})
+	if rec == n || u24(f.uvs, 10+11*rec) != uint32(vs) {
+		return f.Index(x)
+	}
+	// The default UVS table lists the sequences which use the glyph of
+	// the base character, so only the non-default one needs searching.
+	nonDefault := int(u32(f.uvs, 10+11*rec+7))
+	if nonDefault == 0 || nonDefault+4 > len(f.uvs) {
+		return f.Index(x)
+	}
+	m := int(u32(f.uvs, nonDefault))
+	if nonDefault+4+5*m > len(f.uvs) {
+		return f.Index(x)
+	}
+	mappings := f.uvs[nonDefault+4:]
+	i := sort.Search(m, func(i int) bool {
+		return u24(mappings, 5*i) >= uint32(x)
+	})
+	if i < m && u24(mappings, 5*i) == uint32(x) {
+		return Index(u16(mappings, 5*i+3))
+	}
+	return f.Index(x)
+}
+
+// IsVariationSelector returns whether r is a variation selector, which
+// selects a glyph for the preceding character rather than being drawn.
+func IsVariationSelector(r rune) bool {
+	return 0xfe00 <= r && r <= 0xfe0f || 0xe0100 <= r && r <= 0xe01ef
+}
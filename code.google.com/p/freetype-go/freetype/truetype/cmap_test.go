@@ -0,0 +1,94 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"testing"
+)
+
+// cmap4 returns a format 4 subtable of segments [start, end] which map to
+// start+delta, or to glyphs for the segment whose glyphs are given. The
+// last segment, which maps 0xffff, is added.
+func cmap4(segs [][3]int, glyphs []int) []byte {
+	n := len(segs) + 1
+	b := []byte{0, 4, 0, 0, 0, 0, byte(2 * n >> 8), byte(2 * n), 0, 0, 0, 0, 0, 0}
+	u := func(v int) { b = append(b, byte(v>>8), byte(v)) }
+	for _, s := range segs {
+		u(s[1])
+	}
+	u(0xffff)
+	u(0)
+	for _, s := range segs {
+		u(s[0])
+	}
+	u(0xffff)
+	for _, s := range segs {
+		u(s[2])
+	}
+	u(1)
+	// A segment with a zero delta takes its glyphs from the glyph array,
+	// which follows the idRangeOffsets.
+	for i, s := range segs {
+		if s[2] == 0 {
+			u(2 * (n - i))
+		} else {
+			u(0)
+		}
+	}
+	u(0)
+	for _, g := range glyphs {
+		u(g)
+	}
+	b[2], b[3] = byte(len(b)>>8), byte(len(b))
+	return b
+}
+
+// testCmap returns a cmap table with one subtable of the encoding pidPsid.
+func testCmap(pidPsid uint32, subtable []byte) []byte {
+	b := []byte{0, 0, 0, 1,
+		byte(pidPsid >> 24), byte(pidPsid >> 16), byte(pidPsid >> 8), byte(pidPsid),
+		0, 0, 0, 12}
+	return append(b, subtable...)
+}
+
+func TestCmap4(t *testing.T) {
+	// In Shift-JIS, 0x82a0 to 0x82a2 are あぃい and 0x8940 and 0x8941 are 院陰.
+	sjis := cmap4([][3]int{
+		{0x41, 0x41, 1 - 0x41},
+		{0x82a0, 0x82a2, 0x10000 + 5 - 0x82a0},
+		{0x8940, 0x8941, 0},
+	}, []int{9, 0})
+	// The same glyphs in Unicode.
+	unicode := cmap4([][3]int{
+		{0x41, 0x41, 1 - 0x41},
+		{0x3042, 0x3044, 5 - 0x3042},
+		{0x9662, 0x9662, 0},
+	}, []int{9})
+	tests := []struct {
+		name  string
+		cmap  []byte
+		runes map[rune]Index
+	}{
+		{"unicode", testCmap(microsoftUCS2Encoding, unicode),
+			map[rune]Index{'A': 1, 'あ': 5, 'ぃ': 6, 'い': 7, '院': 9, '陰': 0, 'B': 0}},
+		{"sjis", testCmap(microsoftSJISEncoding, sjis),
+			map[rune]Index{'A': 1, 'あ': 5, 'ぃ': 6, 'い': 7, '院': 9, '陰': 0, 'B': 0, 0x82a0: 0}},
+		{"mac japanese", testCmap(macJapaneseEncoding, sjis),
+			map[rune]Index{'あ': 5, '院': 9}},
+	}
+	for _, tt := range tests {
+		f := &Font{cmap: tt.cmap}
+		if err := f.parseCmap(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for r, want := range tt.runes {
+			if got := f.Index(r); got != want {
+				t.Errorf("%s: Index(%U): got %d, want %d", tt.name, r, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadCollection(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("testdata/collection.ttc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCollection(t *testing.T) {
+	c, err := ParseCollection(loadCollection(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.NumFaces(); n != 2 {
+		t.Fatalf("got %d faces, want 2", n)
+	}
+	names, err := c.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Shaping Regular", "Shaping Bold"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+	for i, bold := range []bool{false, true} {
+		f, err := c.Font(i)
+		if err != nil {
+			t.Fatalf("face %d: %v", i, err)
+		}
+		if info := f.Info(); info.Bold != bold || info.FullName != names[i] {
+			t.Errorf("face %d: got %q bold %v", i, info.FullName, info.Bold)
+		}
+		if f.Index('あ') != shapeKana {
+			t.Errorf("face %d: got glyph %d for あ, want %d", i, f.Index('あ'), shapeKana)
+		}
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := c.Font(i); err == nil {
+			t.Errorf("face %d: got no error", i)
+		}
+	}
+
+	// Parse takes the first face.
+	f, err := Parse(loadCollection(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := f.Name(NameIDFontFullName); name != "Shaping Regular" {
+		t.Errorf("Parse: got %q", name)
+	}
+
+	// A plain font is a collection of one face.
+	b, err := ioutil.ReadFile("testdata/shaping.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ParseCollection(b); err != nil || c.NumFaces() != 1 {
+		t.Errorf("shaping.ttf: got %v, want one face", err)
+	}
+}
+
+// putU32 returns a copy of b with v at i.
+func putU32(b []byte, i int, v uint32) []byte {
+	b = append([]byte(nil), b...)
+	b[i], b[i+1], b[i+2], b[i+3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+	return b
+}
+
+func TestCollectionMalformed(t *testing.T) {
+	ttc := loadCollection(t)
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"short", ttc[:8]},
+		{"version 3", putU32(ttc, 4, 0x00030000)},
+		{"no faces", putU32(ttc, 8, 0)},
+		{"too many faces", putU32(ttc, 8, 1<<20)},
+		{"offset 0", putU32(ttc, 12, 0)},
+		{"offset past the end", putU32(ttc, 16, uint32(len(ttc)+1))},
+	}
+	for _, tt := range tests {
+		if _, err := ParseCollection(tt.b); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+
+	// Offsets in the data, but not of a face.
+	for _, off := range []int{len(ttc), len(ttc) - 4, 1} {
+		c, err := ParseCollection(putU32(ttc, 16, uint32(off)))
+		if err != nil {
+			t.Errorf("offset %d: %v", off, err)
+			continue
+		}
+		if _, err := c.Font(1); err == nil {
+			t.Errorf("offset %d: got no error", off)
+		}
+		if _, err := c.Names(); err == nil {
+			t.Errorf("offset %d: Names: got no error", off)
+		}
+	}
+
+	// The second face is the collection again.
+	nested := append(ttc[:len(ttc):len(ttc)], ttc[:12]...)
+	nested = putU32(nested, 16, uint32(len(ttc)))
+	c, err := ParseCollection(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Font(1); err == nil || !strings.Contains(err.Error(), "recursive TTC") {
+		t.Errorf("nested ttcf: got %v, want recursive TTC", err)
+	}
+}
@@ -0,0 +1,57 @@
+# Copyright 2010 The Freetype-Go Authors. All rights reserved.
+# Use of this source code is governed by your choice of either the
+# FreeType License or the GNU General Public License version 2 (or
+# any later version), both of which can be found in the LICENSE file.
+
+# gentables.py writes tables.go, the Shift-JIS and Mac OS Roman tables which
+# convert the character codes of legacy cmap subtables to Unicode. Run it
+# with go generate.
+
+LEADS = list(range(0x81, 0xa0)) + list(range(0xe0, 0xf0)) + list(range(0xfa, 0xfd))
+TRAILS = list(range(0x40, 0x7f)) + list(range(0x80, 0xfd))
+
+
+def decode(b, codec):
+    try:
+        s = b.decode(codec)
+    except UnicodeDecodeError:
+        return 0
+    if len(s) != 1 or ord(s) > 0xffff:
+        return 0
+    return ord(s)
+
+
+def table(values):
+    lines = []
+    for i in range(0, len(values), 12):
+        lines.append('\t' + ' '.join('0x%04x,' % v for v in values[i:i + 12]))
+    return '\n'.join(lines)
+
+
+sjis = [decode(bytes([lead, trail]), 'cp932') for lead in LEADS for trail in TRAILS]
+mac = [decode(bytes([c]), 'mac_roman') for c in range(0x80, 0x100)]
+
+with open('tables.go', 'w') as f:
+    f.write('''// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+// Code generated by gentables.py from the cp932 and mac_roman codecs of Python. DO NOT EDIT.
+
+package truetype
+
+// sjisTable is the Unicode value of each double-byte Shift-JIS character,
+// as extended by Microsoft's code page 932. There is a row of 188 trail
+// bytes (0x40-0x7e and 0x80-0xfc) for each lead byte (0x81-0x9f, 0xe0-0xef
+// and 0xfa-0xfc). Zero means that the code is not assigned.
+var sjisTable = [...]uint16{
+%s
+}
+
+// macRomanTable is the Unicode value of each Mac OS Roman character from
+// 0x80 to 0xff.
+var macRomanTable = [128]uint16{
+%s
+}
+''' % (table(sjis), table(mac)))
@@ -88,6 +88,11 @@ const (
 // loaded contours for this GlyphBuf. scale is the number of 26.6 fixed point
 // units in 1 em, i is the glyph index, and h is the hinting policy.
 func (g *GlyphBuf) Load(f *Font, scale int32, i Index, h Hinting) error {
+	if f.cff != nil {
+		// CFF outlines have no instructions to hint them with, and their
+		// stem hints are not used.
+		h = NoHinting
+	}
 	g.Point = g.Point[:0]
 	g.Unhinted = g.Unhinted[:0]
 	g.InFontUnits = g.InFontUnits[:0]
@@ -180,9 +185,15 @@ func (g *GlyphBuf) load(recursion int32, i Index, useMyMetrics bool) (err error)
 	if recursion >= 32 {
 		return UnsupportedError("excessive compound glyph recursion")
 	}
-	// Find the relevant slice of g.font.glyf.
+	if g.font.cff != nil {
+		return g.loadCFF(i)
+	}
+	// Find the relevant slice of g.font.glyf. A font with only bitmaps
+	// has no outlines at all.
 	var g0, g1 uint32
-	if g.font.locaOffsetFormat == locaOffsetFormatShort {
+	if len(g.font.loca) == 0 {
+		// No-op.
+	} else if g.font.locaOffsetFormat == locaOffsetFormatShort {
 		g0 = 2 * uint32(u16(g.font.loca, 2*int(i)))
 		g1 = 2 * uint32(u16(g.font.loca, 2*int(i)+2))
 	} else {
@@ -270,6 +281,35 @@ func (g *GlyphBuf) load(recursion int32, i Index, useMyMetrics bool) (err error)
 	return nil
 }
 
+// loadCFF loads a glyph from the CFF table. Its cubic curves have been
+// turned into quadratic ones, so the contours are like a simple glyph's.
+func (g *GlyphBuf) loadCFF(i Index) (err error) {
+	np0 := len(g.Point)
+	if g.Point, g.End, err = g.font.loadCFF(i, g.Point, g.End); err != nil {
+		return err
+	}
+	yMax := int32(0)
+	for j, p := range g.Point[np0:] {
+		if j == 0 || yMax < p.Y {
+			yMax = p.Y
+		}
+	}
+	// The glyph's origin is at x = 0, where the charstring starts.
+	uhm := g.font.unscaledHMetric(i)
+	uvm := g.font.unscaledVMetric(i, yMax)
+	g.phantomPoints = [4]Point{
+		{},
+		{X: uhm.AdvanceWidth},
+		{X: uhm.AdvanceWidth / 2, Y: yMax + uvm.TopSideBearing},
+		{X: uhm.AdvanceWidth / 2, Y: yMax + uvm.TopSideBearing - uvm.AdvanceHeight},
+	}
+	g.addPhantomsAndScale(np0, np0, true, false)
+	copy(g.phantomPoints[:], g.Point[len(g.Point)-4:])
+	g.Point = g.Point[:len(g.Point)-4]
+	g.metricsSet = true
+	return nil
+}
+
 // loadOffset is the initial offset for loadSimple and loadCompound. The first
 // 10 bytes are the number of contours and the bounding box.
 const loadOffset = 10
@@ -0,0 +1,202 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"sort"
+)
+
+// GPOS lookup types.
+const (
+	gposSingle          = 1
+	gposPair            = 2
+	gposMarkToBase      = 4
+	gposMarkToLigature  = 5
+	gposMarkToMark      = 6
+	gposContext         = 7
+	gposChainingContext = 8
+)
+
+// valueSize returns the size in bytes of a ValueRecord of the given
+// format, which has a 16-bit field for each bit set.
+func valueSize(format uint16) int {
+	n := 0
+	for f := format & 0xff; f != 0; f >>= 1 {
+		n += int(f & 1)
+	}
+	return 2 * n
+}
+
+// adjust adds the ValueRecord of the given format at t[x:] to g. Device
+// tables, which adjust for particular sizes, are not used. As with the
+// advances, only the horizontal adjustments apply to horizontal text, and
+// only the vertical ones to vertical text.
+func (sh *shaper) adjust(g *shapeGlyph, t otTable, x int, format uint16) {
+	for bit := uint16(1); bit <= 8; bit <<= 1 {
+		if format&bit == 0 {
+			continue
+		}
+		v := int32(int16(t.u16(x)))
+		x += 2
+		switch bit {
+		case 1:
+			g.XOffset += v
+		case 2:
+			g.YOffset += v
+		case 4:
+			if !sh.vertical {
+				g.XAdvance += v
+			}
+		case 8:
+			// A positive value makes the advance height bigger, which is
+			// a more negative YAdvance.
+			if sh.vertical {
+				g.YAdvance -= v
+			}
+		}
+	}
+}
+
+// anchor returns the co-ordinates of the Anchor table t.
+func anchor(t otTable) (x, y int32) {
+	return int32(int16(t.u16(2))), int32(int16(t.u16(4)))
+}
+
+// applyPos applies a GPOS subtable at position i of the buffer.
+func (sh *shaper) applyPos(lookupType int, st otTable, i int) int {
+	g := sh.buf[i].Index
+	switch lookupType {
+	case gposSingle:
+		ci := st.offset(2).coverage(g)
+		if ci < 0 {
+			return -1
+		}
+		format := st.u16(4)
+		switch st.u16(0) {
+		case 1:
+			sh.adjust(&sh.buf[i], st, 6, format)
+		case 2:
+			if ci >= int(st.u16(6)) {
+				return -1
+			}
+			sh.adjust(&sh.buf[i], st, 8+ci*valueSize(format), format)
+		default:
+			return -1
+		}
+		return i + 1
+
+	case gposPair:
+		ci := st.offset(2).coverage(g)
+		if ci < 0 {
+			return -1
+		}
+		j := sh.next(i)
+		if j < 0 {
+			return -1
+		}
+		g2 := sh.buf[j].Index
+		f1, f2 := st.u16(4), st.u16(6)
+		s1, s2 := valueSize(f1), valueSize(f2)
+		var t otTable
+		var x int
+		switch st.u16(0) {
+		case 1:
+			// Pairs of glyphs, sorted by the second glyph.
+			if ci >= int(st.u16(8)) {
+				return -1
+			}
+			set := st.offset(10 + 2*ci)
+			n, size := int(set.u16(0)), 2+s1+s2
+			k := sort.Search(n, func(k int) bool { return Index(set.u16(2+k*size)) >= g2 })
+			if k == n || Index(set.u16(2+k*size)) != g2 {
+				return -1
+			}
+			t, x = set, 2+k*size+2
+		case 2:
+			// Pairs of glyph classes.
+			c1, c2 := st.offset(8).class(g), st.offset(10).class(g2)
+			n1, n2 := int(st.u16(12)), int(st.u16(14))
+			if c1 >= n1 || c2 >= n2 {
+				return -1
+			}
+			t, x = st, 16+(c1*n2+c2)*(s1+s2)
+		default:
+			return -1
+		}
+		sh.adjust(&sh.buf[i], t, x, f1)
+		sh.adjust(&sh.buf[j], t, x+s1, f2)
+		if f2 != 0 {
+			return j + 1
+		}
+		return j
+
+	case gposMarkToBase, gposMarkToLigature, gposMarkToMark:
+		mi := st.offset(2).coverage(g)
+		if mi < 0 {
+			return -1
+		}
+		// Find the glyph to attach to. Marks attach to the base or
+		// ligature before them, skipping other marks, and to the mark
+		// right before them.
+		j := i - 1
+		if lookupType == gposMarkToMark {
+			j = sh.prev(i)
+		} else {
+			for j >= 0 && sh.glyphClass(j) == gdefMark {
+				j--
+			}
+		}
+		if j < 0 {
+			return -1
+		}
+		bi := st.offset(4).coverage(sh.buf[j].Index)
+		classCount := int(st.u16(6))
+		marks := st.offset(8)
+		if bi < 0 || mi >= int(marks.u16(0)) {
+			return -1
+		}
+		class := int(marks.u16(2 + 4*mi))
+		if class >= classCount {
+			return -1
+		}
+		markAnchor := marks.offset(2 + 4*mi + 2)
+		bases := st.offset(10)
+		if bi >= int(bases.u16(0)) {
+			return -1
+		}
+		var baseAnchor otTable
+		if lookupType == gposMarkToLigature {
+			lig := bases.offset(2 + 2*bi)
+			n := int(lig.u16(0))
+			if n == 0 {
+				return -1
+			}
+			// A mark inside the ligature goes on the component it
+			// followed, and others on the last one.
+			comp := n - 1
+			if m := &sh.buf[i]; m.ligID != 0 && m.ligID == sh.buf[j].ligID && m.ligComp > 0 && m.ligComp <= n {
+				comp = m.ligComp - 1
+			}
+			baseAnchor = lig.offset(2 + 2*(comp*classCount+class))
+		} else {
+			baseAnchor = bases.offset(2 + 2*(bi*classCount+class))
+		}
+		if markAnchor == nil || baseAnchor == nil {
+			return -1
+		}
+		bx, by := anchor(baseAnchor)
+		mx, my := anchor(markAnchor)
+		m := &sh.buf[i]
+		m.attach = j
+		m.XOffset, m.YOffset = bx-mx, by-my
+		m.XAdvance, m.YAdvance = 0, 0
+		return i + 1
+
+	case gposContext, gposChainingContext:
+		return sh.applyContext(lookupType == gposChainingContext, st, i)
+	}
+	return -1
+}
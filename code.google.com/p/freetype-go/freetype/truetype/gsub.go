@@ -0,0 +1,115 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// GSUB lookup types.
+const (
+	gsubSingle          = 1
+	gsubMultiple        = 2
+	gsubAlternate       = 3
+	gsubLigature        = 4
+	gsubContext         = 5
+	gsubChainingContext = 6
+)
+
+// applySubst applies a GSUB subtable at position i of the buffer.
+func (sh *shaper) applySubst(lookupType int, st otTable, i int) int {
+	g := sh.buf[i].Index
+	switch lookupType {
+	case gsubSingle:
+		ci := st.offset(2).coverage(g)
+		if ci < 0 {
+			return -1
+		}
+		switch st.u16(0) {
+		case 1:
+			sh.buf[i].Index = g + Index(st.u16(4))
+		case 2:
+			if ci >= int(st.u16(4)) {
+				return -1
+			}
+			sh.buf[i].Index = Index(st.u16(6 + 2*ci))
+		default:
+			return -1
+		}
+		return i + 1
+
+	case gsubMultiple:
+		ci := st.offset(2).coverage(g)
+		if ci < 0 || ci >= int(st.u16(4)) {
+			return -1
+		}
+		seq := st.offset(6 + 2*ci)
+		n := int(seq.u16(0))
+		if n == 0 {
+			return -1
+		}
+		// Each glyph of the sequence takes the place of the original one.
+		glyphs := make([]shapeGlyph, n)
+		for k := range glyphs {
+			glyphs[k] = sh.buf[i]
+			glyphs[k].Index = Index(seq.u16(2 + 2*k))
+		}
+		sh.buf = append(sh.buf[:i], append(glyphs, sh.buf[i+1:]...)...)
+		return i + n
+
+	case gsubAlternate:
+		// The first alternate is used, as there is no way to choose.
+		ci := st.offset(2).coverage(g)
+		if ci < 0 || ci >= int(st.u16(4)) {
+			return -1
+		}
+		set := st.offset(6 + 2*ci)
+		if set.u16(0) == 0 {
+			return -1
+		}
+		sh.buf[i].Index = Index(set.u16(2))
+		return i + 1
+
+	case gsubLigature:
+		ci := st.offset(2).coverage(g)
+		if ci < 0 || ci >= int(st.u16(4)) {
+			return -1
+		}
+		set := st.offset(6 + 2*ci)
+		for l, n := 0, int(set.u16(0)); l < n; l++ {
+			lig := set.offset(2 + 2*l)
+			components := int(lig.u16(2))
+			if components == 0 {
+				continue
+			}
+			match := func(k int, g Index) bool { return k == 0 || Index(lig.u16(4+2*(k-1))) == g }
+			if pos := sh.matchContext(i, components, 0, 0, match, nil, nil); pos != nil {
+				sh.ligate(pos, Index(lig.u16(0)))
+				return i + 1
+			}
+		}
+		return -1
+
+	case gsubContext, gsubChainingContext:
+		return sh.applyContext(lookupType == gsubChainingContext, st, i)
+	}
+	return -1
+}
+
+// ligate replaces the glyphs at pos by the ligature glyph lig. The marks
+// between them stay where they are, remembering which component of the
+// ligature they follow, for mark-to-ligature positioning.
+func (sh *shaper) ligate(pos []int, lig Index) {
+	sh.nextLigID++
+	id := sh.nextLigID
+	first := &sh.buf[pos[0]]
+	first.Index = lig
+	first.ligID, first.ligComp, first.nComp = id, 0, len(pos)
+	for k := 1; k < len(pos); k++ {
+		for m := pos[k-1] + 1; m < pos[k]; m++ {
+			sh.buf[m].ligID, sh.buf[m].ligComp = id, k
+		}
+	}
+	for k := len(pos) - 1; k > 0; k-- {
+		sh.buf = append(sh.buf[:pos[k]], sh.buf[pos[k]+1:]...)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// A FontInfo describes a Font, from its name, OS/2, hhea and head tables.
+// All lengths are in FUnits, with positive Y going upwards.
+type FontInfo struct {
+	// Family is the typographic family name, such as "Source Han Sans",
+	// and Style is the style within it, such as "Bold".
+	Family, Style string
+	// FullName combines the family and style, and PostScriptName is the
+	// name without spaces which identifies the font.
+	FullName, PostScriptName string
+	// Weight is from 100 (thin) to 900 (black), where 400 is regular and
+	// 700 is bold. Width is from 1 (ultra-condensed) to 9 (ultra-expanded),
+	// where 5 is normal.
+	Weight, Width int
+	Bold, Italic  bool
+	UnitsPerEm    int32
+	// Ascender and Descender are the distances from the baseline to the
+	// top and bottom of the line; Descender is usually negative. LineGap is
+	// the extra space between lines.
+	Ascender, Descender, LineGap int32
+	// XHeight and CapHeight are the heights of lower and upper case Latin
+	// letters, or zero if the font does not say.
+	XHeight, CapHeight int32
+}
+
+// LineHeight returns the recommended distance between baselines.
+func (i *FontInfo) LineHeight() int32 {
+	return i.Ascender - i.Descender + i.LineGap
+}
+
+// Info returns a description of the font.
+func (f *Font) Info() FontInfo {
+	info := FontInfo{
+		Family:         f.Name(NameIDTypographicFamily),
+		Style:          f.Name(NameIDTypographicSubfamily),
+		FullName:       f.Name(NameIDFontFullName),
+		PostScriptName: f.Name(NameIDPostscriptName),
+		Weight:         400,
+		Width:          5,
+		UnitsPerEm:     f.fUnitsPerEm,
+	}
+	if info.Family == "" {
+		info.Family = f.Name(NameIDFontFamily)
+	}
+	if info.Style == "" {
+		info.Style = f.Name(NameIDFontSubfamily)
+	}
+	// macStyle in the head table.
+	macStyle := u16(f.head, 44)
+	info.Bold = macStyle&0x01 != 0
+	info.Italic = macStyle&0x02 != 0
+	if len(f.hhea) >= 10 {
+		info.Ascender = int32(int16(u16(f.hhea, 4)))
+		info.Descender = int32(int16(u16(f.hhea, 6)))
+		info.LineGap = int32(int16(u16(f.hhea, 8)))
+	}
+	// The OS/2 table has grown over time, as described at
+	// http://www.microsoft.com/typography/otspec/os2.htm
+	if len(f.os2) >= 64 {
+		info.Weight = int(u16(f.os2, 4))
+		info.Width = int(u16(f.os2, 6))
+		fsSelection := u16(f.os2, 62)
+		info.Italic = info.Italic || fsSelection&0x01 != 0
+		info.Bold = info.Bold || fsSelection&0x20 != 0
+		// The typographic metrics are used if the font says so, or if hhea
+		// has none.
+		const useTypoMetrics = 0x80
+		if len(f.os2) >= 74 && (fsSelection&useTypoMetrics != 0 || info.LineHeight() == 0) {
+			info.Ascender = int32(int16(u16(f.os2, 68)))
+			info.Descender = int32(int16(u16(f.os2, 70)))
+			info.LineGap = int32(int16(u16(f.os2, 72)))
+		}
+		if version := u16(f.os2, 0); version >= 2 && len(f.os2) >= 90 {
+			info.XHeight = int32(int16(u16(f.os2, 86)))
+			info.CapHeight = int32(int16(u16(f.os2, 88)))
+		}
+	}
+	if info.LineHeight() == 0 {
+		info.Ascender, info.Descender = f.bounds.YMax, f.bounds.YMin
+	}
+	return info
+}
@@ -0,0 +1,105 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"unicode/utf16"
+)
+
+// A NameID identifies a string in a Font's name table.
+type NameID uint16
+
+const (
+	NameIDCopyright            NameID = 0
+	NameIDFontFamily           NameID = 1
+	NameIDFontSubfamily        NameID = 2
+	NameIDUniqueSubfamilyID    NameID = 3
+	NameIDFontFullName         NameID = 4
+	NameIDNameTableVersion     NameID = 5
+	NameIDPostscriptName       NameID = 6
+	NameIDTypographicFamily    NameID = 16
+	NameIDTypographicSubfamily NameID = 17
+)
+
+// Platform and encoding IDs of name records which this package decodes.
+const (
+	platformUnicode   = 0
+	platformMac       = 1
+	platformMicrosoft = 3
+
+	encodingMacRoman     = 0
+	encodingMSUnicodeBMP = 1
+	encodingMSUCS4       = 10
+
+	languageMSEnglishUS = 0x0409
+)
+
+// Name returns the string with the given id from the font's name table, or
+// "" if there is none. American English is preferred to other languages.
+func (f *Font) Name(id NameID) string {
+	if len(f.name) < 6 {
+		return ""
+	}
+	n := int(u16(f.name, 2))
+	strings := int(u16(f.name, 4))
+	if 6+12*n > len(f.name) {
+		return ""
+	}
+	best, bestRank := "", 0
+	for i := 0; i < n; i++ {
+		x := 6 + 12*i
+		if NameID(u16(f.name, x+6)) != id {
+			continue
+		}
+		platform, encoding, language := u16(f.name, x), u16(f.name, x+2), u16(f.name, x+4)
+		length, offset := int(u16(f.name, x+8)), strings+int(u16(f.name, x+10))
+		if offset+length > len(f.name) {
+			continue
+		}
+		b := f.name[offset : offset+length]
+		// rank orders the records; a higher one is preferred.
+		var s string
+		rank := 0
+		switch {
+		case platform == platformMicrosoft && (encoding == encodingMSUnicodeBMP || encoding == encodingMSUCS4):
+			s, rank = decodeUTF16(b), 3
+			if language == languageMSEnglishUS {
+				rank = 4
+			}
+		case platform == platformUnicode:
+			s, rank = decodeUTF16(b), 2
+		case platform == platformMac && encoding == encodingMacRoman && language == 0:
+			if !isASCII(b) {
+				continue
+			}
+			s, rank = string(b), 1
+		default:
+			continue
+		}
+		if rank > bestRank {
+			best, bestRank = s, rank
+		}
+	}
+	return best
+}
+
+// decodeUTF16 decodes big-endian UTF-16.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = u16(b, 2*i)
+	}
+	return string(utf16.Decode(u))
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
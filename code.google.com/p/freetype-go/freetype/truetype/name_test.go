@@ -0,0 +1,120 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+)
+
+type nameRecord struct {
+	platform, encoding, language uint16
+	id                           NameID
+	s                            string
+}
+
+// nameTable returns a name table of the records. Strings of Windows and
+// Unicode records are encoded in UTF-16BE, and the others as they are.
+func nameTable(records ...nameRecord) []byte {
+	var dir, data []byte
+	for _, r := range records {
+		b := []byte(r.s)
+		if r.platform != platformMac {
+			b = nil
+			for _, u := range utf16.Encode([]rune(r.s)) {
+				b = append(b, byte(u>>8), byte(u))
+			}
+		}
+		dir = cat(dir, be16(int(r.platform)), be16(int(r.encoding)), be16(int(r.language)),
+			be16(int(r.id)), be16(len(b)), be16(len(data)))
+		data = append(data, b...)
+	}
+	return cat(be16(0), be16(len(records)), be16(6+len(dir)), dir, data)
+}
+
+func TestName(t *testing.T) {
+	mac := func(id NameID, s string) nameRecord { return nameRecord{1, 0, 0, id, s} }
+	ms := func(language uint16, id NameID, s string) nameRecord { return nameRecord{3, 1, language, id, s} }
+	tests := []struct {
+		name    string
+		records []nameRecord
+		id      NameID
+		want    string
+	}{
+		{"mac", []nameRecord{mac(1, "IPAMonaGothic"), mac(2, "Regular")}, NameIDFontFamily, "IPAMonaGothic"},
+		{"mac style", []nameRecord{mac(1, "IPAMonaGothic"), mac(2, "Regular")}, NameIDFontSubfamily, "Regular"},
+		{"microsoft", []nameRecord{ms(0x409, 1, "IPA モナー ゴシック")}, NameIDFontFamily, "IPA モナー ゴシック"},
+		{"microsoft before mac", []nameRecord{mac(1, "Mac"), ms(0x411, 1, "ＭＳ ゴシック")}, NameIDFontFamily, "ＭＳ ゴシック"},
+		{"english before japanese", []nameRecord{ms(0x411, 4, "ＭＳ ゴシック"), ms(0x409, 4, "MS Gothic")}, NameIDFontFullName, "MS Gothic"},
+		{"unicode", []nameRecord{mac(1, "Mac"), {0, 3, 0, 1, "Unicode"}}, NameIDFontFamily, "Unicode"},
+		{"surrogates", []nameRecord{ms(0x409, 1, "Emoji 😀")}, NameIDFontFamily, "Emoji 😀"},
+		{"mac not ascii", []nameRecord{mac(1, "Caf\x8e")}, NameIDFontFamily, ""},
+		{"mac japanese", []nameRecord{{1, 1, 11, 1, "\x82\xa0"}}, NameIDFontFamily, ""},
+		{"missing", []nameRecord{mac(1, "Mac")}, NameIDFontSubfamily, ""},
+	}
+	for _, tt := range tests {
+		f := &Font{name: nameTable(tt.records...)}
+		if got := f.Name(tt.id); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestNameTruncated checks that a truncated name table gives no names or
+// those whose records and strings are whole, and does not panic.
+func TestNameTruncated(t *testing.T) {
+	b := nameTable(nameRecord{1, 0, 0, 1, "Mac"}, nameRecord{3, 1, 0x409, 1, "Windows"})
+	for n := 0; n < len(b); n++ {
+		f := &Font{name: b[:n]}
+		if got := f.Name(NameIDFontFamily); got != "" && got != "Mac" {
+			t.Errorf("%d bytes: got %q", n, got)
+		}
+	}
+	// Only the Windows string is cut.
+	if got := (&Font{name: b[:len(b)-1]}).Name(NameIDFontFamily); got != "Mac" {
+		t.Errorf("cut Windows string: got %q, want Mac", got)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/shaping.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FontInfo{
+		Family:         "Shaping",
+		Style:          "Regular",
+		FullName:       "Shaping Regular",
+		PostScriptName: "Shaping-Regular",
+		Weight:         400,
+		Width:          5,
+		UnitsPerEm:     1000,
+		Ascender:       880,
+		Descender:      -120,
+	}
+	if got := f.Info(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if h := want.LineHeight(); h != 1000 {
+		t.Errorf("LineHeight: got %d, want 1000", h)
+	}
+
+	// The typographic family and style come before the others.
+	f.name = nameTable(
+		nameRecord{3, 1, 0x409, NameIDFontFamily, "Shaping Light"},
+		nameRecord{3, 1, 0x409, NameIDFontSubfamily, "Regular"},
+		nameRecord{3, 1, 0x409, NameIDTypographicFamily, "Shaping"},
+		nameRecord{3, 1, 0x409, NameIDTypographicSubfamily, "Light"},
+	)
+	if info := f.Info(); info.Family != "Shaping" || info.Style != "Light" {
+		t.Errorf("typographic names: got %q %q", info.Family, info.Style)
+	}
+}
@@ -0,0 +1,695 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements the common parts of the OpenType Layout tables, GSUB
+// and GPOS, and shaping with them. The tables are documented at
+// http://www.microsoft.com/typography/otspec/chapter2.htm
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A GlyphPos is a glyph of a shaped string, and where to draw it.
+type GlyphPos struct {
+	Index Index
+	// Cluster is the byte offset in the string of the first rune which the
+	// glyph was made from. Glyphs made from the same runes, such as a
+	// ligature or the parts of a decomposed character, share a cluster.
+	Cluster int
+	// XAdvance and YAdvance are how far the pen moves after the glyph, and
+	// XOffset and YOffset move the glyph away from the pen. Like other
+	// lengths, they are scaled, with positive Y going upwards.
+	XAdvance, YAdvance, XOffset, YOffset int32
+}
+
+// ShapeOptions choose the OpenType features that Shape applies.
+type ShapeOptions struct {
+	// Script and Language are OpenType tags, such as "kana" and "JAN".
+	// By default, the script is that of the first letter of the string,
+	// and the language is the script's default.
+	Script, Language string
+	// Features lists features to turn on besides the defaults, such as
+	// "palt" for proportional Japanese punctuation, or to turn off with a
+	// "-" in front, such as "-liga".
+	Features []string
+	// Vertical lays the string out from top to bottom, with the vertical
+	// forms of the vert or vrt2 feature.
+	Vertical bool
+}
+
+// defaultFeatures are the features which Shape applies unless turned off.
+// Kerning and proportional widths are changed to their vertical versions
+// for vertical text.
+var defaultFeatures = []string{"ccmp", "locl", "liga", "kern", "mark", "mkmk"}
+
+// An otTable is an OpenType Layout table. Reads beyond the end return
+// zero, so that a malformed table stops matching rather than panicking.
+type otTable []byte
+
+func (t otTable) u16(i int) uint16 {
+	if i < 0 || i+2 > len(t) {
+		return 0
+	}
+	return u16(t, i)
+}
+
+func (t otTable) u32(i int) uint32 {
+	if i < 0 || i+4 > len(t) {
+		return 0
+	}
+	return u32(t, i)
+}
+
+// offset returns the table at the 16-bit offset at t[i:], or nil if the
+// offset is null.
+func (t otTable) offset(i int) otTable {
+	o := int(t.u16(i))
+	if o == 0 || o >= len(t) {
+		return nil
+	}
+	return t[o:]
+}
+
+func (t otTable) tag(i int) string {
+	if i < 0 || i+4 > len(t) {
+		return ""
+	}
+	return string(t[i : i+4])
+}
+
+// coverage returns the coverage index of g in the Coverage table t, or -1
+// if g is not covered.
+func (t otTable) coverage(g Index) int {
+	switch t.u16(0) {
+	case 1:
+		n := int(t.u16(2))
+		i := sort.Search(n, func(i int) bool { return Index(t.u16(4+2*i)) >= g })
+		if i < n && Index(t.u16(4+2*i)) == g {
+			return i
+		}
+	case 2:
+		n := int(t.u16(2))
+		i := sort.Search(n, func(i int) bool { return Index(t.u16(4+6*i+2)) >= g })
+		if i < n && Index(t.u16(4+6*i)) <= g {
+			return int(t.u16(4+6*i+4)) + int(g) - int(t.u16(4+6*i))
+		}
+	}
+	return -1
+}
+
+// class returns the class of g in the ClassDef table t. Glyphs which are
+// not listed are in class 0.
+func (t otTable) class(g Index) int {
+	switch t.u16(0) {
+	case 1:
+		start, n := Index(t.u16(2)), int(t.u16(4))
+		if start <= g && int(g-start) < n {
+			return int(t.u16(6 + 2*int(g-start)))
+		}
+	case 2:
+		n := int(t.u16(2))
+		i := sort.Search(n, func(i int) bool { return Index(t.u16(4+6*i+2)) >= g })
+		if i < n && Index(t.u16(4+6*i)) <= g {
+			return int(t.u16(4 + 6*i + 4))
+		}
+	}
+	return 0
+}
+
+// Glyph classes of the GDEF table.
+const (
+	gdefBase     = 1
+	gdefLigature = 2
+	gdefMark     = 3
+)
+
+// Lookup flags.
+const (
+	lookupIgnoreBaseGlyphs    = 0x0002
+	lookupIgnoreLigatures     = 0x0004
+	lookupIgnoreMarks         = 0x0008
+	lookupUseMarkFilteringSet = 0x0010
+	lookupMarkAttachmentType  = 0xff00
+)
+
+// maxNesting limits how deep contextual lookups may call other lookups.
+const maxNesting = 8
+
+// A shapeGlyph is a glyph in the middle of shaping. Lengths are in FUnits.
+type shapeGlyph struct {
+	GlyphPos
+	// ligID is non-zero for a ligature and the marks inside it, and
+	// ligComp is which component of the ligature such a mark belongs to,
+	// counting from 1.
+	ligID, ligComp int
+	// nComp is the number of components of a ligature.
+	nComp int
+	// attach is the position of the glyph a mark is attached to, or -1.
+	attach int
+}
+
+// An applyFunc applies a subtable of the given lookup type at position i
+// of the buffer. It returns the position to carry on from, or -1 if the
+// subtable does not apply there.
+type applyFunc func(lookupType int, st otTable, i int) int
+
+// A shaper applies the lookups of a GSUB or GPOS table to a string.
+type shaper struct {
+	f        *Font
+	vertical bool
+	buf      []shapeGlyph
+	gdef     otTable
+	// table is the GSUB or GPOS table, lookups is its LookupList and
+	// extension is its lookup type which points to another subtable.
+	table, lookups otTable
+	extension      int
+	apply          applyFunc
+	// flag and markSet are the lookup flag and mark filtering set of the
+	// lookup being applied.
+	flag      uint16
+	markSet   otTable
+	nextLigID int
+	nesting   int
+}
+
+// Shape converts s to glyphs and positions them, applying the font's
+// GSUB and GPOS features. Without a GPOS kern feature, the kern table is
+// used. opt may be nil for the default features of horizontal text.
+func (f *Font) Shape(scale int32, s string, opt *ShapeOptions) []GlyphPos {
+	if opt == nil {
+		opt = &ShapeOptions{}
+	}
+	sh := &shaper{f: f, vertical: opt.Vertical, gdef: otTable(f.gdef)}
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if IsVariationSelector(r) {
+			i += n
+			continue
+		}
+		g := shapeGlyph{GlyphPos: GlyphPos{Cluster: i}, attach: -1}
+		if vs, m := utf8.DecodeRuneInString(s[i+n:]); IsVariationSelector(vs) {
+			g.Index = f.IndexVariant(r, vs)
+			n += m
+		} else {
+			g.Index = f.Index(r)
+		}
+		sh.buf = append(sh.buf, g)
+		i += n
+	}
+	script := opt.Script
+	if script == "" {
+		script = scriptOf(s)
+	}
+	enabled := features(opt)
+
+	sh.setTable(otTable(f.gsub), 7, sh.applySubst)
+	if ls := sh.langSys(script, opt.Language); ls != nil {
+		// vrt2 replaces vert in the fonts which have it.
+		if enabled["vert"] && len(sh.featureLookups(ls, map[string]bool{"vrt2": true})) > 0 {
+			enabled["vert"], enabled["vrt2"] = false, true
+		}
+		for _, l := range sh.featureLookups(ls, enabled) {
+			sh.applyLookup(l)
+		}
+	}
+
+	for i := range sh.buf {
+		g := &sh.buf[i]
+		if opt.Vertical {
+			g.YAdvance = -f.unscaledVMetric(g.Index, f.glyphYMax(g.Index)).AdvanceHeight
+		} else {
+			g.XAdvance = f.unscaledHMetric(g.Index).AdvanceWidth
+		}
+	}
+
+	sh.setTable(otTable(f.gpos), 9, sh.applyPos)
+	kerned := false
+	if ls := sh.langSys(script, opt.Language); ls != nil {
+		kerned = len(sh.featureLookups(ls, map[string]bool{"kern": true})) > 0
+		for _, l := range sh.featureLookups(ls, enabled) {
+			sh.applyLookup(l)
+		}
+	}
+	if !kerned && enabled["kern"] && f.nKern > 0 {
+		for i := 0; i+1 < len(sh.buf); i++ {
+			sh.buf[i].XAdvance += f.Kerning(f.fUnitsPerEm, sh.buf[i].Index, sh.buf[i+1].Index)
+		}
+	}
+	sh.positionMarks()
+
+	glyphs := make([]GlyphPos, len(sh.buf))
+	for i, g := range sh.buf {
+		glyphs[i] = GlyphPos{
+			Index:    g.Index,
+			Cluster:  g.Cluster,
+			XAdvance: f.scale(scale * g.XAdvance),
+			YAdvance: f.scale(scale * g.YAdvance),
+			XOffset:  f.scale(scale * g.XOffset),
+			YOffset:  f.scale(scale * g.YOffset),
+		}
+	}
+	return glyphs
+}
+
+// features returns the features to apply with opt.
+func features(opt *ShapeOptions) map[string]bool {
+	enabled := make(map[string]bool)
+	for _, f := range defaultFeatures {
+		enabled[f] = true
+	}
+	enabled["vert"] = opt.Vertical
+	for _, f := range opt.Features {
+		if len(f) > 0 && f[0] == '-' {
+			enabled[f[1:]] = false
+		} else {
+			enabled[f] = true
+		}
+	}
+	if opt.Vertical {
+		enabled["vkrn"], enabled["kern"] = enabled["kern"], false
+		enabled["vpal"], enabled["palt"] = enabled["palt"], false
+	}
+	return enabled
+}
+
+// scriptTags are the OpenType tags of the scripts which scriptOf detects.
+var scriptTags = []struct {
+	table *unicode.RangeTable
+	tag   string
+}{
+	{unicode.Latin, "latn"},
+	{unicode.Hiragana, "kana"},
+	{unicode.Katakana, "kana"},
+	{unicode.Han, "hani"},
+	{unicode.Hangul, "hang"},
+	{unicode.Greek, "grek"},
+	{unicode.Cyrillic, "cyrl"},
+	{unicode.Arabic, "arab"},
+	{unicode.Hebrew, "hebr"},
+	{unicode.Thai, "thai"},
+}
+
+// scriptOf returns the tag of the script of the first letter of s, or ""
+// if it is not one which is known.
+func scriptOf(s string) string {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, st := range scriptTags {
+			if unicode.Is(st.table, r) {
+				return st.tag
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// setTable prepares sh to apply the lookups of a GSUB or GPOS table.
+func (sh *shaper) setTable(t otTable, extension int, apply applyFunc) {
+	sh.table, sh.lookups = t, nil
+	if len(t) >= 10 {
+		sh.lookups = t.offset(8)
+	}
+	sh.extension, sh.apply = extension, apply
+}
+
+// langSys returns the LangSys table for the given script and language,
+// falling back on the default script and language.
+func (sh *shaper) langSys(script, language string) otTable {
+	if len(sh.table) < 10 {
+		return nil
+	}
+	scripts := sh.table.offset(4)
+	n := int(scripts.u16(0))
+	find := func(tag string) otTable {
+		for i := 0; i < n; i++ {
+			if scripts.tag(2+6*i) == tag {
+				return scripts.offset(2 + 6*i + 4)
+			}
+		}
+		return nil
+	}
+	var st otTable
+	for _, tag := range []string{script, "DFLT", "dflt", "latn"} {
+		if len(tag) == 4 {
+			if st = find(tag); st != nil {
+				break
+			}
+		}
+	}
+	if st == nil {
+		return nil
+	}
+	if language != "" {
+		for len(language) < 4 {
+			language += " "
+		}
+		for i, m := 0, int(st.u16(2)); i < m; i++ {
+			if st.tag(4+6*i) == language {
+				if ls := st.offset(4 + 6*i + 4); ls != nil {
+					return ls
+				}
+			}
+		}
+	}
+	return st.offset(0)
+}
+
+// featureLookups returns the indexes of the lookups of the features which
+// are enabled in the LangSys table ls, in the order to apply them.
+func (sh *shaper) featureLookups(ls otTable, enabled map[string]bool) []int {
+	features := sh.table.offset(6)
+	nFeatures := int(features.u16(0))
+	seen := make(map[int]bool)
+	var lookups []int
+	add := func(fi int) {
+		if fi >= nFeatures || !enabled[features.tag(2+6*fi)] {
+			return
+		}
+		ft := features.offset(2 + 6*fi + 4)
+		for i, n := 0, int(ft.u16(2)); i < n; i++ {
+			l := int(ft.u16(4 + 2*i))
+			if !seen[l] {
+				seen[l] = true
+				lookups = append(lookups, l)
+			}
+		}
+	}
+	if req := ls.u16(2); req != 0xffff {
+		add(int(req))
+	}
+	for i, n := 0, int(ls.u16(4)); i < n; i++ {
+		add(int(ls.u16(6 + 2*i)))
+	}
+	sort.Ints(lookups)
+	return lookups
+}
+
+// lookup returns the Lookup table with the given index.
+func (sh *shaper) lookup(l int) otTable {
+	if l >= int(sh.lookups.u16(0)) {
+		return nil
+	}
+	return sh.lookups.offset(2 + 2*l)
+}
+
+// applyLookup applies lookup l to every glyph of the buffer in turn.
+func (sh *shaper) applyLookup(l int) {
+	lt := sh.lookup(l)
+	if lt == nil {
+		return
+	}
+	sh.setFlag(lt)
+	for i := 0; i < len(sh.buf); {
+		if sh.ignored(i) {
+			i++
+		} else if next := sh.applyAt(lt, i); next > i {
+			i = next
+		} else {
+			i++
+		}
+	}
+}
+
+// setFlag makes the lookup flag of the Lookup table lt the current one.
+func (sh *shaper) setFlag(lt otTable) {
+	sh.flag, sh.markSet = lt.u16(2), nil
+	if sh.flag&lookupUseMarkFilteringSet == 0 || sh.gdef.u32(0) < 0x00010002 {
+		return
+	}
+	set := int(lt.u16(6 + 2*int(lt.u16(4))))
+	sets := sh.gdef.offset(12)
+	if o := int(sets.u32(4 + 4*set)); set < int(sets.u16(2)) && o > 0 && o < len(sets) {
+		sh.markSet = sets[o:]
+	}
+}
+
+// applyAt applies the first subtable of the Lookup table lt which matches
+// at position i.
+func (sh *shaper) applyAt(lt otTable, i int) int {
+	lookupType := int(lt.u16(0))
+	for j, n := 0, int(lt.u16(4)); j < n; j++ {
+		st := lt.offset(6 + 2*j)
+		t := lookupType
+		if t == sh.extension && st.u16(0) == 1 {
+			t = int(st.u16(2))
+			ext := int(st.u32(4))
+			if ext <= 0 || ext >= len(st) {
+				continue
+			}
+			st = st[ext:]
+		}
+		if next := sh.apply(t, st, i); next >= 0 {
+			return next
+		}
+	}
+	return -1
+}
+
+// glyphClass returns the GDEF class of the glyph at position i.
+func (sh *shaper) glyphClass(i int) int {
+	return sh.gdef.offset(4).class(sh.buf[i].Index)
+}
+
+// ignored returns whether the current lookup skips the glyph at
+// position i.
+func (sh *shaper) ignored(i int) bool {
+	switch sh.glyphClass(i) {
+	case gdefBase:
+		return sh.flag&lookupIgnoreBaseGlyphs != 0
+	case gdefLigature:
+		return sh.flag&lookupIgnoreLigatures != 0
+	case gdefMark:
+		if sh.flag&lookupIgnoreMarks != 0 {
+			return true
+		}
+		if sh.flag&lookupUseMarkFilteringSet != 0 {
+			return sh.markSet.coverage(sh.buf[i].Index) < 0
+		}
+		if t := sh.flag & lookupMarkAttachmentType; t != 0 {
+			return sh.gdef.offset(10).class(sh.buf[i].Index) != int(t>>8)
+		}
+	}
+	return false
+}
+
+// next returns the position of the first glyph after i which the current
+// lookup does not skip, or -1.
+func (sh *shaper) next(i int) int {
+	for i++; i < len(sh.buf); i++ {
+		if !sh.ignored(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prev returns the position of the last glyph before i which the current
+// lookup does not skip, or -1.
+func (sh *shaper) prev(i int) int {
+	for i--; i >= 0; i-- {
+		if !sh.ignored(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// A glyphMatcher tells whether a glyph matches the k'th item of a
+// sequence of a contextual lookup.
+type glyphMatcher func(k int, g Index) bool
+
+// matchContext matches a rule of a contextual lookup at position i: n
+// input glyphs starting at i, nb backtrack glyphs before them, closest
+// first, and nl lookahead glyphs after them. It returns the positions of
+// the input glyphs, or nil if the rule does not match.
+func (sh *shaper) matchContext(i, n, nb, nl int, input, backtrack, lookahead glyphMatcher) []int {
+	if n == 0 || !input(0, sh.buf[i].Index) {
+		return nil
+	}
+	pos := []int{i}
+	j := i
+	for k := 1; k < n; k++ {
+		if j = sh.next(j); j < 0 || !input(k, sh.buf[j].Index) {
+			return nil
+		}
+		pos = append(pos, j)
+	}
+	for k, b := 0, i; k < nb; k++ {
+		if b = sh.prev(b); b < 0 || !backtrack(k, sh.buf[b].Index) {
+			return nil
+		}
+	}
+	for k := 0; k < nl; k++ {
+		if j = sh.next(j); j < 0 || !lookahead(k, sh.buf[j].Index) {
+			return nil
+		}
+	}
+	return pos
+}
+
+// applyNested applies the count SequenceLookupRecords at t[x:] to the
+// matched input glyphs at pos, and returns the position after them.
+func (sh *shaper) applyNested(t otTable, x, count int, pos []int) int {
+	end := pos[len(pos)-1] + 1
+	if sh.nesting >= maxNesting {
+		return end
+	}
+	sh.nesting++
+	flag, markSet := sh.flag, sh.markSet
+	for k := 0; k < count; k++ {
+		seq, lt := int(t.u16(x+4*k)), sh.lookup(int(t.u16(x+4*k+2)))
+		if seq >= len(pos) || lt == nil {
+			continue
+		}
+		n := len(sh.buf)
+		sh.setFlag(lt)
+		sh.applyAt(lt, pos[seq])
+		// Substitutions may have changed the length of the buffer. Move
+		// the later positions along with it.
+		if d := len(sh.buf) - n; d != 0 {
+			for m := seq + 1; m < len(pos); m++ {
+				pos[m] += d
+			}
+			end += d
+		}
+	}
+	sh.flag, sh.markSet = flag, markSet
+	sh.nesting--
+	return end
+}
+
+// applyContext applies a contextual (GSUB 5, GPOS 7) or chaining
+// contextual (GSUB 6, GPOS 8) subtable at position i. The two only differ
+// in the backtrack and lookahead sequences of the chaining ones.
+func (sh *shaper) applyContext(chain bool, st otTable, i int) int {
+	g := sh.buf[i].Index
+	switch st.u16(0) {
+	case 1:
+		// Rules for sequences of glyphs.
+		ci := st.offset(2).coverage(g)
+		if ci < 0 || ci >= int(st.u16(4)) {
+			return -1
+		}
+		return sh.applyRuleSet(chain, st.offset(6+2*ci), i, nil)
+	case 2:
+		// Rules for sequences of glyph classes.
+		if st.offset(2).coverage(g) < 0 {
+			return -1
+		}
+		var classDefs [3]otTable
+		x := 6
+		if chain {
+			classDefs = [3]otTable{st.offset(4), st.offset(6), st.offset(8)}
+			x = 10
+		} else {
+			cd := st.offset(4)
+			classDefs = [3]otTable{cd, cd, cd}
+		}
+		c := classDefs[1].class(g)
+		if c >= int(st.u16(x)) {
+			return -1
+		}
+		return sh.applyRuleSet(chain, st.offset(x+2+2*c), i, classDefs[:])
+	case 3:
+		// One rule of coverage tables.
+		covAt := func(x int) glyphMatcher {
+			return func(k int, g Index) bool { return st.offset(x+2*k).coverage(g) >= 0 }
+		}
+		if !chain {
+			n, count := int(st.u16(2)), int(st.u16(4))
+			pos := sh.matchContext(i, n, 0, 0, covAt(6), nil, nil)
+			if pos == nil {
+				return -1
+			}
+			return sh.applyNested(st, 6+2*n, count, pos)
+		}
+		nb := int(st.u16(2))
+		x := 4 + 2*nb
+		n := int(st.u16(x))
+		y := x + 2 + 2*n
+		nl := int(st.u16(y))
+		z := y + 2 + 2*nl
+		pos := sh.matchContext(i, n, nb, nl, covAt(x+2), covAt(4), covAt(y+2))
+		if pos == nil {
+			return -1
+		}
+		return sh.applyNested(st, z+2, int(st.u16(z)), pos)
+	}
+	return -1
+}
+
+// applyRuleSet applies the first rule of a RuleSet table of format 1 or 2
+// which matches at position i. The rules hold glyphs, or classes of the
+// backtrack, input and lookahead classDefs if they are given. The first
+// input glyph of a rule is matched by the coverage table instead.
+func (sh *shaper) applyRuleSet(chain bool, set otTable, i int, classDefs []otTable) int {
+	seq := func(t otTable, x, part int) glyphMatcher {
+		if classDefs == nil {
+			return func(k int, g Index) bool { return Index(t.u16(x+2*k)) == g }
+		}
+		cd := classDefs[part]
+		return func(k int, g Index) bool { return cd.class(g) == int(t.u16(x+2*k)) }
+	}
+	for r, nr := 0, int(set.u16(0)); r < nr; r++ {
+		rule := set.offset(2 + 2*r)
+		if rule == nil {
+			continue
+		}
+		// The sequences are a count followed by glyphs or classes. The
+		// input sequence leaves out its first glyph, and so starts 2 bytes
+		// early for matcher k to be at x+2*k.
+		var nb, n, nl, count, records int
+		var backtrack, input, lookahead glyphMatcher
+		if chain {
+			nb = int(rule.u16(0))
+			backtrack = seq(rule, 2, 0)
+			x := 2 + 2*nb
+			n = int(rule.u16(x))
+			input = seq(rule, x, 1)
+			y := x + 2 + 2*(n-1)
+			nl = int(rule.u16(y))
+			lookahead = seq(rule, y+2, 2)
+			z := y + 2 + 2*nl
+			count, records = int(rule.u16(z)), z+2
+		} else {
+			// A Rule has the count of SequenceLookupRecords before the
+			// input sequence.
+			n, count = int(rule.u16(0)), int(rule.u16(2))
+			input = seq(rule, 2, 1)
+			records = 4 + 2*(n-1)
+		}
+		rest := input
+		input = func(k int, g Index) bool { return k == 0 || rest(k, g) }
+		if pos := sh.matchContext(i, n, nb, nl, input, backtrack, lookahead); pos != nil {
+			return sh.applyNested(rule, records, count, pos)
+		}
+	}
+	return -1
+}
+
+// positionMarks moves the marks attached to other glyphs from their own
+// pen positions to those of the glyphs they are attached to.
+func (sh *shaper) positionMarks() {
+	for i := range sh.buf {
+		g := &sh.buf[i]
+		j := g.attach
+		if j < 0 || j >= i {
+			continue
+		}
+		g.XOffset += sh.buf[j].XOffset
+		g.YOffset += sh.buf[j].YOffset
+		for k := j; k < i; k++ {
+			g.XOffset -= sh.buf[k].XAdvance
+			g.YOffset -= sh.buf[k].YAdvance
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+//go:generate go run testdata/makefont.go
+
+// Glyphs of testdata/shaping.ttf.
+const (
+	shapeF         = 1
+	shapeI         = 2
+	shapeFI        = 3
+	shapeA         = 4
+	shapeV         = 5
+	shapeComma     = 6
+	shapeCommaVert = 7
+	shapeParen     = 8
+	shapeKana      = 9
+)
+
+var shapeTests = []struct {
+	s    string
+	opt  *ShapeOptions
+	want []GlyphPos
+}{
+	// liga
+	{"fi", nil, []GlyphPos{{Index: shapeFI, XAdvance: 520}}},
+	{"fi", &ShapeOptions{Features: []string{"-liga"}}, []GlyphPos{
+		{Index: shapeF, XAdvance: 300},
+		{Index: shapeI, Cluster: 1, XAdvance: 250},
+	}},
+	// kern
+	{"AV", nil, []GlyphPos{
+		{Index: shapeA, XAdvance: 520},
+		{Index: shapeV, Cluster: 1, XAdvance: 600},
+	}},
+	{"VA", nil, []GlyphPos{
+		{Index: shapeV, XAdvance: 600},
+		{Index: shapeA, Cluster: 1, XAdvance: 600},
+	}},
+	{"AV", &ShapeOptions{Features: []string{"-kern"}}, []GlyphPos{
+		{Index: shapeA, XAdvance: 600},
+		{Index: shapeV, Cluster: 1, XAdvance: 600},
+	}},
+	// palt is not on by default.
+	{"（あ", nil, []GlyphPos{
+		{Index: shapeParen, XAdvance: 1000},
+		{Index: shapeKana, Cluster: 3, XAdvance: 1000},
+	}},
+	{"（あ", &ShapeOptions{Features: []string{"palt"}}, []GlyphPos{
+		{Index: shapeParen, XAdvance: 500, XOffset: -500},
+		{Index: shapeKana, Cluster: 3, XAdvance: 1000},
+	}},
+	// vert, and palt becomes vpal in vertical text.
+	{"、", nil, []GlyphPos{{Index: shapeComma, XAdvance: 1000}}},
+	{"、", &ShapeOptions{Vertical: true}, []GlyphPos{{Index: shapeCommaVert, YAdvance: -1000}}},
+	{"（、", &ShapeOptions{Vertical: true, Features: []string{"palt"}}, []GlyphPos{
+		{Index: shapeParen, YAdvance: -500},
+		{Index: shapeCommaVert, Cluster: 3, YAdvance: -1000},
+	}},
+	{"、", &ShapeOptions{Vertical: true, Features: []string{"-vert"}}, []GlyphPos{{Index: shapeComma, YAdvance: -1000}}},
+}
+
+func TestShape(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/shaping.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range shapeTests {
+		// At a scale of 1000, lengths are in FUnits.
+		got := f.Shape(1000, tt.s, tt.opt)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Shape(%q, %+v):\ngot  %+v\nwant %+v", tt.s, tt.opt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// A SegmentOp is the kind of a Segment.
+type SegmentOp uint32
+
+const (
+	// SegmentOpMoveTo starts a new contour at Args[0].
+	SegmentOpMoveTo SegmentOp = iota
+	// SegmentOpLineTo draws a straight line to Args[0].
+	SegmentOpLineTo
+	// SegmentOpQuadTo draws a quadratic Bézier curve with the control
+	// point Args[0] to Args[1].
+	SegmentOpQuadTo
+)
+
+// A Segment is one step of a glyph's outline. The Flags of its Args are
+// zero.
+type Segment struct {
+	Op   SegmentOp
+	Args [2]Point
+}
+
+// Outline returns the unhinted outline of the i'th glyph of f. scale is
+// the number of 26.6 fixed point units in 1 em, as for GlyphBuf.Load; with
+// a scale of f.FUnitsPerEm() the co-ordinates are in FUnits. Positive Y
+// goes upwards, and the glyph's origin is at (0, 0).
+func (f *Font) Outline(scale int32, i Index) ([]Segment, error) {
+	g := NewGlyphBuf()
+	if err := g.Load(f, scale, i, NoHinting); err != nil {
+		return nil, err
+	}
+	return g.Segments(nil), nil
+}
+
+// Segments appends the outline of the glyph loaded in g, which may be
+// hinted, to dst and returns the result. Each contour starts with a MoveTo,
+// and its last segment ends where it started.
+func (g *GlyphBuf) Segments(dst []Segment) []Segment {
+	e0 := 0
+	for _, e1 := range g.End {
+		dst = appendContour(dst, g.Point[e0:e1])
+		e0 = e1
+	}
+	return dst
+}
+
+// appendContour appends the segments of the closed contour ps to dst. Two
+// consecutive off-curve points imply an on-curve point half way between
+// them.
+func appendContour(dst []Segment, ps []Point) []Segment {
+	if len(ps) == 0 {
+		return dst
+	}
+	// The contour starts at its first on-curve point, or if it has none,
+	// between its last and first points.
+	first := -1
+	for k, p := range ps {
+		if p.Flags&flagOnCurve != 0 {
+			first = k
+			break
+		}
+	}
+	var start Point
+	if first < 0 {
+		start = midPoint(ps[len(ps)-1], ps[0])
+	} else {
+		start = Point{X: ps[first].X, Y: ps[first].Y}
+	}
+	dst = append(dst, Segment{Op: SegmentOpMoveTo, Args: [2]Point{start}})
+
+	var ctrl Point
+	off := false
+	add := func(p Point) {
+		q := Point{X: p.X, Y: p.Y}
+		switch {
+		case p.Flags&flagOnCurve == 0 && off:
+			m := midPoint(ctrl, q)
+			dst = append(dst, Segment{Op: SegmentOpQuadTo, Args: [2]Point{ctrl, m}})
+			ctrl = q
+		case p.Flags&flagOnCurve == 0:
+			ctrl, off = q, true
+		case off:
+			dst = append(dst, Segment{Op: SegmentOpQuadTo, Args: [2]Point{ctrl, q}})
+			off = false
+		default:
+			dst = append(dst, Segment{Op: SegmentOpLineTo, Args: [2]Point{q}})
+		}
+	}
+	for _, p := range ps[first+1:] {
+		add(p)
+	}
+	if first > 0 {
+		for _, p := range ps[:first] {
+			add(p)
+		}
+	}
+	start.Flags = flagOnCurve
+	add(start)
+	return dst
+}
+
+// midPoint returns the point half way between p and q.
+func midPoint(p, q Point) Point {
+	return Point{X: (p.X + q.X) / 2, Y: (p.Y + q.Y) / 2}
+}
@@ -0,0 +1,91 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"reflect"
+	"testing"
+)
+
+func on(x, y int32) Point  { return Point{X: x, Y: y, Flags: flagOnCurve} }
+func off(x, y int32) Point { return Point{X: x, Y: y} }
+
+func moveTo(x, y int32) Segment { return Segment{SegmentOpMoveTo, [2]Point{{X: x, Y: y}}} }
+func lineTo(x, y int32) Segment { return Segment{SegmentOpLineTo, [2]Point{{X: x, Y: y}}} }
+func quadTo(cx, cy, x, y int32) Segment {
+	return Segment{SegmentOpQuadTo, [2]Point{{X: cx, Y: cy}, {X: x, Y: y}}}
+}
+
+var segmentTests = []struct {
+	name   string
+	points []Point
+	want   []Segment
+}{
+	{
+		"implied on-curve point",
+		[]Point{on(0, 0), off(100, 0), off(200, 100), on(200, 200)},
+		[]Segment{moveTo(0, 0), quadTo(100, 0, 150, 50), quadTo(200, 100, 200, 200), lineTo(0, 0)},
+	},
+	{
+		"lines",
+		[]Point{on(0, 0), on(10, 0), on(10, 10)},
+		[]Segment{moveTo(0, 0), lineTo(10, 0), lineTo(10, 10), lineTo(0, 0)},
+	},
+	{
+		"starting off the curve",
+		[]Point{off(0, 0), on(10, 0), on(10, 10)},
+		[]Segment{moveTo(10, 0), lineTo(10, 10), quadTo(0, 0, 10, 0)},
+	},
+	{
+		"ending off the curve",
+		[]Point{on(0, 0), on(10, 0), off(10, 10)},
+		[]Segment{moveTo(0, 0), lineTo(10, 0), quadTo(10, 10, 0, 0)},
+	},
+	{
+		"all off the curve",
+		[]Point{off(0, 0), off(20, 0), off(20, 20), off(0, 20)},
+		[]Segment{moveTo(0, 10), quadTo(0, 0, 10, 0), quadTo(20, 0, 20, 10),
+			quadTo(20, 20, 10, 20), quadTo(0, 20, 0, 10)},
+	},
+}
+
+func TestSegments(t *testing.T) {
+	for _, tt := range segmentTests {
+		g := &GlyphBuf{Point: tt.points, End: []int{len(tt.points)}}
+		if got := g.Segments(nil); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// All the contours of a glyph, one after the other.
+	g := &GlyphBuf{}
+	var want []Segment
+	for _, tt := range segmentTests {
+		g.Point = append(g.Point, tt.points...)
+		g.End = append(g.End, len(g.Point))
+		want = append(want, tt.want...)
+	}
+	if got := g.Segments(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("all contours: got %v, want %v", got, want)
+	}
+}
+
+func TestOutline(t *testing.T) {
+	f := loadTestCFF(t, testCFF([]byte{14}, cffSquare), 2)
+	f.fUnitsPerEm, f.nHMetric = 1000, 1
+	f.hmtx = cat(be16(700), be16(0), be16(100))
+	segs, err := f.Outline(f.FUnitsPerEm(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{moveTo(100, 0), lineTo(600, 0), lineTo(600, 500), lineTo(100, 500), lineTo(100, 0)}
+	if !reflect.DeepEqual(segs, want) {
+		t.Errorf("got %v, want %v", segs, want)
+	}
+	if segs, err := f.Outline(f.FUnitsPerEm(), 0); err != nil || len(segs) != 0 {
+		t.Errorf(".notdef: got %v, %v, want no segments", segs, err)
+	}
+}
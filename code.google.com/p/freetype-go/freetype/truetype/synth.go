@@ -0,0 +1,119 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"math"
+)
+
+// These are the usual amounts of synthetic bold and oblique, for fonts
+// which have no such styles: contours moved out by a 48th of an em on each
+// side, and a slant of about 12 degrees.
+const (
+	EmboldenStrength = 1.0 / 24
+	ObliqueSlant     = 0.2126
+)
+
+// Embolden makes the glyph loaded in g bolder by moving the Points of its
+// contours out by strength/2, in the same 26.6 fixed point units as the
+// Points. Its advance width grows by strength, and it is moved right by
+// strength/2 so that it keeps its left side bearing.
+func (g *GlyphBuf) Embolden(strength int32) {
+	if strength == 0 || len(g.Point) == 0 {
+		return
+	}
+	// Outer contours go clockwise in TrueType glyphs and counter-clockwise
+	// in CFF ones, and the sign of the total area tells which.
+	area := 0.0
+	e0 := 0
+	for _, e1 := range g.End {
+		ps := g.Point[e0:e1]
+		for i := range ps {
+			p, q := ps[i], ps[(i+1)%len(ps)]
+			area += float64(p.X)*float64(q.Y) - float64(q.X)*float64(p.Y)
+		}
+		e0 = e1
+	}
+	dir := 1.0
+	if area < 0 {
+		dir = -1
+	}
+	s := float64(strength) / 2
+	old := append(g.tmp[:0], g.Point...)
+	e0 = 0
+	for _, e1 := range g.End {
+		ps := old[e0:e1]
+		n := len(ps)
+		for i := range ps {
+			// Move the point along the bisector of the normals of its
+			// edges, so that both edges move out by s.
+			ax, ay := normal(ps[(i+n-1)%n], ps[i], dir)
+			bx, by := normal(ps[i], ps[(i+1)%n], dir)
+			if ax == 0 && ay == 0 {
+				ax, ay = bx, by
+			} else if bx == 0 && by == 0 {
+				bx, by = ax, ay
+			}
+			// A sharp corner would go very far; limit it like a miter.
+			d := 1 + ax*bx + ay*by
+			if d < 0.25 {
+				d = 0.25
+			}
+			p := &g.Point[e0+i]
+			p.X = ps[i].X + int32(math.Floor(s*(ax+bx)/d+s+0.5))
+			p.Y = ps[i].Y + int32(math.Floor(s*(ay+by)/d+0.5))
+		}
+		e0 = e1
+	}
+	g.tmp = old
+	g.AdvanceWidth += strength
+	g.setBounds()
+}
+
+// normal returns the unit normal of the edge from p to q, pointing out of
+// a contour which goes counter-clockwise when dir is 1, or clockwise when
+// dir is -1. It is zero if p and q are the same point.
+func normal(p, q Point, dir float64) (x, y float64) {
+	dx, dy := float64(q.X-p.X), float64(q.Y-p.Y)
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return 0, 0
+	}
+	return dir * dy / l, -dir * dx / l
+}
+
+// Oblique slants the glyph loaded in g to the right, moving its Points
+// right by slant times their height above the baseline.
+func (g *GlyphBuf) Oblique(slant float64) {
+	if slant == 0 || len(g.Point) == 0 {
+		return
+	}
+	for i := range g.Point {
+		p := &g.Point[i]
+		p.X += int32(math.Floor(slant*float64(p.Y) + 0.5))
+	}
+	g.setBounds()
+}
+
+// setBounds sets g.B to the bounding box of g.Point.
+func (g *GlyphBuf) setBounds() {
+	b := Bounds{g.Point[0].X, g.Point[0].Y, g.Point[0].X, g.Point[0].Y}
+	for _, p := range g.Point[1:] {
+		if b.XMin > p.X {
+			b.XMin = p.X
+		}
+		if b.YMin > p.Y {
+			b.YMin = p.Y
+		}
+		if b.XMax < p.X {
+			b.XMax = p.X
+		}
+		if b.YMax < p.Y {
+			b.YMax = p.Y
+		}
+	}
+	g.B = b
+}
@@ -0,0 +1,84 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"reflect"
+	"testing"
+)
+
+// square returns the corners of the square from x0, y0 to x1, y1,
+// counter-clockwise, or clockwise if cw is true.
+func square(x0, y0, x1, y1 int32, cw bool) []Point {
+	ps := []Point{on(x0, y0), on(x1, y0), on(x1, y1), on(x0, y1)}
+	if cw {
+		ps[1], ps[3] = ps[3], ps[1]
+	}
+	return ps
+}
+
+func TestEmbolden(t *testing.T) {
+	tests := []struct {
+		name       string
+		point, end []Point
+	}{
+		{
+			"counter-clockwise",
+			square(0, 0, 1000, 1000, false),
+			// Out by 100 on every side, and right by 100.
+			square(0, -100, 1200, 1100, false),
+		},
+		{
+			"clockwise",
+			square(0, 0, 1000, 1000, true),
+			square(0, -100, 1200, 1100, true),
+		},
+		{
+			// The hole goes the other way, and gets smaller.
+			"hole",
+			append(square(0, 0, 1000, 1000, false), square(300, 300, 700, 700, true)...),
+			append(square(0, -100, 1200, 1100, false), square(500, 400, 700, 600, true)...),
+		},
+	}
+	for _, tt := range tests {
+		g := &GlyphBuf{AdvanceWidth: 1100, Point: tt.point, End: []int{4}}
+		if len(tt.point) == 8 {
+			g.End = []int{4, 8}
+		}
+		g.Embolden(200)
+		if !reflect.DeepEqual(g.Point, tt.end) {
+			t.Errorf("%s: got %v, want %v", tt.name, g.Point, tt.end)
+		}
+		if want := (Bounds{0, -100, 1200, 1100}); g.B != want {
+			t.Errorf("%s: got bounds %v, want %v", tt.name, g.B, want)
+		}
+		if g.AdvanceWidth != 1300 {
+			t.Errorf("%s: got advance %d, want 1300", tt.name, g.AdvanceWidth)
+		}
+	}
+
+	g := &GlyphBuf{AdvanceWidth: 1100, Point: square(0, 0, 1000, 1000, false), End: []int{4}}
+	g.Embolden(0)
+	if !reflect.DeepEqual(g.Point, square(0, 0, 1000, 1000, false)) || g.AdvanceWidth != 1100 {
+		t.Errorf("strength 0: got %v, advance %d", g.Point, g.AdvanceWidth)
+	}
+}
+
+func TestOblique(t *testing.T) {
+	g := &GlyphBuf{
+		Point: []Point{on(0, 0), off(100, -200), on(500, 1000), on(-300, 400)},
+		End:   []int{4},
+	}
+	g.Oblique(ObliqueSlant)
+	// x moves by ObliqueSlant*y, rounded, and y stays.
+	want := []Point{on(0, 0), off(57, -200), on(713, 1000), on(-215, 400)}
+	if !reflect.DeepEqual(g.Point, want) {
+		t.Errorf("got %v, want %v", g.Point, want)
+	}
+	if want := (Bounds{-215, -200, 713, 1000}); g.B != want {
+		t.Errorf("got bounds %v, want %v", g.B, want)
+	}
+}
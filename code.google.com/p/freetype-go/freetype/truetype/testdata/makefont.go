@@ -0,0 +1,278 @@
+// Copyright 2010 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// This program writes shaping.ttf, a font with no outlines but with the
+// GSUB and GPOS features which otl_test.go checks, and collection.ttc, a
+// TrueType Collection of it and a bold version of it:
+//
+//	liga: f i -> fi
+//	vert: 、 -> its vertical form
+//	kern: A V, 80 units closer
+//	palt: （ moved 500 units left and 500 units narrower
+//	vpal: （ 500 units shorter
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"sort"
+	"unicode/utf16"
+)
+
+// The glyphs, and the runes which map to them.
+const (
+	gNotdef = iota
+	gF
+	gI
+	gFI
+	gA
+	gV
+	gComma
+	gCommaVert
+	gParen
+	gKana
+	nGlyph
+)
+
+var runes = map[rune]int{
+	'A': gA, 'V': gV, 'f': gF, 'i': gI,
+	'、': gComma, 'あ': gKana, '（': gParen,
+}
+
+var advances = [nGlyph]int{500, 300, 250, 520, 600, 600, 1000, 1000, 1000, 1000}
+
+type buf struct{ bytes.Buffer }
+
+func (b *buf) u16(vs ...int) *buf {
+	for _, v := range vs {
+		binary.Write(b, binary.BigEndian, uint16(v))
+	}
+	return b
+}
+
+func (b *buf) u32(vs ...int) *buf {
+	for _, v := range vs {
+		binary.Write(b, binary.BigEndian, uint32(v))
+	}
+	return b
+}
+
+func (b *buf) tag(s string) *buf {
+	b.WriteString(s)
+	return b
+}
+
+// coverage returns a format 1 Coverage table of one glyph.
+func coverage(g int) []byte {
+	var b buf
+	return b.u16(1, 1, g).Bytes()
+}
+
+// layout returns a GSUB or GPOS table whose DFLT script has the features,
+// each of which is one lookup of one subtable.
+func layout(tags []string, lookupTypes []int, subtables [][]byte) []byte {
+	n := len(tags)
+	// The ScriptList: DFLT with a default LangSys of every feature.
+	var scripts buf
+	scripts.u16(1).tag("DFLT").u16(8)
+	scripts.u16(4, 0)
+	scripts.u16(0, 0xffff, n)
+	for i := 0; i < n; i++ {
+		scripts.u16(i)
+	}
+	// The FeatureList, with the Feature tables after the records.
+	var features buf
+	features.u16(n)
+	for i, tag := range tags {
+		features.tag(tag).u16(2 + 6*n + 6*i)
+	}
+	for i := range tags {
+		features.u16(0, 1, i)
+	}
+	// The LookupList, with the Lookup tables and their subtables after it.
+	var lookups buf
+	lookups.u16(n)
+	off := 2 + 2*n
+	for i := range tags {
+		lookups.u16(off)
+		off += 8 + len(subtables[i])
+	}
+	for i := range tags {
+		lookups.u16(lookupTypes[i], 0, 1, 8)
+		lookups.Write(subtables[i])
+	}
+	var b buf
+	b.u32(0x00010000)
+	b.u16(10, 10+scripts.Len(), 10+scripts.Len()+features.Len())
+	b.Write(scripts.Bytes())
+	b.Write(features.Bytes())
+	b.Write(lookups.Bytes())
+	return b.Bytes()
+}
+
+func gsub() []byte {
+	// LigatureSubstFormat1 of f i.
+	var liga buf
+	liga.u16(1, 8, 1, 14).Write(coverage(gF))
+	liga.u16(1, 4, gFI, 2, gI)
+	// SingleSubstFormat2 of 、.
+	var vert buf
+	vert.u16(2, 8, 1, gCommaVert).Write(coverage(gComma))
+	return layout([]string{"liga", "vert"}, []int{4, 1}, [][]byte{liga.Bytes(), vert.Bytes()})
+}
+
+func gpos() []byte {
+	// PairPosFormat1 of A V, with an XAdvance for A.
+	var kern buf
+	kern.u16(1, 12, 4, 0, 1, 18).Write(coverage(gA))
+	kern.u16(1, gV, -80)
+	// SinglePosFormat1 of （ with XPlacement and XAdvance.
+	var palt buf
+	palt.u16(1, 10, 5, -500, -500).Write(coverage(gParen))
+	// SinglePosFormat1 of （ with YAdvance.
+	var vpal buf
+	vpal.u16(1, 8, 8, -500).Write(coverage(gParen))
+	return layout([]string{"kern", "palt", "vpal"}, []int{2, 1, 1},
+		[][]byte{kern.Bytes(), palt.Bytes(), vpal.Bytes()})
+}
+
+func cmap() []byte {
+	var codes []int
+	for r := range runes {
+		codes = append(codes, int(r))
+	}
+	sort.Ints(codes)
+	codes = append(codes, 0xffff)
+	n := len(codes)
+	var b buf
+	b.u16(0, 1, 3, 1).u32(12)
+	b.u16(4, 16+8*n, 0, 2*n, 0, 0, 0)
+	b.u16(codes...)
+	b.u16(0)
+	b.u16(codes...)
+	for _, c := range codes {
+		if c == 0xffff {
+			b.u16(1)
+		} else {
+			b.u16(runes[rune(c)] - c)
+		}
+	}
+	for range codes {
+		b.u16(0)
+	}
+	return b.Bytes()
+}
+
+// name returns a name table with the family and style of the font, in
+// Mac Roman for the Macintosh and in UTF-16BE for Windows.
+func name(family, style string) []byte {
+	strs := []string{family, style, family + " " + style, family + "-" + style}
+	ids := []int{1, 2, 4, 6}
+	var records, data buf
+	for _, platform := range []int{1, 3} {
+		for i, str := range strs {
+			var b []byte
+			if platform == 1 {
+				records.u16(1, 0, 0)
+				b = []byte(str)
+			} else {
+				records.u16(3, 1, 0x409)
+				for _, u := range utf16.Encode([]rune(str)) {
+					b = append(b, byte(u>>8), byte(u))
+				}
+			}
+			records.u16(ids[i], len(b), data.Len())
+			data.Write(b)
+		}
+	}
+	n := 2 * len(strs)
+	var b buf
+	b.u16(0, n, 6+12*n)
+	b.Write(records.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+// tables returns the tables of the font with the given style. Bold fonts
+// have the bold bit of macStyle set.
+func tables(style string) map[string][]byte {
+	macStyle := 0
+	if style == "Bold" {
+		macStyle = 1
+	}
+	var head, hhea, hmtx, maxp, vhea, vmtx buf
+	head.u32(0x00010000, 0x00010000, 0, 0x5f0f3cf5).u16(0, 1000)
+	head.u32(0, 0, 0, 0).u16(0, -120, 1000, 880, macStyle, 8, 2, 0, 0)
+	hhea.u32(0x00010000).u16(880, -120, 0, 1000, 0, 0, 1000, 1, 0, 0, 0, 0, 0, 0, 0, nGlyph)
+	vhea.u32(0x00011000).u16(500, -500, 0, 1000, 0, 0, 1000, 1, 0, 0, 0, 0, 0, 0, 0, nGlyph)
+	for _, a := range advances {
+		hmtx.u16(a, 0)
+		vmtx.u16(1000, 0)
+	}
+	maxp.u32(0x00005000).u16(nGlyph)
+	return map[string][]byte{
+		"GPOS": gpos(),
+		"GSUB": gsub(),
+		"cmap": cmap(),
+		"head": head.Bytes(),
+		"hhea": hhea.Bytes(),
+		"hmtx": hmtx.Bytes(),
+		"maxp": maxp.Bytes(),
+		"name": name("Shaping", style),
+		"vhea": vhea.Bytes(),
+		"vmtx": vmtx.Bytes(),
+	}
+}
+
+// sfnt returns a font of the tables, which starts at base in its file.
+func sfnt(tables map[string][]byte, base int) []byte {
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var font, data buf
+	font.u32(0x00010000).u16(len(tags), 128, 3, len(tags)*16-128)
+	for _, tag := range tags {
+		t := tables[tag]
+		sum := 0
+		for i := 0; i < len(t); i += 4 {
+			var w [4]byte
+			copy(w[:], t[i:])
+			sum += int(binary.BigEndian.Uint32(w[:]))
+		}
+		font.tag(tag).u32(sum&0xffffffff, base+12+16*len(tags)+data.Len(), len(t))
+		data.Write(t)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+	font.Write(data.Bytes())
+	return font.Bytes()
+}
+
+func main() {
+	if err := ioutil.WriteFile("testdata/shaping.ttf", sfnt(tables("Regular"), 0), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	// A collection of the regular and the bold font.
+	const header = 12 + 4*2
+	regular := sfnt(tables("Regular"), header)
+	bold := sfnt(tables("Bold"), header+len(regular))
+	var ttc buf
+	ttc.tag("ttcf").u32(0x00010000, 2, header, header+len(regular))
+	ttc.Write(regular)
+	ttc.Write(bold)
+	if err := ioutil.WriteFile("testdata/collection.ttc", ttc.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
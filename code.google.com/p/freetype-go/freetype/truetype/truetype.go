@@ -3,7 +3,8 @@
 // FreeType License or the GNU General Public License version 2 (or
 // any later version), both of which can be found in the LICENSE file.
 
-// Package truetype provides a parser for the TTF and TTC file formats.
+// Package truetype provides a parser for the TTF and TTC file formats, and
+// for OpenType fonts with either TrueType or CFF outlines.
 // Those formats are documented at http://developer.apple.com/fonts/TTRefMan/
 // and http://www.microsoft.com/typography/otspec/
 //
@@ -20,6 +21,7 @@ package truetype
 
 import (
 	"fmt"
+	"sort"
 )
 
 // An Index is a Font's index of a rune.
@@ -61,6 +63,11 @@ func u32(b []byte, i int) uint32 {
 	return uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
 }
 
+// u24 returns the big-endian uint24 at b[i:].
+func u24(b []byte, i int) uint32 {
+	return uint32(b[i])<<16 | uint32(b[i+1])<<8 | uint32(b[i+2])
+}
+
 // u16 returns the big-endian uint16 at b[i:].
 func u16(b []byte, i int) uint16 {
 	return uint16(b[i])<<8 | uint16(b[i+1])
@@ -92,39 +99,48 @@ const (
 // A cm holds a parsed cmap entry.
 type cm struct {
 	start, end, delta, offset uint32
+	// constant is whether every rune in the range maps to the glyph delta,
+	// instead of to the rune plus delta.
+	constant bool
 }
 
 // A Font represents a Truetype font.
 type Font struct {
 	// Tables sliced from the TTF data. The different tables are documented
 	// at http://developer.apple.com/fonts/TTRefMan/RM06/Chap6.html
-	cmap, cvt, fpgm, glyf, hdmx, head, hhea, hmtx, kern, loca, maxp, os2, prep, vmtx []byte
+	cmap, cvt, fpgm, glyf, hdmx, head, hhea, hmtx, kern, loca, maxp, name, os2, prep, vhea, vmtx []byte
+	// Tables of color bitmaps.
+	cbdt, cblc, sbix []byte
+	// cffData is the CFF table of PostScript outlines, which replaces glyf.
+	cffData []byte
+	// OpenType Layout tables, for shaping.
+	gdef, gpos, gsub []byte
 
 	cmapIndexes []byte
+	// uvs is the format 14 cmap subtable of Unicode Variation Sequences.
+	uvs []byte
+	// symbol is whether the cmap is of the Microsoft Symbol encoding.
+	symbol bool
 
 	// Cached values derived from the raw ttf data.
 	cm                      []cm
 	locaOffsetFormat        int
 	nGlyph, nHMetric, nKern int
+	nVMetric                int
 	fUnitsPerEm             int32
 	bounds                  Bounds
+	cbdtStrikes             []bitmapStrike
+	cff                     *cff
+	sbixStrikes             []bitmapStrike
 	// Values from the maxp section.
 	maxTwilightPoints, maxStorage, maxFunctionDefs, maxStackElements uint16
 }
 
 func (f *Font) parseCmap() error {
 	const (
-		cmapFormat4         = 4
-		cmapFormat12        = 12
-		languageIndependent = 0
-
-		// A 32-bit encoding consists of a most-significant 16-bit Platform ID and a
-		// least-significant 16-bit Platform Specific ID. The magic numbers are
-		// specified at https://www.microsoft.com/typography/otspec/name.htm
-		unicodeEncoding         = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0)
-		microsoftSymbolEncoding = 0x00030000 // PID = 3 (Microsoft), PSID = 0 (Symbol)
-		microsoftUCS2Encoding   = 0x00030001 // PID = 3 (Microsoft), PSID = 1 (UCS-2)
-		microsoftUCS4Encoding   = 0x0003000a // PID = 3 (Microsoft), PSID = 10 (UCS-4)
+		cmapFormat4  = 4
+		cmapFormat12 = 12
+		cmapFormat13 = 13
 	)
 
 	if len(f.cmap) < 4 {
@@ -134,91 +150,123 @@ func (f *Font) parseCmap() error {
 	if len(f.cmap) < 8*nsubtab+4 {
 		return FormatError("cmap too short")
 	}
-	offset, found, x := 0, false, 4
-	for i := 0; i < nsubtab; i++ {
+	var subtables []cmapSubtable
+	for i, x := 0, 4; i < nsubtab; i, x = i+1, x+8 {
 		// We read the 16-bit Platform ID and 16-bit Platform Specific ID as a single uint32.
 		// All values are big-endian.
-		pidPsid, o := u32(f.cmap, x), u32(f.cmap, x+4)
-		x += 8
-		// We prefer the Unicode cmap encoding. Failing to find that, we fall
-		// back onto the Microsoft cmap encoding.
-		if pidPsid == unicodeEncoding {
-			offset, found = int(o), true
-			break
-
-		} else if pidPsid == microsoftSymbolEncoding ||
-			pidPsid == microsoftUCS2Encoding ||
-			pidPsid == microsoftUCS4Encoding {
-
-			offset, found = int(o), true
-			// We don't break out of the for loop, so that Unicode can override Microsoft.
+		pidPsid, offset := u32(f.cmap, x), int(u32(f.cmap, x+4))
+		if offset <= 0 || offset+2 > len(f.cmap) {
+			return FormatError("bad cmap offset")
+		}
+		if pidPsid == unicodeVariationEncoding {
+			if err := f.parseUVS(offset); err != nil {
+				return err
+			}
+			continue
+		}
+		if rank, encoding := cmapRank(pidPsid); rank > 0 {
+			subtables = append(subtables, cmapSubtable{rank, encoding, offset})
 		}
 	}
-	if !found {
+	if len(subtables) == 0 {
 		return UnsupportedError("cmap encoding")
 	}
-	if offset <= 0 || offset > len(f.cmap) {
-		return FormatError("bad cmap offset")
-	}
-
-	cmapFormat := u16(f.cmap, offset)
-	switch cmapFormat {
-	case cmapFormat4:
-		language := u16(f.cmap, offset+4)
-		if language != languageIndependent {
-			return UnsupportedError(fmt.Sprintf("language: %d", language))
+	sort.Stable(byRank(subtables))
+
+	// Use the best subtable in a format we know.
+	var err error
+	for _, st := range subtables {
+		offset := st.offset
+		cmapFormat := u16(f.cmap, offset)
+		switch {
+		case cmapFormat == cmapFormat4:
+			err = f.parseCmap4(offset)
+			if err == nil && st.encoding > cmapSymbol {
+				// The codes of a legacy encoding are converted to runes.
+				codes, glyphs := f.cmapCodes()
+				err = f.setMappings(codes, glyphs, st.encoding)
+			}
+		case (cmapFormat == cmapFormat12 || cmapFormat == cmapFormat13) && st.encoding <= cmapSymbol:
+			err = f.parseCmap12(offset, cmapFormat == cmapFormat13)
+		default:
+			var codes []uint32
+			var glyphs []Index
+			if codes, glyphs, err = f.cmapMappings(offset); err == nil {
+				err = f.setMappings(codes, glyphs, st.encoding)
+			}
 		}
-		segCountX2 := int(u16(f.cmap, offset+6))
-		if segCountX2%2 == 1 {
-			return FormatError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
+		if err == nil {
+			f.symbol = st.encoding == cmapSymbol
+			return nil
 		}
-		segCount := segCountX2 / 2
-		offset += 14
-		f.cm = make([]cm, segCount)
-		for i := 0; i < segCount; i++ {
-			f.cm[i].end = uint32(u16(f.cmap, offset))
-			offset += 2
+		if _, ok := err.(UnsupportedError); !ok {
+			return err
 		}
+	}
+	return err
+}
+
+// parseCmap4 parses a format 4 subtable, which maps segments of the BMP.
+func (f *Font) parseCmap4(offset int) error {
+	if offset+14 > len(f.cmap) {
+		return FormatError("cmap too short")
+	}
+	segCountX2 := int(u16(f.cmap, offset+6))
+	if segCountX2%2 == 1 {
+		return FormatError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
+	}
+	segCount := segCountX2 / 2
+	offset += 14
+	if offset+8*segCount+2 > len(f.cmap) {
+		return FormatError("cmap too short")
+	}
+	f.cm = make([]cm, segCount)
+	for i := 0; i < segCount; i++ {
+		f.cm[i].end = uint32(u16(f.cmap, offset))
 		offset += 2
-		for i := 0; i < segCount; i++ {
-			f.cm[i].start = uint32(u16(f.cmap, offset))
-			offset += 2
-		}
-		for i := 0; i < segCount; i++ {
-			f.cm[i].delta = uint32(u16(f.cmap, offset))
-			offset += 2
-		}
-		for i := 0; i < segCount; i++ {
-			f.cm[i].offset = uint32(u16(f.cmap, offset))
-			offset += 2
-		}
-		f.cmapIndexes = f.cmap[offset:]
-		return nil
+	}
+	offset += 2
+	for i := 0; i < segCount; i++ {
+		f.cm[i].start = uint32(u16(f.cmap, offset))
+		offset += 2
+	}
+	for i := 0; i < segCount; i++ {
+		f.cm[i].delta = uint32(u16(f.cmap, offset))
+		offset += 2
+	}
+	for i := 0; i < segCount; i++ {
+		f.cm[i].offset = uint32(u16(f.cmap, offset))
+		offset += 2
+	}
+	f.cmapIndexes = f.cmap[offset:]
+	return nil
+}
 
-	case cmapFormat12:
-		if u16(f.cmap, offset+2) != 0 {
-			return FormatError(fmt.Sprintf("cmap format: % x", f.cmap[offset:offset+4]))
-		}
-		length := u32(f.cmap, offset+4)
-		language := u32(f.cmap, offset+8)
-		if language != languageIndependent {
-			return UnsupportedError(fmt.Sprintf("language: %d", language))
-		}
-		nGroups := u32(f.cmap, offset+12)
-		if length != 12*nGroups+16 {
-			return FormatError("inconsistent cmap length")
-		}
-		offset += 16
-		f.cm = make([]cm, nGroups)
-		for i := uint32(0); i < nGroups; i++ {
-			f.cm[i].start = u32(f.cmap, offset+0)
-			f.cm[i].end = u32(f.cmap, offset+4)
+// parseCmap12 parses a format 12 or 13 subtable, which map groups of
+// runes to consecutive glyphs or, for format 13, to one glyph.
+func (f *Font) parseCmap12(offset int, constant bool) error {
+	if offset+16 > len(f.cmap) || u16(f.cmap, offset+2) != 0 {
+		return FormatError(fmt.Sprintf("cmap format: % x", f.cmap[offset:offset+4]))
+	}
+	length := u32(f.cmap, offset+4)
+	nGroups := u32(f.cmap, offset+12)
+	if length != 12*nGroups+16 || offset+int(length) > len(f.cmap) {
+		return FormatError("inconsistent cmap length")
+	}
+	offset += 16
+	f.cm = make([]cm, nGroups)
+	for i := uint32(0); i < nGroups; i++ {
+		f.cm[i].start = u32(f.cmap, offset+0)
+		f.cm[i].end = u32(f.cmap, offset+4)
+		if constant {
+			f.cm[i].delta = u32(f.cmap, offset+8)
+			f.cm[i].constant = true
+		} else {
 			f.cm[i].delta = u32(f.cmap, offset+8) - f.cm[i].start
-			offset += 12
 		}
-		return nil
+		offset += 12
 	}
-	return UnsupportedError(fmt.Sprintf("cmap format: %d", cmapFormat))
+	return nil
 }
 
 func (f *Font) parseHead() error {
@@ -252,6 +300,20 @@ func (f *Font) parseHhea() error {
 	return nil
 }
 
+func (f *Font) parseVhea() error {
+	if len(f.vhea) == 0 {
+		return nil
+	}
+	if len(f.vhea) != 36 {
+		return FormatError(fmt.Sprintf("bad vhea length: %d", len(f.vhea)))
+	}
+	f.nVMetric = int(u16(f.vhea, 34))
+	if 4*f.nVMetric+2*(f.nGlyph-f.nVMetric) > len(f.vmtx) {
+		return FormatError(fmt.Sprintf("bad vmtx length: %d", len(f.vmtx)))
+	}
+	return nil
+}
+
 func (f *Font) parseKern() error {
 	// Apple's TrueType documentation (http://developer.apple.com/fonts/TTRefMan/RM06/Chap6kern.html) says:
 	// "Previous versions of the 'kern' table defined both the version and nTables fields in the header
@@ -294,6 +356,12 @@ func (f *Font) parseKern() error {
 }
 
 func (f *Font) parseMaxp() error {
+	// Fonts with only bitmaps may have the short version 0.5 of maxp, which
+	// has nothing but the number of glyphs.
+	if len(f.maxp) == 6 && u32(f.maxp, 0) == 0x00005000 {
+		f.nGlyph = int(u16(f.maxp, 4))
+		return nil
+	}
 	if len(f.maxp) != 32 {
 		return FormatError(fmt.Sprintf("bad maxp length: %d", len(f.maxp)))
 	}
@@ -332,7 +400,15 @@ func (f *Font) FUnitsPerEm() int32 {
 
 // Index returns a Font's index for the given rune.
 func (f *Font) Index(x rune) Index {
-	c := uint32(x)
+	i := f.index(uint32(x))
+	if i == 0 && f.symbol && x < 0x100 {
+		// Symbol fonts put their characters at U+F000 to U+F0FF.
+		i = f.index(0xf000 + uint32(x))
+	}
+	return i
+}
+
+func (f *Font) index(c uint32) Index {
 	for i, j := 0, len(f.cm); i < j; {
 		h := i + (j-i)/2
 		cm := &f.cm[h]
@@ -340,10 +416,15 @@ func (f *Font) Index(x rune) Index {
 			j = h
 		} else if cm.end < c {
 			i = h + 1
+		} else if cm.constant {
+			return Index(cm.delta)
 		} else if cm.offset == 0 {
 			return Index(c + cm.delta)
 		} else {
 			offset := int(cm.offset) + 2*(h-len(f.cm)+int(c-cm.start))
+			if offset < 0 || offset+2 > len(f.cmapIndexes) {
+				return 0
+			}
 			return Index(u16(f.cmapIndexes, offset))
 		}
 	}
@@ -385,7 +466,14 @@ func (f *Font) unscaledVMetric(i Index, yMax int32) (v VMetric) {
 	if j < 0 || f.nGlyph <= j {
 		return VMetric{}
 	}
-	if 4*j+4 <= len(f.vmtx) {
+	if f.nVMetric > 0 {
+		if j >= f.nVMetric {
+			p := 4 * (f.nVMetric - 1)
+			return VMetric{
+				AdvanceHeight:  int32(u16(f.vmtx, p)),
+				TopSideBearing: int32(int16(u16(f.vmtx, p+2*(j-f.nVMetric)+4))),
+			}
+		}
 		return VMetric{
 			AdvanceHeight:  int32(u16(f.vmtx, 4*j)),
 			TopSideBearing: int32(int16(u16(f.vmtx, 4*j+2))),
@@ -410,10 +498,30 @@ func (f *Font) unscaledVMetric(i Index, yMax int32) (v VMetric) {
 	}
 }
 
+// glyphYMax returns the top of the nominal bounding box of the glyph with
+// the given index, or 0 if the glyph is empty.
+func (f *Font) glyphYMax(i Index) int32 {
+	j := int(i)
+	if j < 0 || f.nGlyph <= j || len(f.loca) == 0 {
+		return 0
+	}
+	var g0, g1 uint32
+	if f.locaOffsetFormat == locaOffsetFormatShort {
+		g0 = 2 * uint32(u16(f.loca, 2*j))
+		g1 = 2 * uint32(u16(f.loca, 2*j+2))
+	} else {
+		g0 = u32(f.loca, 4*j)
+		g1 = u32(f.loca, 4*j+4)
+	}
+	if g0+10 > g1 || int(g1) > len(f.glyf) {
+		return 0
+	}
+	return int32(int16(u16(f.glyf, int(g0)+8)))
+}
+
 // VMetric returns the vertical metrics for the glyph with the given index.
 func (f *Font) VMetric(scale int32, i Index) VMetric {
-	// TODO: should 0 be bounds.YMax?
-	v := f.unscaledVMetric(i, 0)
+	v := f.unscaledVMetric(i, f.glyphYMax(i))
 	v.AdvanceHeight = f.scale(scale * v.AdvanceHeight)
 	v.TopSideBearing = f.scale(scale * v.TopSideBearing)
 	return v
@@ -443,8 +551,89 @@ func (f *Font) Kerning(scale int32, i0, i1 Index) int32 {
 // Parse returns a new Font for the given TTF or TTC data.
 //
 // For TrueType Collections, the first font in the collection is parsed.
+// Use ParseCollection to choose another.
 func Parse(ttf []byte) (font *Font, err error) {
-	return parse(ttf, 0)
+	offsets, err := faceOffsets(ttf)
+	if err != nil {
+		return nil, err
+	}
+	return parse(ttf, offsets[0])
+}
+
+// A Collection is the fonts, or faces, of a TrueType Collection. A plain
+// TTF file is a collection of one face.
+type Collection struct {
+	ttf     []byte
+	offsets []int
+}
+
+// ParseCollection returns a new Collection for the given TTC or TTF data.
+// The faces are not parsed until they are asked for.
+func ParseCollection(ttf []byte) (*Collection, error) {
+	offsets, err := faceOffsets(ttf)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection{ttf, offsets}, nil
+}
+
+// NumFaces returns the number of faces in the collection.
+func (c *Collection) NumFaces() int {
+	return len(c.offsets)
+}
+
+// Font parses the i'th face of the collection.
+func (c *Collection) Font(i int) (*Font, error) {
+	if i < 0 || i >= len(c.offsets) {
+		return nil, FormatError(fmt.Sprintf("no such face: %d", i))
+	}
+	return parse(c.ttf, c.offsets[i])
+}
+
+// Names returns the full names of the faces in the collection, in order.
+func (c *Collection) Names() ([]string, error) {
+	names := make([]string, len(c.offsets))
+	for i := range c.offsets {
+		f, err := c.Font(i)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = f.Name(NameIDFontFullName)
+	}
+	return names, nil
+}
+
+// faceOffsets returns where the table directories of the faces in ttf
+// start. It is just 0 unless ttf is a TrueType Collection.
+func faceOffsets(ttf []byte) ([]int, error) {
+	if len(ttf) < 12 {
+		return nil, FormatError("TTF data is too short")
+	}
+	if u32(ttf, 0) != 0x74746366 { // "ttcf" as a big-endian uint32.
+		return []int{0}, nil
+	}
+	// Version 2.0 only adds a digital signature after the offsets.
+	switch ttcVersion := u32(ttf, 4); ttcVersion {
+	case 0x00010000, 0x00020000:
+		// No-op.
+	default:
+		return nil, FormatError("bad TTC version")
+	}
+	numFonts := int(u32(ttf, 8))
+	if numFonts <= 0 {
+		return nil, FormatError("bad number of TTC fonts")
+	}
+	if len(ttf[12:])/4 < numFonts {
+		return nil, FormatError("TTC offset table is too short")
+	}
+	offsets := make([]int, numFonts)
+	for i := range offsets {
+		offsets[i] = int(u32(ttf, 12+4*i))
+		if offsets[i] <= 0 || offsets[i] > len(ttf) {
+			return nil, FormatError("bad TTC offset")
+		}
+	}
+	return offsets, nil
 }
 
 func parse(ttf []byte, offset int) (font *Font, err error) {
@@ -455,51 +644,37 @@ func parse(ttf []byte, offset int) (font *Font, err error) {
 	originalOffset := offset
 	magic, offset := u32(ttf, offset), offset+4
 	switch magic {
-	case 0x00010000:
+	case 0x00010000, 0x4f54544f: // The latter is "OTTO", for CFF outlines.
 		// No-op.
 	case 0x74746366: // "ttcf" as a big-endian uint32.
-		if originalOffset != 0 {
-			err = FormatError("recursive TTC")
-			return
-		}
-		ttcVersion, offset := u32(ttf, offset), offset+4
-		if ttcVersion != 0x00010000 {
-			// TODO: support TTC version 2.0, once I have such a .ttc file to test with.
-			err = FormatError("bad TTC version")
-			return
-		}
-		numFonts, offset := int(u32(ttf, offset)), offset+4
-		if numFonts <= 0 {
-			err = FormatError("bad number of TTC fonts")
-			return
-		}
-		if len(ttf[offset:])/4 < numFonts {
-			err = FormatError("TTC offset table is too short")
-			return
-		}
-		// TODO: provide an API to select which font in a TrueType collection to return,
-		// not just the first one. This may require an API to parse a TTC's name tables,
-		// so users of this package can select the font in a TTC by name.
-		offset = int(u32(ttf, offset))
-		if offset <= 0 || offset > len(ttf) {
-			err = FormatError("bad TTC offset")
-			return
-		}
-		return parse(ttf, offset)
+		err = FormatError("recursive TTC")
+		return
 	default:
 		err = FormatError("bad TTF version")
 		return
 	}
-	n, offset := int(u16(ttf, offset)), offset+2
-	if len(ttf) < 16*n+12 {
+	n := int(u16(ttf, offset))
+	if len(ttf)-originalOffset < 16*n+12 {
 		err = FormatError("TTF data is too short")
 		return
 	}
 	f := new(Font)
 	// Assign the table slices.
 	for i := 0; i < n; i++ {
-		x := 16*i + 12
+		x := originalOffset + 16*i + 12
 		switch string(ttf[x : x+4]) {
+		case "CBDT":
+			f.cbdt, err = readTable(ttf, ttf[x+8:x+16])
+		case "CBLC":
+			f.cblc, err = readTable(ttf, ttf[x+8:x+16])
+		case "CFF ":
+			f.cffData, err = readTable(ttf, ttf[x+8:x+16])
+		case "GDEF":
+			f.gdef, err = readTable(ttf, ttf[x+8:x+16])
+		case "GPOS":
+			f.gpos, err = readTable(ttf, ttf[x+8:x+16])
+		case "GSUB":
+			f.gsub, err = readTable(ttf, ttf[x+8:x+16])
 		case "cmap":
 			f.cmap, err = readTable(ttf, ttf[x+8:x+16])
 		case "cvt ":
@@ -522,10 +697,16 @@ func parse(ttf []byte, offset int) (font *Font, err error) {
 			f.loca, err = readTable(ttf, ttf[x+8:x+16])
 		case "maxp":
 			f.maxp, err = readTable(ttf, ttf[x+8:x+16])
+		case "name":
+			f.name, err = readTable(ttf, ttf[x+8:x+16])
 		case "OS/2":
 			f.os2, err = readTable(ttf, ttf[x+8:x+16])
 		case "prep":
 			f.prep, err = readTable(ttf, ttf[x+8:x+16])
+		case "sbix":
+			f.sbix, err = readTable(ttf, ttf[x+8:x+16])
+		case "vhea":
+			f.vhea, err = readTable(ttf, ttf[x+8:x+16])
 		case "vmtx":
 			f.vmtx, err = readTable(ttf, ttf[x+8:x+16])
 		}
@@ -543,12 +724,26 @@ func parse(ttf []byte, offset int) (font *Font, err error) {
 	if err = f.parseCmap(); err != nil {
 		return
 	}
+	if len(f.cffData) > 0 {
+		if f.cff, err = parseCFF(f.cffData, f.nGlyph); err != nil {
+			return
+		}
+	}
 	if err = f.parseKern(); err != nil {
 		return
 	}
 	if err = f.parseHhea(); err != nil {
 		return
 	}
+	if err = f.parseVhea(); err != nil {
+		return
+	}
+	if err = f.parseCblc(); err != nil {
+		return
+	}
+	if err = f.parseSbix(); err != nil {
+		return
+	}
 	font = f
 	return
 }
@@ -0,0 +1,179 @@
+package lingrimagebot
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ChatAdapter connects the bot to a chat service which calls it with
+// webhooks: it reads the messages from the requests of the service and
+// answers them with the replies of the bot.
+type ChatAdapter interface {
+	// Decode returns the messages of r. Requests of the service itself,
+	// such as pings, are answered in w, and give no messages.
+	Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error)
+	// Reply answers the request of msgs with the replies to them.
+	Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string)
+}
+
+// ChatMessage is a message to the bot, on any service.
+type ChatMessage struct {
+	// Id identifies the message in the log.
+	Id      string
+	Channel string
+	User    string
+	// Text is what the user said, as in Lingr: "!komei text".
+	Text string
+	// Say posts text in the channel after the request is answered. It is
+	// nil if the service can not take replies later.
+	Say func(c Context, text string) error
+	// SayOnly is set if the request can not carry replies, and they must
+	// all be said with Say.
+	SayOnly bool
+
+	// queued counts the images which will be said later.
+	queued int
+}
+
+// statusError is an error in a request, with the status to answer it with.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.code, http.StatusText(e.code), e.msg)
+}
+
+func errForbidden(msg string) error {
+	return &statusError{http.StatusForbidden, msg}
+}
+
+// readBody reads the body of r and leaves a copy in its place, for adapters
+// which check signatures of the raw body.
+func readBody(r *http.Request) ([]byte, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// checkToken reports whether token is want, in constant time.
+func checkToken(token, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// Chat returns the handler for the endpoint of a.
+func (bot *Bot) Chat(a ChatAdapter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bot.serveChat(w, r, a)
+	})
+}
+
+func (bot *Bot) serveChat(w http.ResponseWriter, r *http.Request, a ChatAdapter) {
+	c := bot.NewContext(r)
+	msgs, err := a.Decode(c, w, r)
+	if err != nil {
+		c.Errorf("bad request from %s: %v", r.RemoteAddr, err)
+		if e, ok := err.(*statusError); ok {
+			http.Error(w, e.msg, e.code)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if msgs == nil {
+		return
+	}
+	var replies []string
+	for _, m := range msgs {
+		rs := bot.message(c, m)
+		if !m.SayOnly {
+			replies = append(replies, rs...)
+			continue
+		}
+		for _, s := range rs {
+			if err := m.Say(c, s); err != nil {
+				c.Errorf("event %s: say: %v", m.Id, err)
+			}
+		}
+	}
+	a.Reply(c, w, msgs, replies)
+}
+
+// JSONAdapter is a generic adapter for anything which can post JSON like
+// {"user": "...", "channel": "...", "text": "!komei text"}. The reply is
+// {"replies": ["...", ...]}.
+type JSONAdapter struct {
+	// Token, if set, must be given as "Authorization: Bearer <Token>".
+	Token string `json:"token"`
+}
+
+func (a *JSONAdapter) Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error) {
+	if a.Token != "" && !checkToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), a.Token) {
+		return nil, errForbidden("invalid token")
+	}
+	var req struct {
+		Id      string `json:"id"`
+		User    string `json:"user"`
+		Channel string `json:"channel"`
+		Text    string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return []*ChatMessage{{Id: req.Id, Channel: req.Channel, User: req.User, Text: req.Text}}, nil
+}
+
+func (a *JSONAdapter) Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string) {
+	if replies == nil {
+		replies = []string{}
+	}
+	writeJSON(w, map[string][]string{"replies": replies})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// postJSON posts v as JSON to url with client, and decodes the response
+// into res if it is not nil.
+func postJSON(client *http.Client, url string, header http.Header, v, res interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %d %s: %s", url, resp.StatusCode, http.StatusText(resp.StatusCode), strings.TrimSpace(string(body)))
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
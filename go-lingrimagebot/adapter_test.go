@@ -0,0 +1,73 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONAdapter(t *testing.T) {
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	request := func(auth, body string) *http.Request {
+		r := httptest.NewRequest("POST", "/json", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		return r
+	}
+	const komei = `{"id": "1", "user": "alice", "channel": "memes", "text": "!komei hello"}`
+	tests := []struct {
+		name  string
+		token string
+		r     *http.Request
+		code  int
+		want  []string
+	}{
+		{"token", "token", request("Bearer token", komei), http.StatusOK, []string{"https://example.com/"}},
+		{"wrong token", "token", request("Bearer wrong", komei), http.StatusForbidden, nil},
+		{"no token", "token", request("", komei), http.StatusForbidden, nil},
+		{"open", "", request("", komei), http.StatusOK, []string{"https://example.com/"}},
+		{"no command", "", request("", `{"text": "hello"}`), http.StatusOK, []string{}},
+		{"help", "", request("", `{"text": "!help"}`), http.StatusOK, []string{"コマンド: !help "}},
+		{"bad json", "", request("", `{"text": `), http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		bot.Chat(&JSONAdapter{Token: tt.token}).ServeHTTP(w, tt.r)
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var res struct {
+			Replies []string `json:"replies"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.Replies == nil || len(res.Replies) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, res.Replies, tt.want)
+			continue
+		}
+		for i, s := range res.Replies {
+			if !strings.HasPrefix(s, tt.want[i]) {
+				t.Errorf("%s: got %q, want %q", tt.name, res.Replies, tt.want)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	bot.Chat(&JSONAdapter{}).ServeHTTP(w, httptest.NewRequest("GET", "/json", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d", w.Code)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build appengine
+// +build appengine
+
+package lingrimagebot
+
+import (
+	"log"
+	"net/http"
+
+	"appengine"
+	"appengine/urlfetch"
+)
+
+type appengineContext struct {
+	appengine.Context
+}
+
+func newAppengineContext(r *http.Request) Context {
+	return appengineContext{appengine.NewContext(r)}
+}
+
+func (c appengineContext) Client() *http.Client {
+	return urlfetch.Client(c.Context)
+}
+
+func init() {
+	config, err := LoadConfig("config.json")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if config.Async {
+		// Goroutines can not outlive requests on App Engine.
+		log.Println("async is not supported on App Engine")
+		config.Async = false
+	}
+	if config.IRC != nil {
+		log.Println("irc is not supported on App Engine")
+		config.IRC = nil
+	}
+	bot, err := New(config)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	bot.NewContext = newAppengineContext
+	http.Handle("/", bot.Handler())
+}
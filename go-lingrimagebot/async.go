@@ -0,0 +1,102 @@
+package lingrimagebot
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// busyReply is returned to the room when the queue is full.
+const busyReply = "混雑しています。しばらくしてからもう一度どうぞ"
+
+// job is an image to render in the background for a message, and say
+// with the say function of the message.
+type job struct {
+	id   string
+	t    *Template
+	text string
+	say  func(c Context, text string) error
+}
+
+// queue renders images in the background and says their URLs in the
+// channel later, so that chat services do not wait for slow renders and
+// uploads.
+type queue struct {
+	jobs chan job
+	wg   sync.WaitGroup
+}
+
+// startQueue starts workers which render the images of the async mode, and
+// a queue of size jobs for them, with the defaults for zero values.
+func (bot *Bot) startQueue(workers, size int) {
+	if workers <= 0 {
+		workers = 2
+	}
+	if size <= 0 {
+		size = 64
+	}
+	bot.queue = &queue{jobs: make(chan job, size)}
+	bot.queue.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go bot.work()
+	}
+}
+
+// enqueue adds a job, and reports whether there was room for it.
+func (bot *Bot) enqueue(j job) bool {
+	select {
+	case bot.queue.jobs <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+func (bot *Bot) work() {
+	defer bot.queue.wg.Done()
+	// The request the job came with is over, so the worker has its own
+	// Context.
+	c := NewLogContext(nil)
+	for j := range bot.queue.jobs {
+		bot.do(c, j)
+	}
+}
+
+// do makes the image of j and says it. A panic in the upload backend is
+// said as a failure, and does not stop the worker.
+func (bot *Bot) do(c Context, j job) {
+	reply, err := bot.safeImage(c, j.t, j.text)
+	if err != nil {
+		c.Errorf("event %s: %v", j.id, err)
+		reply = failureReply + reason(err)
+	} else {
+		c.Infof("event %s: %s", j.id, reply)
+	}
+	if err = j.say(c, reply); err != nil {
+		c.Errorf("event %s: say: %v", j.id, err)
+	}
+}
+
+// safeImage is image, but returns a panic as an UploadError.
+func (bot *Bot) safeImage(c Context, t *Template, text string) (url string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = &UploadError{Backend: fmt.Sprintf("%T", bot.Uploader), Body: fmt.Sprintf("panic: %v\n%s", e, debug.Stack())}
+		}
+	}()
+	return bot.image(c, t, text)
+}
+
+// Close disconnects from IRC, waits for the jobs in the queue of the async
+// mode to be done and stops its workers. The bot must not be used
+// afterwards.
+func (bot *Bot) Close() error {
+	if bot.irc != nil {
+		bot.irc.close()
+	}
+	if bot.queue != nil {
+		close(bot.queue.jobs)
+		bot.queue.wg.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package lingrimagebot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestQueuePanic checks that a panic in the upload backend is said as a
+// failure, and that the worker goes on with the next job.
+func TestQueuePanic(t *testing.T) {
+	r := testRegistry(t)
+	bot := &Bot{
+		Templates: r,
+		Uploader: uploaderFunc(func(b []byte) (string, error) {
+			panic("nil map")
+		}),
+		NewContext: NewLogContext,
+	}
+	bot.startQueue(1, 0)
+
+	var mu sync.Mutex
+	var said []string
+	say := func(c Context, text string) error {
+		mu.Lock()
+		said = append(said, text)
+		mu.Unlock()
+		return nil
+	}
+	for _, text := range []string{"a", "b"} {
+		m := &ChatMessage{Id: text, Text: "!komei " + text, Say: say}
+		if got := bot.message(NewLogContext(nil), m); got != nil || m.queued != 1 {
+			t.Errorf("%s: got %q, %d queued", text, got, m.queued)
+		}
+	}
+	done := make(chan bool)
+	go func() {
+		bot.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queue is not done")
+	}
+	if len(said) != 2 {
+		t.Fatalf("said %q, want 2 failures", said)
+	}
+	for _, s := range said {
+		if s != failureReply+"upload failed" || strings.Contains(s, "nil map") {
+			t.Errorf("said %q", s)
+		}
+	}
+}
+
+// TestQueueTimeout checks that an upload backend which never answers does
+// not hold the worker for good.
+func TestQueueTimeout(t *testing.T) {
+	r := testRegistry(t)
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	httpClient = &http.Client{Timeout: 100 * time.Millisecond}
+
+	bot := &Bot{
+		Templates:  r,
+		Uploader:   &WebhookUploader{URL: ts.URL},
+		NewContext: NewLogContext,
+	}
+	bot.startQueue(1, 0)
+	said := make(chan string, 2)
+	say := func(c Context, text string) error {
+		said <- text
+		return nil
+	}
+	for _, text := range []string{"a", "b"} {
+		m := &ChatMessage{Id: text, Text: "!komei " + text, Say: say}
+		if got := bot.message(NewLogContext(nil), m); got != nil || m.queued != 1 {
+			t.Errorf("%s: got %q, %d queued", text, got, m.queued)
+		}
+	}
+	// The one worker gets to the second job after the first times out.
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-said:
+			if s != failureReply+"upload failed" {
+				t.Errorf("said %q", s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the worker is stuck after %d jobs", i)
+		}
+	}
+	bot.Close()
+}
+
+// TestAsyncConfig checks that the queue is started without Lingr, for the
+// other chat services.
+func TestAsyncConfig(t *testing.T) {
+	testRegistry(t)
+	bot, err := New(&Config{Async: true, Discord: &DiscordAdapter{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bot.Close()
+	if bot.queue == nil {
+		t.Error("no queue")
+	}
+}
@@ -0,0 +1,319 @@
+package lingrimagebot
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"code.google.com/p/freetype-go/freetype"
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// Command is a message to the bot: "!name [--option=value]... text". A
+// value may be quoted with double quotes, and "--" ends the options.
+type Command struct {
+	Name    string
+	Options map[string]string
+	Text    string
+	// Err is set if the options can not be parsed, such as when a quote is
+	// not closed. The command is answered with it.
+	Err error
+}
+
+// ParseCommand parses text as a command, and reports whether it is one.
+// The name must start with a letter or a digit, so that "!!" and "!?" are
+// not commands.
+func ParseCommand(text string) (*Command, bool) {
+	if !strings.HasPrefix(text, "!") {
+		return nil, false
+	}
+	s := text[1:]
+	r, _ := utf8.DecodeRuneInString(s)
+	if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+		return nil, false
+	}
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return &Command{Name: s}, true
+	}
+	cmd := &Command{Name: s[:i]}
+	s = s[i:]
+	for {
+		rest := strings.TrimLeftFunc(s, unicode.IsSpace)
+		if !strings.HasPrefix(rest, "--") {
+			break
+		}
+		rest = rest[2:]
+		if r, _ := utf8.DecodeRuneInString(rest); rest == "" || unicode.IsSpace(r) {
+			// "--" ends the options.
+			s = rest
+			break
+		}
+		name, value := rest, "true"
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			name, rest = rest[:i], rest[i:]
+		} else {
+			rest = ""
+		}
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i+1:]
+			if strings.HasPrefix(value, `"`) {
+				// The quoted value may have spaces: take up to the next quote.
+				q := value[1:] + rest
+				j := strings.Index(q, `"`)
+				if j < 0 {
+					cmd.Err = fmt.Errorf("unterminated quote in --%s", name)
+					return cmd, true
+				}
+				value, rest = q[:j], q[j+1:]
+			}
+		}
+		if cmd.Options == nil {
+			cmd.Options = make(map[string]string)
+		}
+		cmd.Options[name] = value
+		s = rest
+	}
+	// The text starts after one space, as it always has.
+	if _, n := utf8.DecodeRuneInString(s); n > 0 {
+		s = s[n:]
+	}
+	cmd.Text = s
+	return cmd, true
+}
+
+// A CommandFunc answers a command which is not a template, and returns the
+// replies.
+type CommandFunc func(c Context, m *ChatMessage, cmd *Command) []string
+
+type builtin struct {
+	usage string
+	f     CommandFunc
+}
+
+// Handle adds the command name, answered by f. usage is what !help shows
+// for it. It panics if name is taken by a template or another command.
+func (bot *Bot) Handle(name, usage string, f CommandFunc) {
+	if name == "help" || bot.Templates.Lookup(name) != nil || bot.commands[name] != nil {
+		panic("lingrimagebot: command " + name + " is already defined")
+	}
+	if bot.commands == nil {
+		bot.commands = make(map[string]*builtin)
+	}
+	bot.commands[name] = &builtin{usage, f}
+}
+
+// route answers the command cmd of m: !help, a command added with Handle,
+// or a template.
+func (bot *Bot) route(c Context, m *ChatMessage, cmd *Command) []string {
+	if cmd.Err != nil {
+		return []string{fmt.Sprintf("!%s: %v", cmd.Name, cmd.Err)}
+	}
+	if cmd.Name == "help" {
+		return []string{bot.help(cmd.Text)}
+	}
+	if b, ok := bot.commands[cmd.Name]; ok {
+		return b.f(c, m, cmd)
+	}
+	t := bot.Templates.Lookup(cmd.Name)
+	if t == nil {
+		return []string{fmt.Sprintf(unknownReply, cmd.Name)}
+	}
+	if cmd.Text == "" {
+		return []string{bot.Templates.Usage(t)}
+	}
+	t, err := bot.Templates.withOptions(t, cmd.Options)
+	if err != nil {
+		return []string{fmt.Sprintf("!%s: %v", cmd.Name, err)}
+	}
+	return bot.template(c, m, t, cmd.Text)
+}
+
+// unknownReply is answered to a command which does not exist.
+const unknownReply = "!%s というコマンドはありません。!help で一覧を表示します"
+
+// help returns the list of the commands, or the usage of the command name.
+func (bot *Bot) help(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "!")
+	if name == "" {
+		names := []string{"!help"}
+		for _, t := range bot.Templates.Templates() {
+			names = append(names, "!"+t.Name)
+		}
+		var extra []string
+		for name := range bot.commands {
+			extra = append(extra, "!"+name)
+		}
+		sort.Strings(extra)
+		names = append(names, extra...)
+		return "コマンド: " + strings.Join(names, " ") + "\n!help <コマンド> で使い方を表示します"
+	}
+	if name == "help" {
+		return "!help [コマンド]: コマンドの一覧か、その使い方を表示します"
+	}
+	if b, ok := bot.commands[name]; ok {
+		return "!" + name + " " + b.usage
+	}
+	if t := bot.Templates.Lookup(name); t != nil {
+		return bot.Templates.Usage(t)
+	}
+	return fmt.Sprintf(unknownReply, name)
+}
+
+// Options commands of templates take by default.
+var templateOptions = []string{"size", "color", "font"}
+
+// options returns the options t takes.
+func (t *Template) options() []string {
+	if t.Options != nil {
+		return t.Options
+	}
+	return templateOptions
+}
+
+// Usage returns how to call t, for !help.
+func (r *Registry) Usage(t *Template) string {
+	var b strings.Builder
+	b.WriteString("!" + t.Name)
+	for _, o := range t.options() {
+		switch o {
+		case "size":
+			fmt.Fprintf(&b, " [--size=%g]", t.Size)
+		case "color":
+			c := t.Color
+			if c == "" {
+				c = "black"
+			}
+			fmt.Fprintf(&b, " [--color=%s]", c)
+		case "font":
+			fmt.Fprintf(&b, " [--font=%s]", fontName(t.Font))
+		}
+	}
+	b.WriteString(" text")
+	if t.Description != "" {
+		b.WriteString(": " + t.Description)
+	}
+	if len(t.Aliases) > 0 {
+		b.WriteString("\n別名: !" + strings.Join(t.Aliases, " !"))
+	}
+	for _, o := range t.options() {
+		if o == "font" {
+			b.WriteString("\nフォント: " + strings.Join(r.fontNames(), " "))
+		}
+	}
+	return b.String()
+}
+
+// fontName returns the name of a font file for the font option: its base
+// name without the extension, and the face after '#' if any.
+func fontName(filename string) string {
+	face := ""
+	if i := strings.LastIndex(filename, "#"); i >= 0 {
+		filename, face = filename[:i], filename[i:]
+	}
+	base := path.Base(filename)
+	return strings.TrimSuffix(base, path.Ext(base)) + face
+}
+
+// fontFiles returns the file names of the fonts of the templates, sorted.
+func (r *Registry) fontFiles() []string {
+	var filenames []string
+	for filename := range r.fonts {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// fontNames returns the names of the fonts the font option can choose: the
+// fonts of all the templates.
+func (r *Registry) fontNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, filename := range r.fontFiles() {
+		if name := fontName(filename); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFontNames returns an error if two font files have the same name for
+// the font option.
+func (r *Registry) checkFontNames() error {
+	files := make(map[string]string)
+	for _, filename := range r.fontFiles() {
+		name := fontName(filename)
+		if other, ok := files[name]; ok && path.Clean(other) != path.Clean(filename) {
+			return fmt.Errorf("fonts %q and %q are both named %q", other, filename, name)
+		}
+		files[name] = filename
+	}
+	return nil
+}
+
+// withOptions returns a copy of t changed by the options of a command, or
+// t itself if there are none.
+func (r *Registry) withOptions(t *Template, opts map[string]string) (*Template, error) {
+	if len(opts) == 0 {
+		return t, nil
+	}
+	takes := make(map[string]bool)
+	for _, o := range t.options() {
+		takes[o] = true
+	}
+	c := *t
+	for name, value := range opts {
+		if !takes[name] {
+			return nil, fmt.Errorf("unknown option --%s", name)
+		}
+		switch name {
+		case "size":
+			size, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(size) || size < 4 || size > 4*t.Size {
+				return nil, fmt.Errorf("size must be from 4 to %g", 4*t.Size)
+			}
+			scale := size / t.Size
+			c.Size, c.MinSize, c.Pitch = size, t.MinSize*scale, t.Pitch*scale
+			if t.Canvas != nil {
+				canvas := *t.Canvas
+				canvas.LineHeight = int(math.Ceil(float64(canvas.LineHeight) * scale))
+				c.Canvas = &canvas
+			}
+		case "color":
+			color, err := parseColor(value)
+			if err != nil {
+				return nil, err
+			}
+			c.color = color
+		case "font":
+			font := r.lookupFont(value)
+			if font == nil {
+				return nil, fmt.Errorf("no font %q", value)
+			}
+			c.fonts = append(freetype.FontSet{{Font: font}}, t.fonts[1:]...)
+		}
+	}
+	return &c, nil
+}
+
+// lookupFont returns the font of the name given to the font option, or nil.
+// The name may be the file name too.
+func (r *Registry) lookupFont(name string) *truetype.Font {
+	if font, ok := r.fonts[name]; ok {
+		return font
+	}
+	for _, filename := range r.fontFiles() {
+		if name == fontName(filename) {
+			return r.fonts[filename]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package lingrimagebot
+
+import (
+	"fmt"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want *Command
+		err  string
+	}{
+		{"!komei hello", &Command{Name: "komei", Text: "hello"}, ""},
+		{"!komei", &Command{Name: "komei"}, ""},
+		{"!komei  two spaces", &Command{Name: "komei", Text: " two spaces"}, ""},
+		{"!komei --size=24 hello", &Command{Name: "komei", Options: map[string]string{"size": "24"}, Text: "hello"}, ""},
+		{"!komei --bold hello", &Command{Name: "komei", Options: map[string]string{"bold": "true"}, Text: "hello"}, ""},
+		{"!komei --bold", &Command{Name: "komei", Options: map[string]string{"bold": "true"}}, ""},
+		{`!komei --font="IPA Gothic" --color=red hello world`, &Command{Name: "komei", Options: map[string]string{"font": "IPA Gothic", "color": "red"}, Text: "hello world"}, ""},
+		{`!komei --color="" hello`, &Command{Name: "komei", Options: map[string]string{"color": ""}, Text: "hello"}, ""},
+		{"!komei -- --size=24", &Command{Name: "komei", Text: "--size=24"}, ""},
+		{"!komei --size=24 -- --hello", &Command{Name: "komei", Options: map[string]string{"size": "24"}, Text: "--hello"}, ""},
+		{"!komei hello --size=24", &Command{Name: "komei", Text: "hello --size=24"}, ""},
+		{"!komei\nhello", &Command{Name: "komei", Text: "hello"}, ""},
+		{"!公明 こんにちは", &Command{Name: "公明", Text: "こんにちは"}, ""},
+		{`!komei --color="red hello`, &Command{Name: "komei"}, "unterminated quote in --color"},
+		{"!!", nil, ""},
+		{"!?", nil, ""},
+		{"! komei", nil, ""},
+		{"!", nil, ""},
+		{"komei hello", nil, ""},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		cmd, ok := ParseCommand(tt.text)
+		if ok != (tt.want != nil) {
+			t.Errorf("%q: got %v, want %v", tt.text, ok, tt.want != nil)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err := ""
+		if cmd.Err != nil {
+			err = cmd.Err.Error()
+		}
+		if err != tt.err {
+			t.Errorf("%q: got error %q, want %q", tt.text, err, tt.err)
+		}
+		if tt.err != "" {
+			if cmd.Name != tt.want.Name {
+				t.Errorf("%q: got name %q, want %q", tt.text, cmd.Name, tt.want.Name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(cmd, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.text, cmd, tt.want)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	bot.Handle("ping", "で pong と答えます", func(c Context, m *ChatMessage, cmd *Command) []string {
+		return []string{"pong " + cmd.Text}
+	})
+	reply := func(text string) string {
+		return strings.Join(bot.message(NewLogContext(nil), &ChatMessage{Id: "1", Text: text}), "\n")
+	}
+	deris := reply("!deris hello")
+	if !strings.HasPrefix(deris, "https://example.com/") {
+		t.Fatalf("!deris: got %q", deris)
+	}
+	usage := bot.Templates.Usage(bot.Templates.Lookup("deris"))
+	tests := []struct {
+		text, want string
+	}{
+		// Aliases draw the same image.
+		{"!d hello", deris},
+		{"!redis hello", deris},
+		{"!deris", usage},
+		{"!nosuch hello", fmt.Sprintf(unknownReply, "nosuch")},
+		{"!help deris", usage},
+		{"!help !d", usage},
+		{"!help nosuch", fmt.Sprintf(unknownReply, "nosuch")},
+		{"!help help", "!help [コマンド]: コマンドの一覧か、その使い方を表示します"},
+		{"!help ping", "!ping で pong と答えます"},
+		{"!ping hi", "pong hi"},
+		{`!komei --color="red hello`, "!komei: unterminated quote in --color"},
+		{"!komei --bold hello", "!komei: unknown option --bold"},
+		{"!!", ""},
+		{"hello", ""},
+	}
+	for _, tt := range tests {
+		if got := reply(tt.text); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if !strings.Contains(usage, "別名: !d !redis") {
+		t.Errorf("usage: got %q", usage)
+	}
+	help := reply("!help")
+	if !strings.HasPrefix(help, "コマンド: !help !image !image_p !komei ") || !strings.Contains(help, " !deris ") || !strings.Contains(help, " !ping\n") {
+		t.Errorf("!help: got %q", help)
+	}
+}
+
+func TestLookupFont(t *testing.T) {
+	a, b, c := &truetype.Font{}, &truetype.Font{}, &truetype.Font{}
+	r := &Registry{fonts: map[string]*truetype.Font{
+		"font/ipag-mona.ttf":   a,
+		"./font/ipag-mona.ttf": b,
+		"font/ipagp-mona.ttf":  c,
+	}}
+	if err := r.checkFontNames(); err != nil {
+		t.Error(err)
+	}
+	if names := r.fontNames(); !reflect.DeepEqual(names, []string{"ipag-mona", "ipagp-mona"}) {
+		t.Errorf("got names %q", names)
+	}
+	tests := []struct {
+		name string
+		want *truetype.Font
+	}{
+		// The first file of the name, in sorted order.
+		{"ipag-mona", b},
+		{"font/ipag-mona.ttf", a},
+		{"./font/ipag-mona.ttf", b},
+		{"ipagp-mona", c},
+		{"ipag", nil},
+		{"ipag-mona.ttf", nil},
+	}
+	for i := 0; i < 10; i++ {
+		for _, tt := range tests {
+			if got := r.lookupFont(tt.name); got != tt.want {
+				t.Fatalf("%q: got %p, want %p", tt.name, got, tt.want)
+			}
+		}
+	}
+
+	r.fonts["other/ipag-mona.otf"] = &truetype.Font{}
+	if err := r.checkFontNames(); err == nil {
+		t.Error("two ipag-mona: got no error")
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	r := testRegistry(t)
+	komei := r.Lookup("komei")
+	tests := []struct {
+		opts map[string]string
+		err  string
+	}{
+		{map[string]string{"size": "4"}, ""},
+		{map[string]string{"size": "72"}, ""},
+		{map[string]string{"size": "3.9"}, "size must be from 4 to 72"},
+		{map[string]string{"size": "72.1"}, "size must be from 4 to 72"},
+		{map[string]string{"size": "NaN"}, "size must be from 4 to 72"},
+		{map[string]string{"size": "Inf"}, "size must be from 4 to 72"},
+		{map[string]string{"size": "big"}, "size must be from 4 to 72"},
+		{map[string]string{"color": "#cc0000"}, ""},
+		{map[string]string{"color": "red"}, `bad color: "red"`},
+		{map[string]string{"color": "#cc00"}, `bad color: "#cc00"`},
+		{map[string]string{"font": "ipagp-mona"}, ""},
+		{map[string]string{"font": "font/ipagp-mona.ttf"}, ""},
+		{map[string]string{"font": "comic-sans"}, `no font "comic-sans"`},
+		{map[string]string{"bold": "true"}, "unknown option --bold"},
+	}
+	for _, tt := range tests {
+		c, err := r.withOptions(komei, tt.opts)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%v: got %v, want %q", tt.opts, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.opts, err)
+			continue
+		}
+		if c == komei {
+			t.Errorf("%v: got the template itself", tt.opts)
+		}
+	}
+	if c, err := r.withOptions(komei, nil); c != komei || err != nil {
+		t.Errorf("no options: got %p, %v", c, err)
+	}
+
+	c, err := r.withOptions(komei, map[string]string{"size": "36", "color": "white", "font": "ipagp-mona"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Size != 36 || c.MinSize != 2*komei.MinSize || c.Pitch != 2*komei.Pitch {
+		t.Errorf("size 36: got size %g, min size %g, pitch %g", c.Size, c.MinSize, c.Pitch)
+	}
+	if c.color.C != image.White.C || c.fonts[0].Font != r.lookupFont("ipagp-mona") {
+		t.Error("color or font not set")
+	}
+	// The template is not changed.
+	if komei.Size != 18 || komei.fonts[0].Font != r.lookupFont("ipag-mona") {
+		t.Error("template changed")
+	}
+}
+
+// TestCanvasLimit checks that a long text at the biggest size does not
+// make a canvas bigger than maxCanvas.
+func TestCanvasLimit(t *testing.T) {
+	r := testRegistry(t)
+	tests := []struct {
+		name, text string
+	}{
+		{"wide", strings.Repeat("あ", maxText)},
+		{"tall", strings.Repeat("あ\n", maxText/2)},
+	}
+	for _, tt := range tests {
+		c, err := r.withOptions(r.Lookup("image"), map[string]string{"size": "84"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := c.Render(tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() > maxCanvas || b.Dy() > maxCanvas {
+			t.Errorf("%s: got %v", tt.name, b)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Config is the bot configuration read from config.json.
+type Config struct {
+	// Templates is the template manifest. The default is templates.json.
+	Templates string `json:"templates"`
+	// Uploader selects the upload backend: "gyazo" (default), "s3",
+	// "webhook" or "local".
+	Uploader string           `json:"uploader"`
+	Gyazo    *GyazoUploader   `json:"gyazo"`
+	S3       *S3Uploader      `json:"s3"`
+	Webhook  *WebhookUploader `json:"webhook"`
+	Local    *LocalUploader   `json:"local"`
+	Lingr    *LingrConfig     `json:"lingr"`
+	// Async makes the bot answer at once and post the images in the
+	// channel when they are uploaded, on the services which can take
+	// replies later. Workers images are made at a time (default 2), and
+	// up to Queue more wait (default 64).
+	Async   bool `json:"async"`
+	Workers int  `json:"workers"`
+	Queue   int  `json:"queue"`
+	// The other chat services the bot answers on, besides Lingr.
+	Slack      *SlackAdapter      `json:"slack"`
+	Discord    *DiscordAdapter    `json:"discord"`
+	Mattermost *MattermostAdapter `json:"mattermost"`
+	JSON       *JSONAdapter       `json:"json"`
+	IRC        *IRCConfig         `json:"irc"`
+}
+
+// LingrConfig is the bot as registered on Lingr.
+type LingrConfig struct {
+	// Token is in the query of the endpoint registered on Lingr, and only
+	// requests with it are answered.
+	Token string `json:"token"`
+	// Bot is the id of the bot, and Secret its secret key, for the say
+	// API.
+	Bot    string `json:"bot"`
+	Secret string `json:"secret"`
+	// SayURL is the say API, by default that of lingr.com. It is used in
+	// the async mode, when Bot and Secret are set.
+	SayURL string `json:"say_url"`
+}
+
+// LoadConfig reads the configuration. A missing file is not an error and
+// gives the default configuration.
+func LoadConfig(filename string) (*Config, error) {
+	var config Config
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &config, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	switch {
+	case config.Lingr != nil && config.Lingr.Token == "":
+		return nil, fmt.Errorf("%s: lingr: token is required", filename)
+	case config.Slack != nil && config.Slack.SigningSecret == "":
+		return nil, fmt.Errorf("%s: slack: signing_secret is required", filename)
+	case config.Mattermost != nil && config.Mattermost.Token == "":
+		return nil, fmt.Errorf("%s: mattermost: token is required", filename)
+	case config.IRC != nil && (config.IRC.Server == "" || config.IRC.Nick == ""):
+		return nil, fmt.Errorf("%s: irc: server and nick are required", filename)
+	}
+	return &config, nil
+}
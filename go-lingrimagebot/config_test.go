@@ -0,0 +1,35 @@
+package lingrimagebot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigSecrets(t *testing.T) {
+	tests := []struct {
+		config, err string
+	}{
+		{`{"lingr": {"bot": "bot", "secret": "secret"}}`, "lingr: token is required"},
+		{`{"slack": {"bot_token": "xoxb"}}`, "slack: signing_secret is required"},
+		{`{"slack": {"signing_secret": ""}}`, "slack: signing_secret is required"},
+		{`{"mattermost": {}}`, "mattermost: token is required"},
+		{`{"irc": {"nick": "imagebot"}}`, "irc: server and nick are required"},
+		{`{"irc": {"server": "irc.example.com:6697"}}`, "irc: server and nick are required"},
+		{`{"lingr": {"token": "t"}, "slack": {"signing_secret": "s"}, "mattermost": {"token": "t"}}`, ""},
+	}
+	filename := filepath.Join(t.TempDir(), "config.json")
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(filename, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(filename)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.config, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got %v, want %s", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package lingrimagebot
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Context is what the bot needs from the environment it runs on, for a
+// request.
+type Context interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// Client returns the HTTP client to call other services with.
+	Client() *http.Client
+}
+
+type logContext struct{}
+
+// httpClient is the client of a logContext. Its timeout keeps a service
+// which never answers from holding a worker of the async mode for good.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// NewLogContext returns a Context which logs with the log package and uses
+// httpClient. It is for running as a standalone server.
+func NewLogContext(r *http.Request) Context {
+	return logContext{}
+}
+
+func (c logContext) Infof(format string, args ...interface{}) {
+	log.Printf("INFO: "+format, args...)
+}
+
+func (c logContext) Errorf(format string, args ...interface{}) {
+	log.Printf("ERROR: "+format, args...)
+}
+
+func (c logContext) Client() *http.Client {
+	return httpClient
+}
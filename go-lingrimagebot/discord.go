@@ -0,0 +1,145 @@
+package lingrimagebot
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+// DiscordAdapter is the ChatAdapter of Discord interactions. A slash
+// command calls the template of its name with its "text" option, or with
+// its first option if it has no "text".
+type DiscordAdapter struct {
+	// PublicKey is the public key of the application, in hex.
+	PublicKey string `json:"public_key"`
+	// URL is the Discord API. The default is that of discord.com.
+	URL string `json:"url"`
+}
+
+// Types of interactions and of responses to them.
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+
+	discordPong                   = 1
+	discordChannelMessage         = 4
+	discordDeferredChannelMessage = 5
+)
+
+// discordEphemeral makes a message seen only by the user who called the bot.
+const discordEphemeral = 1 << 6
+
+// noCommandReply is answered when no template is called.
+const noCommandReply = "そのコマンドはありません"
+
+func (a *DiscordAdapter) Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if !a.verify(r, body) {
+		return nil, errForbidden("invalid signature")
+	}
+	var req struct {
+		Id            string `json:"id"`
+		ApplicationId string `json:"application_id"`
+		Type          int    `json:"type"`
+		Token         string `json:"token"`
+		ChannelId     string `json:"channel_id"`
+		Data          struct {
+			Name    string `json:"name"`
+			Options []struct {
+				Name  string      `json:"name"`
+				Value interface{} `json:"value"`
+			} `json:"options"`
+		} `json:"data"`
+		Member struct {
+			User discordUser `json:"user"`
+		} `json:"member"`
+		User discordUser `json:"user"`
+	}
+	if err = json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	switch req.Type {
+	case discordPing:
+		writeJSON(w, map[string]int{"type": discordPong})
+		return nil, nil
+	case discordApplicationCommand:
+	default:
+		return nil, &statusError{http.StatusBadRequest, "unknown interaction"}
+	}
+
+	text := ""
+	for i, o := range req.Data.Options {
+		if s, ok := o.Value.(string); ok && (o.Name == "text" || i == 0) {
+			text = s
+		}
+	}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "!") {
+		text = "!" + req.Data.Name + " " + text
+	}
+	user := req.Member.User.Username
+	if user == "" {
+		user = req.User.Username
+	}
+	followup := a.api() + "/webhooks/" + req.ApplicationId + "/" + req.Token
+	return []*ChatMessage{{
+		Id:      req.Id,
+		Channel: req.ChannelId,
+		User:    user,
+		Text:    text,
+		Say: func(c Context, text string) error {
+			return postJSON(c.Client(), followup, nil, map[string]string{"content": text}, nil)
+		},
+	}}, nil
+}
+
+type discordUser struct {
+	Username string `json:"username"`
+}
+
+func (a *DiscordAdapter) api() string {
+	if a.URL == "" {
+		return discordAPI
+	}
+	return a.URL
+}
+
+// verify reports whether the request with body is signed by the key of
+// the application.
+func (a *DiscordAdapter) verify(r *http.Request, body []byte) bool {
+	key, err := hex.DecodeString(a.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil {
+		return false
+	}
+	msg := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(ed25519.PublicKey(key), msg, sig)
+}
+
+func (a *DiscordAdapter) Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string) {
+	switch {
+	case len(replies) > 0:
+		writeJSON(w, map[string]interface{}{
+			"type": discordChannelMessage,
+			"data": map[string]string{"content": strings.Join(replies, "\n")},
+		})
+	case msgs[0].queued > 0:
+		// The images are sent later as follow-up messages.
+		writeJSON(w, map[string]int{"type": discordDeferredChannelMessage})
+	default:
+		writeJSON(w, map[string]interface{}{
+			"type": discordChannelMessage,
+			"data": map[string]interface{}{"content": noCommandReply, "flags": discordEphemeral},
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package lingrimagebot
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discordRequest returns an interaction request with body, signed with
+// key.
+func discordRequest(key ed25519.PrivateKey, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest("POST", "/discord", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Signature-Timestamp", ts)
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(ts+body))))
+	return r
+}
+
+// discordCommand is the interaction of the slash command /komei.
+const discordCommand = `{"id": "1", "application_id": "app", "type": 2, "token": "tok", "channel_id": "C1",
+	"data": {"name": "komei", "options": [{"name": "text", "value": "hello"}]},
+	"member": {"user": {"username": "alice"}}}`
+
+// discordResponse is the response to an interaction.
+type discordResponse struct {
+	Type int `json:"type"`
+	Data struct {
+		Content string `json:"content"`
+		Flags   int    `json:"flags"`
+	} `json:"data"`
+}
+
+func TestDiscord(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, wrong, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	h := bot.Chat(&DiscordAdapter{PublicKey: hex.EncodeToString(pub)})
+
+	tests := []struct {
+		name string
+		key  ed25519.PrivateKey
+		body string
+		code int
+		want discordResponse
+	}{
+		{"wrong signature", wrong, discordCommand, http.StatusForbidden, discordResponse{}},
+		{"ping", key, `{"id": "1", "type": 1}`, http.StatusOK, discordResponse{Type: discordPong}},
+		{"command", key, discordCommand, http.StatusOK, discordResponse{Type: discordChannelMessage}},
+		{"unknown interaction", key, `{"id": "1", "type": 3}`, http.StatusBadRequest, discordResponse{}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, discordRequest(tt.key, tt.body))
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var res discordResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.Type != tt.want.Type {
+			t.Errorf("%s: got type %d, want %d", tt.name, res.Type, tt.want.Type)
+		}
+		if res.Type == discordChannelMessage && !strings.HasPrefix(res.Data.Content, "https://example.com/") {
+			t.Errorf("%s: got %q", tt.name, res.Data.Content)
+		}
+	}
+
+	// A signature of another body.
+	r := discordRequest(key, `{"id": "1", "type": 1}`)
+	r.Body = discordRequest(key, discordCommand).Body
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("signature of another body: got %d", w.Code)
+	}
+}
+
+// TestDiscordAsync checks that a queued image is answered with a deferred
+// response, and sent later as a follow-up message.
+func TestDiscordAsync(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	followups := make(chan string, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&m)
+		followups <- r.URL.Path + " " + m.Content
+	}))
+	defer api.Close()
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	bot.startQueue(1, 0)
+	h := bot.Chat(&DiscordAdapter{PublicKey: hex.EncodeToString(pub), URL: api.URL})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, discordRequest(key, discordCommand))
+	var res discordResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != discordDeferredChannelMessage {
+		t.Errorf("got type %d, want %d", res.Type, discordDeferredChannelMessage)
+	}
+	select {
+	case f := <-followups:
+		if !strings.HasPrefix(f, "/webhooks/app/tok https://example.com/") {
+			t.Errorf("got follow-up %q", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no follow-up")
+	}
+
+	// An unknown command is answered at once.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, discordRequest(key, strings.Replace(discordCommand, `"komei"`, `"nosuch"`, 1)))
+	res = discordResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != discordChannelMessage || !strings.Contains(res.Data.Content, "!nosuch") {
+		t.Errorf("unknown command: got %+v", res)
+	}
+	// Text which is no command is answered to the user only.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, discordRequest(key, strings.Replace(discordCommand, `"hello"`, `"!!"`, 1)))
+	res = discordResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != discordChannelMessage || res.Data.Flags != discordEphemeral || res.Data.Content != noCommandReply {
+		t.Errorf("no command: got %+v", res)
+	}
+	bot.Close()
+}
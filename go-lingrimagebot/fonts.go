@@ -0,0 +1,62 @@
+package lingrimagebot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// FontFace is a face of a font file.
+type FontFace struct {
+	// Path is the name to use in the manifest. Faces of a collection have
+	// their index after '#'.
+	Path string
+	Info truetype.FontInfo
+}
+
+// ListFonts returns the faces of the font files in dir.
+func ListFonts(dir string) ([]FontFace, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var faces []FontFace
+	for _, fi := range files {
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".ttf", ".otf", ".ttc":
+		default:
+			continue
+		}
+		filename := filepath.Join(dir, fi.Name())
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		c, err := truetype.ParseCollection(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for i := 0; i < c.NumFaces(); i++ {
+			f, err := c.Font(i)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+			path := filepath.ToSlash(filename)
+			if c.NumFaces() > 1 {
+				path += fmt.Sprintf("#%d", i)
+			}
+			faces = append(faces, FontFace{path, f.Info()})
+		}
+	}
+	return faces, nil
+}
+
+// lineHeight returns the distance between baselines the font recommends,
+// at size.
+func lineHeight(font *truetype.Font, size float64) float64 {
+	info := font.Info()
+	return size * float64(info.LineHeight()) / float64(info.UnitsPerEm)
+}
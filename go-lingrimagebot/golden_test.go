@@ -0,0 +1,145 @@
+package lingrimagebot
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden images")
+
+// goldenInputs are the texts every template is rendered with.
+var goldenInputs = []struct {
+	name, text string
+}{
+	{"multi", "こんにちは\nworld\nテスト"},
+	{"cjk", "吾輩は猫である。名前はまだ無い。"},
+	{"long", "This is a very long line that will run off the edge of the picture 長い長い行ですよーーーー"},
+	{"empty", ""},
+}
+
+// goldenTolerance is the fraction of pixels allowed to differ.
+const goldenTolerance = 0.001
+
+// TestGolden renders every template in templates.json with goldenInputs
+// and compares them to testdata/golden/<template>-<input>.png. Run it with
+// -update to write the golden images instead, when a change is intended.
+// Images which do not match are written to the temporary directory.
+func TestGolden(t *testing.T) {
+	r := testRegistry(t)
+	actual := filepath.Join(os.TempDir(), "lingrimagebot-golden")
+	for _, tmpl := range r.Templates() {
+		for _, in := range goldenInputs {
+			name := tmpl.Name + "-" + in.name + ".png"
+			filename := filepath.Join("testdata", "golden", name)
+			img, err := tmpl.Render(in.text)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if *update {
+				if err := writePNG(filename, img); err != nil {
+					t.Error(err)
+				}
+				continue
+			}
+			golden, err := loadImage(filename)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			diff := compareImages(golden, img)
+			if diff <= goldenTolerance {
+				continue
+			}
+			out := filepath.Join(actual, name)
+			if err := writePNG(out, img); err != nil {
+				t.Error(err)
+			}
+			if diff == 1 {
+				t.Errorf("%s: size differs; got %s", name, out)
+			} else {
+				t.Errorf("%s: %.3f%% of pixels differ; got %s", name, 100*diff, out)
+			}
+		}
+	}
+}
+
+// testRegistry loads templates.json at the top of the repository, and
+// stays there until the test ends, as the fonts and images of the templates
+// are relative to it.
+func testRegistry(t *testing.T) *Registry {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	r, err := LoadRegistry("templates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func writePNG(filename string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compareImages returns the fraction of pixels in a and b which differ
+// perceptibly. Small differences, such as those from anti-aliasing, are
+// ignored. It returns 1 if the sizes differ.
+func compareImages(a, b image.Image) float64 {
+	// threshold is the luminance difference, out of 0xffff, below which
+	// two pixels are considered the same.
+	const threshold = 0x1000
+
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return 1
+	}
+	if ra.Empty() {
+		return 0
+	}
+	n := 0
+	for y := 0; y < ra.Dy(); y++ {
+		for x := 0; x < ra.Dx(); x++ {
+			la, aa := luminance(a, ra.Min.X+x, ra.Min.Y+y)
+			lb, ab := luminance(b, rb.Min.X+x, rb.Min.Y+y)
+			if abs(la-lb) > threshold || abs(aa-ab) > threshold {
+				n++
+			}
+		}
+	}
+	return float64(n) / float64(ra.Dx()*ra.Dy())
+}
+
+// luminance returns the ITU-R BT.601 luma and the alpha of the pixel, both
+// premultiplied and out of 0xffff.
+func luminance(img image.Image, x, y int) (int, int) {
+	r, g, b, a := img.At(x, y).RGBA()
+	return int((299*r + 587*g + 114*b) / 1000), int(a)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,283 @@
+package lingrimagebot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IRCConfig is the bot on an IRC network. Unlike the other chat services,
+// IRC does not call the bot: the bot connects to Server and stays in
+// Channels, and answers commands said there or to itself.
+type IRCConfig struct {
+	// Server is host:port of the server, and TLS connects to it with TLS.
+	Server string `json:"server"`
+	TLS    bool   `json:"tls"`
+	// Nick is the nickname of the bot, and Password the password of the
+	// server, if it has one.
+	Nick     string   `json:"nick"`
+	Password string   `json:"password"`
+	Channels []string `json:"channels"`
+}
+
+// ircMaxText is the longest text in a PRIVMSG, in bytes, which leaves room
+// for the prefix the server adds in the 512 bytes of a line.
+const ircMaxText = 400
+
+// ircRetry is how long the client waits before it connects again.
+const ircRetry = 30 * time.Second
+
+// ircClient keeps the bot connected to an IRC server.
+type ircClient struct {
+	bot    *Bot
+	config *IRCConfig
+	// dial connects to the server. It is replaced in tests.
+	dial func() (net.Conn, error)
+
+	// mu guards conn, which is written by the workers of the async mode
+	// too, and nick, which changes when the one of config is taken.
+	mu     sync.Mutex
+	conn   net.Conn
+	nick   string
+	closed bool
+	done   chan struct{}
+	// stopped is closed when run returns.
+	stopped chan struct{}
+	// wg counts the messages being answered.
+	wg sync.WaitGroup
+	// id numbers the messages in the log.
+	id int
+}
+
+func newIRCClient(bot *Bot, config *IRCConfig) *ircClient {
+	c := &ircClient{
+		bot:     bot,
+		config:  config,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	c.dial = func() (net.Conn, error) {
+		d := &net.Dialer{Timeout: 30 * time.Second}
+		if config.TLS {
+			return tls.DialWithDialer(d, "tcp", config.Server, nil)
+		}
+		return d.Dial("tcp", config.Server)
+	}
+	return c
+}
+
+// run connects to the server, and connects again after ircRetry when the
+// connection is lost, until close is called. It returns when the messages
+// being answered are done too.
+func (c *ircClient) run() {
+	defer close(c.stopped)
+	defer c.wg.Wait()
+	ctx := NewLogContext(nil)
+	for {
+		err := c.session(ctx)
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		ctx.Errorf("irc: %s: %v", c.config.Server, err)
+		select {
+		case <-c.done:
+			return
+		case <-time.After(ircRetry):
+		}
+	}
+}
+
+// close disconnects from the server and waits for run to return.
+func (c *ircClient) close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+		if c.conn != nil {
+			fmt.Fprintf(c.conn, "QUIT\r\n")
+			c.conn.Close()
+		}
+	}
+	c.mu.Unlock()
+	<-c.stopped
+}
+
+// session registers with the server and answers it until the connection
+// is lost.
+func (c *ircClient) session(ctx Context) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errors.New("closed")
+	}
+	c.conn, c.nick = conn, c.config.Nick
+	c.mu.Unlock()
+
+	if c.config.Password != "" {
+		c.send("PASS", c.config.Password)
+	}
+	c.send("NICK", c.config.Nick)
+	c.send("USER", c.config.Nick, "0", "*", "lingrimagebot")
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		prefix, command, params := parseIRC(s.Text())
+		switch command {
+		case "PING":
+			c.send("PONG", params...)
+		case "001":
+			for _, ch := range c.config.Channels {
+				c.send("JOIN", ch)
+			}
+		case "433":
+			// The nickname is taken.
+			c.mu.Lock()
+			c.nick += "_"
+			nick := c.nick
+			c.mu.Unlock()
+			c.send("NICK", nick)
+		case "PRIVMSG":
+			if len(params) == 2 {
+				// Answering may take long, and the server must have its
+				// PONG meanwhile.
+				c.wg.Add(1)
+				go func() {
+					defer c.wg.Done()
+					c.privmsg(ctx, prefix, params[0], params[1])
+				}()
+			}
+		}
+	}
+	if err = s.Err(); err == nil {
+		err = errors.New("connection closed")
+	}
+	return err
+}
+
+// privmsg answers text said by the user of prefix to target, a channel or
+// the bot.
+func (c *ircClient) privmsg(ctx Context, prefix, target, text string) {
+	if strings.HasPrefix(text, "\x01") {
+		// CTCP, such as ACTION.
+		return
+	}
+	user := prefix
+	if i := strings.IndexByte(user, '!'); i >= 0 {
+		user = user[:i]
+	}
+	to := target
+	if !strings.ContainsAny(target[:1], "#&+!") {
+		to = user
+	}
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.mu.Unlock()
+	m := &ChatMessage{
+		Id:      fmt.Sprintf("irc-%d", id),
+		Channel: to,
+		User:    user,
+		Text:    text,
+		SayOnly: true,
+		Say: func(ctx Context, text string) error {
+			return c.say(to, text)
+		},
+	}
+	for _, s := range c.bot.message(ctx, m) {
+		if err := m.Say(ctx, s); err != nil {
+			ctx.Errorf("event %s: say: %v", m.Id, err)
+		}
+	}
+}
+
+// say sends text to target, a line at a time.
+func (c *ircClient) say(target, text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if err := c.send("PRIVMSG", target, truncateBytes(line, ircMaxText)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a message to the server. The last parameter is sent as the
+// trailing one, which may have spaces.
+func (c *ircClient) send(command string, params ...string) error {
+	line := command
+	for i, p := range params {
+		if i == len(params)-1 {
+			line += " :" + p
+		} else {
+			line += " " + p
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("irc: not connected")
+	}
+	_, err := fmt.Fprintf(c.conn, "%s\r\n", line)
+	return err
+}
+
+// parseIRC splits a line from the server into its prefix, command and
+// parameters, the last of which may be the trailing one.
+func parseIRC(line string) (prefix, command string, params []string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		// Message tags.
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			line = strings.TrimLeft(line[i+1:], " ")
+		} else {
+			return "", "", nil
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return line[1:], "", nil
+		}
+		prefix, line = line[1:i], strings.TrimLeft(line[i+1:], " ")
+	}
+	var trailing *string
+	if i := strings.Index(line, " :"); i >= 0 {
+		t := line[i+2:]
+		trailing, line = &t, line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+	command, params = strings.ToUpper(fields[0]), fields[1:]
+	if trailing != nil {
+		params = append(params, *trailing)
+	}
+	return prefix, command, params
+}
+
+// truncateBytes cuts s to at most n bytes, at a rune boundary.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
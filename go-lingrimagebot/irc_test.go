@@ -0,0 +1,180 @@
+package lingrimagebot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIRC(t *testing.T) {
+	tests := []struct {
+		line, prefix, command string
+		params                []string
+	}{
+		{"PING :irc.example.com", "", "PING", []string{"irc.example.com"}},
+		{":alice!a@host PRIVMSG #memes :!komei hello world\r\n", "alice!a@host", "PRIVMSG", []string{"#memes", "!komei hello world"}},
+		{":irc.example.com 001 bot :Welcome to IRC", "irc.example.com", "001", []string{"bot", "Welcome to IRC"}},
+		{"@time=2024-01-01T00:00:00Z :alice PRIVMSG bot :hi", "alice", "PRIVMSG", []string{"bot", "hi"}},
+		{":alice  privmsg  #memes  :a :b", "alice", "PRIVMSG", []string{"#memes", "a :b"}},
+		{":alice JOIN #memes", "alice", "JOIN", []string{"#memes"}},
+		{"PRIVMSG #memes :", "", "PRIVMSG", []string{"#memes", ""}},
+		{"", "", "", nil},
+		{":alice", "alice", "", nil},
+	}
+	for _, tt := range tests {
+		prefix, command, params := parseIRC(tt.line)
+		if prefix != tt.prefix || command != tt.command || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("%q: got %q %q %q, want %q %q %q", tt.line, prefix, command, params, tt.prefix, tt.command, tt.params)
+		}
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abc", 3, "abc"},
+		{"abcd", 3, "abc"},
+		{"あいう", 7, "あい"},
+		{"あいう", 2, ""},
+	} {
+		if got := truncateBytes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateBytes(%q, %d): got %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+// ircServer is the server end of a connection to an ircClient.
+type ircServer struct {
+	t     *testing.T
+	conn  net.Conn
+	lines chan string
+}
+
+// write sends line to the client, which must read it in time.
+func (s *ircServer) write(line string) {
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := fmt.Fprintf(s.conn, "%s\r\n", line); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// expect checks that the client sends a line which starts with prefix.
+func (s *ircServer) expect(prefix string) string {
+	select {
+	case line := <-s.lines:
+		if !strings.HasPrefix(line, prefix) {
+			s.t.Fatalf("got %q, want %q", line, prefix)
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("got nothing, want %q", prefix)
+	}
+	return ""
+}
+
+// startIRC runs an ircClient of bot, connected to the returned server.
+func startIRC(t *testing.T, bot *Bot) (*ircClient, *ircServer) {
+	c := newIRCClient(bot, &IRCConfig{Server: "irc.example.com:6667", Nick: "imagebot", Password: "pw", Channels: []string{"#memes", "#test"}})
+	server, client := net.Pipe()
+	dialed := false
+	c.dial = func() (net.Conn, error) {
+		if dialed {
+			return nil, errors.New("dialed again")
+		}
+		dialed = true
+		return client, nil
+	}
+	s := &ircServer{t: t, conn: server, lines: make(chan string, 16)}
+	go func() {
+		sc := bufio.NewScanner(server)
+		for sc.Scan() {
+			s.lines <- sc.Text()
+		}
+		close(s.lines)
+	}()
+	go c.run()
+	return c, s
+}
+
+// stopIRC closes c, and checks that it quits.
+func stopIRC(t *testing.T, c *ircClient, s *ircServer) {
+	done := make(chan bool)
+	go func() {
+		c.close()
+		close(done)
+	}()
+	s.expect("QUIT")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close does not return")
+	}
+}
+
+func TestIRC(t *testing.T) {
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	c, s := startIRC(t, bot)
+	s.expect("PASS :pw")
+	s.expect("NICK :imagebot")
+	s.expect("USER imagebot 0 * :")
+	s.write(":irc.example.com 433 * imagebot :Nickname is already in use")
+	s.expect("NICK :imagebot_")
+	s.write(":irc.example.com 001 imagebot_ :Welcome")
+	s.expect("JOIN :#memes")
+	s.expect("JOIN :#test")
+	s.write("PING :irc.example.com")
+	s.expect("PONG :irc.example.com")
+
+	s.write(":alice!a@host PRIVMSG #memes :!komei hello")
+	s.expect("PRIVMSG #memes :https://example.com/")
+	// Private messages are answered to the user, a line at a time.
+	s.write(":alice!a@host PRIVMSG imagebot_ :!help")
+	s.expect("PRIVMSG alice :コマンド: ")
+	s.expect("PRIVMSG alice :!help <コマンド>")
+	// Neither CTCP nor other text is answered.
+	s.write(":alice!a@host PRIVMSG #memes :\x01ACTION !komei waves\x01")
+	s.write(":alice!a@host PRIVMSG #memes :hello")
+	s.write("PING :again")
+	s.expect("PONG :again")
+	stopIRC(t, c, s)
+}
+
+// TestIRCSlow checks that the client answers PING while an image is being
+// uploaded, so that the server does not drop it.
+func TestIRCSlow(t *testing.T) {
+	release := make(chan bool)
+	bot := &Bot{
+		Templates: testRegistry(t),
+		Uploader: uploaderFunc(func(b []byte) (string, error) {
+			<-release
+			return testUploader(b)
+		}),
+		NewContext: NewLogContext,
+	}
+	c, s := startIRC(t, bot)
+	s.expect("PASS")
+	s.expect("NICK")
+	s.expect("USER")
+	s.write(":irc.example.com 001 imagebot :Welcome")
+	s.expect("JOIN :#memes")
+	s.expect("JOIN :#test")
+
+	s.write(":alice!a@host PRIVMSG #memes :!komei hello")
+	s.write("PING :irc.example.com")
+	s.expect("PONG :irc.example.com")
+	close(release)
+	s.expect("PRIVMSG #memes :https://example.com/")
+	stopIRC(t, c, s)
+}
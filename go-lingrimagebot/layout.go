@@ -0,0 +1,168 @@
+package lingrimagebot
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinsoku shori: characters which must not start a line, and characters
+// which must not end a line.
+const (
+	noStart = "、。，．,.:;：；!?！？‼⁇⁈⁉・)）]］}｝〕〉》」』】〙〗〟’”｠»" +
+		"ゝゞ々〻ーぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ゠‐–〜～"
+	noEnd = "(（[［{｛〔〈《「『【〘〖〝‘“｟«"
+)
+
+func isWide(r rune) bool {
+	return runeWidth(r) == 2 ||
+		unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// segments splits s into the pieces a line can not be broken in. A line
+// can be broken anywhere around a wide character, and at spaces between
+// the others. Pieces are joined up again so that no line starts with a
+// character in noStart nor ends with one in noEnd.
+func segments(s string) []string {
+	var segs []string
+	word := false
+	for _, r := range s {
+		n := len(segs)
+		// Combining marks and variation selectors stay with the character
+		// they modify.
+		if n > 0 && unicode.Is(unicode.Mn, r) {
+			segs[n-1] += string(r)
+			continue
+		}
+		wide, space := isWide(r), unicode.IsSpace(r)
+		// Spaces belong to the piece before them.
+		if n > 0 && (space || word && !wide ||
+			strings.ContainsRune(noStart, r) || endsWithAny(segs[n-1], noEnd)) {
+			segs[n-1] += string(r)
+		} else {
+			segs = append(segs, string(r))
+		}
+		word = !wide && !space
+	}
+	return segs
+}
+
+func endsWithAny(s, chars string) bool {
+	r, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(s, unicode.IsSpace))
+	return strings.ContainsRune(chars, r)
+}
+
+// wrap breaks each of lines so that no line is wider than width.
+// advances returns the advance of each character of a piece of a line, so
+// that a line is measured by adding them up as it grows.
+func wrap(lines []string, width float64, advances func(string) []float64) []string {
+	var result []string
+	for _, line := range lines {
+		cur, curAdv, curWidth := "", []float64(nil), 0.0
+		for _, seg := range segments(line) {
+			adv := advances(seg)
+			w, trimmed := widths(seg, adv)
+			if cur != "" && curWidth+trimmed > width {
+				result = append(result, split(cur, curAdv, width)...)
+				cur, curAdv, curWidth = "", nil, 0
+			}
+			cur += seg
+			curAdv = append(curAdv, adv...)
+			curWidth += w
+		}
+		result = append(result, split(cur, curAdv, width)...)
+	}
+	return result
+}
+
+// widths returns the width of s whose characters advance by adv, and the
+// width without the spaces at the end.
+func widths(s string, adv []float64) (w, trimmed float64) {
+	i := 0
+	for _, r := range s {
+		w += adv[i]
+		i++
+		if !unicode.IsSpace(r) {
+			trimmed = w
+		}
+	}
+	return w, trimmed
+}
+
+// split breaks a piece which is too wide by itself by characters, keeping
+// at least one character on each line. adv is the advance of each
+// character of s.
+func split(s string, adv []float64, width float64) []string {
+	var result []string
+	s = strings.TrimRightFunc(s, unicode.IsSpace)
+	start, w, i := 0, 0.0, 0
+	for off := range s {
+		if off > start && w+adv[i] > width {
+			result = append(result, s[start:off])
+			start, w = off, 0
+		}
+		w += adv[i]
+		i++
+	}
+	return append(result, s[start:])
+}
+
+// layout is text wrapped and sized to fit a template.
+type layout struct {
+	lines       []string
+	size, pitch float64
+}
+
+// layout wraps lines into the box of the template, and shrinks the font
+// until they fit. Templates without a box draw lines as they are.
+//
+// The characters are measured once, at the size of the template, and the
+// box is scaled instead of them for smaller sizes. The size goes down by 1
+// point at a time to MinSize, and the largest one which fits is found by
+// binary search.
+func (t *Template) layout(lines []string, bounds image.Rectangle) *layout {
+	if t.Box == nil {
+		return &layout{lines, t.Size, t.Pitch}
+	}
+	box := t.Box.in(bounds)
+	origin := t.Origin.in(bounds)
+	minSize := t.MinSize
+	if minSize <= 0 {
+		minSize = t.Size / 2
+	}
+	var advances func(string) []float64
+	if t.Vertical {
+		advances = newVertical(t.fonts, t.Size, t.Pitch/t.Size, t.shapeOptions(true)).advances
+	} else {
+		advances = t.advances()
+	}
+	info := t.fonts[0].Font.Info()
+	// fit lays out lines at the size of step i, and reports whether they
+	// fit in the box.
+	fit := func(i int) (*layout, bool) {
+		size := t.Size - float64(i)
+		if i > 0 && size < minSize {
+			size = minSize
+		}
+		scale := size / t.Size
+		l := &layout{size: size, pitch: t.Pitch * scale}
+		if t.Vertical {
+			l.lines = wrap(lines, float64(box.Max.Y-origin.Y)/scale, advances)
+			return l, float64(origin.X)-float64(len(l.lines)-1)*l.pitch >= float64(box.Min.X)
+		}
+		descent := -size * float64(info.Descender) / float64(info.UnitsPerEm)
+		l.lines = wrap(lines, float64(box.Max.X-origin.X)/scale, advances)
+		return l, float64(origin.Y)+float64(len(l.lines)-1)*l.pitch+descent <= float64(box.Max.Y)
+	}
+	steps := int(math.Max(math.Ceil(t.Size-minSize), 0))
+	i := sort.Search(steps, func(i int) bool {
+		_, ok := fit(i)
+		return ok
+	})
+	// When nothing larger fits, the lines are set at MinSize anyway.
+	l, _ := fit(i)
+	return l
+}
@@ -0,0 +1,56 @@
+package lingrimagebot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAdvances advances wide characters by 2 and the others by 1.
+func testAdvances(s string) []float64 {
+	var adv []float64
+	for _, r := range s {
+		if isWide(r) {
+			adv = append(adv, 2)
+		} else {
+			adv = append(adv, 1)
+		}
+	}
+	return adv
+}
+
+var wrapTests = []struct {
+	line  string
+	width float64
+	want  []string
+}{
+	{"hello world foo", 11, []string{"hello world", "foo"}},
+	{"hello world foo", 12, []string{"hello world", "foo"}},
+	{"aaaaaaaaaa", 4, []string{"aaaa", "aaaa", "aa"}},
+	{"abc", 0, []string{"a", "b", "c"}},
+	{"吾輩は猫である。名前はまだ無い。", 8, []string{"吾輩は猫", "である。", "名前はま", "だ無い。"}},
+	{"「こんにちは」と言った", 6, []string{"「こん", "にち", "は」と", "言った"}},
+	{"", 10, []string{""}},
+}
+
+func TestWrap(t *testing.T) {
+	for _, tt := range wrapTests {
+		got := wrap([]string{tt.line}, tt.width, testAdvances)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wrap(%q, %g): got %q, want %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
+
+// TestRenderLongText checks that long texts with no place to break a line
+// are laid out in reasonable time.
+func TestRenderLongText(t *testing.T) {
+	r := testRegistry(t)
+	for _, text := range []string{strings.Repeat("a", 5000), strings.Repeat("あ", 5000)} {
+		for _, tmpl := range r.Templates() {
+			if _, err := tmpl.Render(text); err != nil {
+				t.Errorf("%s: %v", tmpl.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-lingrimagebot/lingr"
+)
+
+// LingrAdapter is the ChatAdapter of Lingr.
+type LingrAdapter struct {
+	// Config, if set, is the bot as registered on Lingr. Requests without
+	// its token are refused.
+	Config *LingrConfig
+	// Async makes messages say their images with the say API of Config,
+	// if it has the id and secret of the bot.
+	Async bool
+}
+
+func (a *LingrAdapter) Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error) {
+	if a.Config != nil && !lingr.Verify(r, a.Config.Token) {
+		return nil, errForbidden("request without the token")
+	}
+	var status Status
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	var msgs []*ChatMessage
+	d := lingr.Dispatcher{
+		Message: func(id int, m *Message) []string {
+			msgs = append(msgs, a.message(id, m))
+			return nil
+		},
+		Presence: func(id int, p *Presence) []string {
+			c.Infof("event %d: %s is %s in %s", id, p.Username, p.Status, p.Room)
+			return nil
+		},
+	}
+	d.Dispatch(&status)
+	return msgs, nil
+}
+
+func (a *LingrAdapter) message(id int, m *Message) *ChatMessage {
+	msg := &ChatMessage{
+		Id:      strconv.Itoa(id),
+		Channel: m.Room,
+		User:    m.SpeakerId,
+		Text:    m.Text,
+	}
+	if a.Async && a.Config != nil && a.Config.Bot != "" && a.Config.Secret != "" {
+		client := &lingr.Client{Bot: a.Config.Bot, Secret: a.Config.Secret, URL: a.Config.SayURL}
+		msg.Say = func(c Context, text string) error {
+			return client.Say(c.Client(), m.Room, truncate(text))
+		}
+	}
+	return msg
+}
+
+func (a *LingrAdapter) Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string) {
+	if len(replies) > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf8")
+		w.Write([]byte(truncate(strings.Join(replies, "\n"))))
+	}
+}
+
+// truncate cuts s to the length Lingr allows.
+func truncate(s string) string {
+	if runes := []rune(s); len(runes) > 1000 {
+		return string(runes[0:999])
+	}
+	return s
+}
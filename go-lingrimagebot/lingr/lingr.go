@@ -0,0 +1,116 @@
+// Package lingr implements the Lingr bot protocol: the events Lingr posts
+// to the endpoint of a bot, and how the bot tells them from others.
+package lingr
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// Status is the body of a request from Lingr to a bot.
+type Status struct {
+	Status  string  `json:"status"`
+	Counter int     `json:"counter"`
+	Events  []Event `json:"events"`
+}
+
+// Event is one thing which happened in a room. Exactly one of Message and
+// Presence is set, unless it is of a kind this package does not know.
+type Event struct {
+	Id       int       `json:"event_id"`
+	Message  *Message  `json:"message,omitempty"`
+	Presence *Presence `json:"presence,omitempty"`
+}
+
+// Kinds of events.
+const (
+	KindMessage  = "message"
+	KindPresence = "presence"
+)
+
+// Kind returns the kind of e, or "" if it is not known.
+func (e *Event) Kind() string {
+	switch {
+	case e.Message != nil:
+		return KindMessage
+	case e.Presence != nil:
+		return KindPresence
+	}
+	return ""
+}
+
+// Message is something said in a room.
+type Message struct {
+	Id              string `json:"id"`
+	Room            string `json:"room"`
+	PublicSessionId string `json:"public_session_id"`
+	IconUrl         string `json:"icon_url"`
+	// Type is "user" or "bot".
+	Type      string `json:"type"`
+	SpeakerId string `json:"speaker_id"`
+	Nickname  string `json:"nickname"`
+	Text      string `json:"text"`
+	Timestamp string `json:"timestamp"`
+	LocalId   string `json:"local_id"`
+}
+
+// Presence tells that a member came into a room or left it.
+type Presence struct {
+	Room            string `json:"room"`
+	PublicSessionId string `json:"public_session_id"`
+	IconUrl         string `json:"icon_url"`
+	// Status is "online" when the member joins, and "offline" when they
+	// leave.
+	Status    string `json:"status"`
+	Username  string `json:"username"`
+	Nickname  string `json:"nickname"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Dispatcher calls the function for the kind of each event. Each returns
+// what the bot says in reply, if anything. Events whose function is nil,
+// and events of unknown kinds, are passed to Other, if it is not nil.
+type Dispatcher struct {
+	Message  func(id int, m *Message) []string
+	Presence func(id int, p *Presence) []string
+	Other    func(e *Event) []string
+}
+
+// Dispatch routes the events of s, and returns all the replies in order.
+func (d *Dispatcher) Dispatch(s *Status) []string {
+	var replies []string
+	for i := range s.Events {
+		e := &s.Events[i]
+		switch {
+		case e.Message != nil && d.Message != nil:
+			replies = append(replies, d.Message(e.Id, e.Message)...)
+		case e.Presence != nil && d.Presence != nil:
+			replies = append(replies, d.Presence(e.Id, e.Presence)...)
+		case d.Other != nil:
+			replies = append(replies, d.Other(e)...)
+		}
+	}
+	return replies
+}
+
+// Verifier returns the verifier of a bot for the say API, the SHA-1 of its
+// id and secret in hex.
+func Verifier(bot, secret string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(bot+secret)))
+}
+
+// Verify reports whether r comes from Lingr. Lingr does not sign the
+// requests it makes to bots, so the endpoint registered on Lingr carries a
+// token, as in https://bot.example.com/?token=..., which only Lingr and the
+// bot know. It must not be the verifier, which goes to the say API and
+// would let anyone who sees one say in the rooms of the bot. An empty token
+// verifies nothing.
+func Verify(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	t := r.URL.Query().Get("token")
+	return subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+}
@@ -0,0 +1,146 @@
+package lingr_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-lingrimagebot/lingr"
+	"go-lingrimagebot/lingr/lingrtest"
+)
+
+func TestDispatch(t *testing.T) {
+	s := &lingrtest.Server{}
+	status := &lingr.Status{Events: []lingr.Event{
+		s.Message("alice", "hello"),
+		s.Presence("bob", "online"),
+		{Id: 3},
+		s.Message("bob", "bye"),
+		s.Presence("bob", "offline"),
+	}}
+	for i := range status.Events {
+		status.Events[i].Id = i + 1
+	}
+	d := lingr.Dispatcher{
+		Message: func(id int, m *lingr.Message) []string {
+			return []string{"message " + m.SpeakerId + ": " + m.Text}
+		},
+		Presence: func(id int, p *lingr.Presence) []string {
+			return []string{"presence " + p.Username + " " + p.Status}
+		},
+		Other: func(e *lingr.Event) []string {
+			return []string{"other"}
+		},
+	}
+	want := []string{"message alice: hello", "presence bob online", "other", "message bob: bye", "presence bob offline"}
+	if got := d.Dispatch(status); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Without Presence, presence events go to Other.
+	d.Presence = nil
+	want = []string{"message alice: hello", "other", "other", "message bob: bye", "other"}
+	if got := d.Dispatch(status); !reflect.DeepEqual(got, want) {
+		t.Errorf("without Presence: got %q, want %q", got, want)
+	}
+
+	// Without Other, they are dropped.
+	d.Other = nil
+	want = []string{"message alice: hello", "message bob: bye"}
+	if got := d.Dispatch(status); !reflect.DeepEqual(got, want) {
+		t.Errorf("without Other: got %q, want %q", got, want)
+	}
+}
+
+// echo is a bot which repeats messages and greets members who join, and
+// refuses requests without token.
+func echo(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !lingr.Verify(r, token) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var status lingr.Status
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d := lingr.Dispatcher{
+			Message: func(id int, m *lingr.Message) []string {
+				return []string{m.Text}
+			},
+			Presence: func(id int, p *lingr.Presence) []string {
+				if p.Status == "online" {
+					return []string{"welcome " + p.Nickname}
+				}
+				return nil
+			},
+		}
+		w.Write([]byte(strings.Join(d.Dispatch(&status), "\n")))
+	})
+}
+
+func TestServer(t *testing.T) {
+	s := lingrtest.NewServer(echo("token"), "token")
+	tests := []struct {
+		post func() ([]string, error)
+		want []string
+	}{
+		{func() ([]string, error) { return s.Say("alice", "hello") }, []string{"hello"}},
+		{func() ([]string, error) { return s.Join("bob") }, []string{"welcome bob"}},
+		{func() ([]string, error) { return s.Leave("bob") }, nil},
+		{func() ([]string, error) {
+			return s.Post(s.Message("alice", "a"), s.Presence("carol", "online"), s.Message("carol", "b"))
+		}, []string{"a", "welcome carol", "b"}},
+	}
+	for i, tt := range tests {
+		got, err := tt.post()
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	h := echo("token")
+	for _, s := range []*lingrtest.Server{
+		lingrtest.NewServer(h, "wrong"),
+		lingrtest.NewServer(h, ""),
+		{Handler: h, Endpoint: "http://bot.example.com/"},
+		// The say API verifier of the bot is not the token.
+		{Handler: h, Endpoint: "http://bot.example.com/?verifier=" + lingr.Verifier("bot", "token")},
+	} {
+		if _, err := s.Say("alice", "hello"); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("%s: got %v, want 403", s.Endpoint, err)
+		}
+	}
+	// An empty token verifies nothing.
+	if _, err := lingrtest.NewServer(echo(""), "").Say("alice", "hello"); err == nil {
+		t.Error("empty token: got no error")
+	}
+}
+
+func TestSay(t *testing.T) {
+	say := lingrtest.NewSayServer("bot", "secret")
+	defer say.Close()
+	c := &lingr.Client{Bot: "bot", Secret: "secret", URL: say.URL}
+	if err := c.Say(http.DefaultClient, "room", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	want := []lingrtest.Said{{Room: "room", Bot: "bot", Text: "hello"}}
+	if got := say.Said(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	c.Secret = "wrong"
+	err := c.Say(http.DefaultClient, "room", "hello")
+	if e, ok := err.(*lingr.APIError); !ok || e.Code != "invalid_bot_verifier" {
+		t.Errorf("wrong secret: got %v, want invalid_bot_verifier", err)
+	}
+}
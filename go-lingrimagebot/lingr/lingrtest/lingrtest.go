@@ -0,0 +1,158 @@
+// Package lingrtest is a fake Lingr for testing bots: it posts events to
+// the endpoint of a bot as Lingr does, returns what the bot says in reply,
+// and takes what it says later with the say API.
+package lingrtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-lingrimagebot/lingr"
+)
+
+// Server posts events of a room to a bot.
+type Server struct {
+	// Handler is the bot, and Endpoint the URL it is registered with,
+	// including the token if the bot checks it. The path and query of
+	// Endpoint are used with Handler, and its host only when Handler is
+	// nil, in which case the events are posted over the network.
+	Handler  http.Handler
+	Endpoint string
+	// Room is the room the events happen in. The default is "test".
+	Room string
+	// Client posts to Endpoint when Handler is nil. The default is
+	// http.DefaultClient.
+	Client *http.Client
+
+	mu      sync.Mutex
+	counter int
+}
+
+// NewServer returns a Server which posts to h as the bot registered with
+// the endpoint token.
+func NewServer(h http.Handler, token string) *Server {
+	return &Server{
+		Handler:  h,
+		Endpoint: "http://bot.example.com/?token=" + url.QueryEscape(token),
+	}
+}
+
+// Post sends events to the bot and returns the lines of its reply. Events
+// with no id are numbered in order, and so are messages with no id. An
+// error is returned if the bot does not answer with 200 OK.
+func (s *Server) Post(events ...lingr.Event) ([]string, error) {
+	s.mu.Lock()
+	for i := range events {
+		s.counter++
+		e := &events[i]
+		if e.Id == 0 {
+			e.Id = s.counter
+		}
+		if e.Message != nil && e.Message.Id == "" {
+			e.Message.Id = strconv.Itoa(e.Id)
+		}
+	}
+	status := lingr.Status{Status: "ok", Counter: s.counter, Events: events}
+	s.mu.Unlock()
+	b, err := json.Marshal(&status)
+	if err != nil {
+		return nil, err
+	}
+
+	code, body, err := s.post(b)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("lingrtest: %d %s: %s", code, http.StatusText(code), strings.TrimSpace(body))
+	}
+	if body == "" {
+		return nil, nil
+	}
+	return strings.Split(body, "\n"), nil
+}
+
+func (s *Server) post(b []byte) (int, string, error) {
+	if s.Handler != nil {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil {
+			return 0, "", err
+		}
+		r := httptest.NewRequest("POST", u.RequestURI(), bytes.NewReader(b))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.Handler.ServeHTTP(w, r)
+		return w.Code, w.Body.String(), nil
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Post(s.Endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body), err
+}
+
+// Say posts a message by speaker and returns the reply of the bot.
+func (s *Server) Say(speaker, text string) ([]string, error) {
+	return s.Post(s.Message(speaker, text))
+}
+
+// Join posts the presence of username coming into the room.
+func (s *Server) Join(username string) ([]string, error) {
+	return s.Post(s.Presence(username, "online"))
+}
+
+// Leave posts the presence of username leaving the room.
+func (s *Server) Leave(username string) ([]string, error) {
+	return s.Post(s.Presence(username, "offline"))
+}
+
+// Message returns an event of a message by speaker.
+func (s *Server) Message(speaker, text string) lingr.Event {
+	return lingr.Event{Message: &lingr.Message{
+		Room:            s.room(),
+		PublicSessionId: "session-" + speaker,
+		Type:            "user",
+		SpeakerId:       speaker,
+		Nickname:        speaker,
+		Text:            text,
+		Timestamp:       timestamp(),
+	}}
+}
+
+// Presence returns an event of username becoming online or offline.
+func (s *Server) Presence(username, status string) lingr.Event {
+	return lingr.Event{Presence: &lingr.Presence{
+		Room:            s.room(),
+		PublicSessionId: "session-" + username,
+		Status:          status,
+		Username:        username,
+		Nickname:        username,
+		Timestamp:       timestamp(),
+	}}
+}
+
+func (s *Server) room() string {
+	if s.Room == "" {
+		return "test"
+	}
+	return s.Room
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,80 @@
+package lingrtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"go-lingrimagebot/lingr"
+)
+
+// Said is a message a bot said with the say API.
+type Said struct {
+	Room, Bot, Text string
+}
+
+// SayServer is a fake say API. It accepts the bot registered with Bot and
+// Secret, and keeps what it says.
+type SayServer struct {
+	*httptest.Server
+	Bot, Secret string
+
+	mu   sync.Mutex
+	said []Said
+	cond *sync.Cond
+}
+
+// NewSayServer starts a SayServer. Its URL is the say API to give to the
+// bot. It should be closed when done.
+func NewSayServer(bot, secret string) *SayServer {
+	s := &SayServer{Bot: bot, Secret: secret}
+	s.cond = sync.NewCond(&s.mu)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *SayServer) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	bot := r.FormValue("bot")
+	if bot != s.Bot || r.FormValue("bot_verifier") != lingr.Verifier(s.Bot, s.Secret) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "error",
+			"code":   "invalid_bot_verifier",
+			"detail": "invalid bot_verifier",
+		})
+		return
+	}
+	s.mu.Lock()
+	s.said = append(s.said, Said{Room: r.FormValue("room"), Bot: bot, Text: r.FormValue("text")})
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Said returns what has been said so far.
+func (s *SayServer) Said() []Said {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Said(nil), s.said...)
+}
+
+// Wait waits until n messages have been said, or timeout passes, and
+// returns what has been said.
+func (s *SayServer) Wait(n int, timeout time.Duration) []Said {
+	t := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer t.Stop()
+	deadline := time.Now().Add(timeout)
+	s.mu.Lock()
+	for len(s.said) < n && time.Now().Before(deadline) {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+	return s.Said()
+}
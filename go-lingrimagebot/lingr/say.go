@@ -0,0 +1,60 @@
+package lingr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SayURL is the say API of Lingr.
+const SayURL = "https://lingr.com/api/room/say"
+
+// Client says things in rooms as a bot.
+type Client struct {
+	Bot, Secret string
+	// URL is the say API. The default is SayURL.
+	URL string
+}
+
+// APIError is an error returned by the Lingr API.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Detail     string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("lingr: %s: %s", e.Code, e.Detail)
+	}
+	return fmt.Sprintf("lingr: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Say posts text in room with hc.
+func (c *Client) Say(hc *http.Client, room, text string) error {
+	u := c.URL
+	if u == "" {
+		u = SayURL
+	}
+	res, err := hc.PostForm(u, url.Values{
+		"room":         {room},
+		"bot":          {c.Bot},
+		"text":         {text},
+		"bot_verifier": {Verifier(c.Bot, c.Secret)},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var r struct {
+		Status string `json:"status"`
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if res.StatusCode != http.StatusOK || err != nil || r.Status != "ok" {
+		return &APIError{StatusCode: res.StatusCode, Code: r.Code, Detail: r.Detail}
+	}
+	return nil
+}
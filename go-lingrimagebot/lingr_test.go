@@ -0,0 +1,88 @@
+package lingrimagebot
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go-lingrimagebot/lingr/lingrtest"
+)
+
+// uploaderFunc is an Uploader which calls itself.
+type uploaderFunc func(b []byte) (string, error)
+
+func (f uploaderFunc) Upload(client *http.Client, b []byte) (string, error) {
+	return f(b)
+}
+
+func testUploader(b []byte) (string, error) {
+	return "https://example.com/" + hashOf(b) + ".png", nil
+}
+
+func TestLingr(t *testing.T) {
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		Lingr:      &LingrConfig{Token: "token"},
+		NewContext: NewLogContext,
+	}
+	s := lingrtest.NewServer(bot, "token")
+	got, err := s.Say("alice", "!komei hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "https://example.com/") {
+		t.Errorf("!komei: got %q", got)
+	}
+	for _, text := range []string{"hello", "!"} {
+		if got, err := s.Say("alice", text); err != nil || got != nil {
+			t.Errorf("%q: got %q, %v, want no reply", text, got, err)
+		}
+	}
+	if got, err := s.Join("bob"); err != nil || got != nil {
+		t.Errorf("join: got %q, %v, want no reply", got, err)
+	}
+	if got, err := s.Leave("bob"); err != nil || got != nil {
+		t.Errorf("leave: got %q, %v, want no reply", got, err)
+	}
+	got, err = s.Post(s.Message("alice", "!komei a"), s.Presence("carol", "online"), s.Message("carol", "!komei b"))
+	if err != nil || len(got) != 2 || got[0] == got[1] {
+		t.Errorf("two messages: got %q, %v", got, err)
+	}
+
+	if _, err := lingrtest.NewServer(bot, "wrong").Say("alice", "!komei hello"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("wrong token: got %v, want 403", err)
+	}
+}
+
+func TestLingrAsync(t *testing.T) {
+	say := lingrtest.NewSayServer("bot", "secret")
+	defer say.Close()
+	config := &LingrConfig{Token: "token", Bot: "bot", Secret: "secret", SayURL: say.URL}
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		Lingr:      config,
+		NewContext: NewLogContext,
+	}
+	bot.startQueue(0, 0)
+	defer bot.Close()
+	s := lingrtest.NewServer(bot, "token")
+	s.Room = "memes"
+	got, err := s.Post(s.Message("alice", "!komei a"), s.Message("alice", "!help"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || !strings.HasPrefix(got[0], "コマンド: ") || strings.Contains(strings.Join(got, "\n"), "https://") {
+		t.Errorf("got %q, want only the help", got)
+	}
+	said := say.Wait(1, 5*time.Second)
+	if len(said) != 1 || said[0].Room != "memes" || said[0].Bot != "bot" || !strings.HasPrefix(said[0].Text, "https://example.com/") {
+		t.Errorf("said %v", said)
+	}
+
+	if got, err := s.Join("bob"); err != nil || got != nil {
+		t.Errorf("join: got %q, %v, want no reply", got, err)
+	}
+}
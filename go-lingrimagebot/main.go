@@ -2,55 +2,23 @@ package lingrimagebot
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"image"
-	"image/draw"
 	"image/png"
 	"io/ioutil"
-	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"regexp"
-	"strings"
-	"time"
+	"runtime/debug"
 
-	"appengine"
-	"appengine/urlfetch"
-
-	"code.google.com/p/draw2d/draw2d"
-	"code.google.com/p/freetype-go/freetype"
-	"code.google.com/p/freetype-go/freetype/truetype"
+	"go-lingrimagebot/lingr"
 )
 
-var reToken = regexp.MustCompile(`^!(image)\s((?:.|\n)*)`)
-var reTokenP = regexp.MustCompile(`^!(image_p)\s((?:.|\n)*)`)
-var reKomei = regexp.MustCompile(`^!(komei)\s((?:.|\n)*)`)
-var reYuno = regexp.MustCompile(`^!(yuno)\s((?:.|\n)*)`)
-var reDeris = regexp.MustCompile(`^!(d(?:eris)?|redis)\s((?:.|\n)*)`)
-var reGolgo = regexp.MustCompile(`^!(golgo)\s((?:.|\n)*)`)
-var reSeikai = regexp.MustCompile(`^!(seikai)\s((?:.|\n)*)`)
-
-type Status struct {
-	Events []Event `json:"events"`
-}
-
-type Event struct {
-	Id      int      `json:"event_id"`
-	Message *Message `json:"message"`
-}
-
-type Message struct {
-	Id              string `json:"id"`
-	Room            string `json:"room"`
-	PublicSessionId string `json:"public_session_id"`
-	IconUrl         string `json:"icon_url"`
-	Type            string `json:"type"`
-	SpeakerId       string `json:"speaker_id"`
-	Nickname        string `json:"nickname"`
-	Text            string `json:"text"`
-}
+// The events Lingr posts to the bot.
+type (
+	Status   = lingr.Status
+	Event    = lingr.Event
+	Message  = lingr.Message
+	Presence = lingr.Presence
+)
 
 func runeWidth(r rune) int {
 	if r >= 0x1100 &&
@@ -68,375 +36,193 @@ func runeWidth(r rune) int {
 	return 1
 }
 
-func strWidth(str string) int {
-	r := 0
-	for _, c := range []rune(str) {
-		r += runeWidth(c)
+func makedata(rgba *image.RGBA) ([]byte, error) {
+	var b bytes.Buffer
+	err := png.Encode(&b, rgba)
+	if err != nil {
+		return nil, err
 	}
-	return r
+	return b.Bytes(), nil
 }
 
-func makedata(rgba *image.RGBA) ([]byte, string, error) {
-	var b bytes.Buffer
-	mp := multipart.NewWriter(&b)
-	err := mp.WriteField("id", time.Now().Format("20060102030405"))
-	if err != nil {
-		return nil, "", err
+// Bot is the Lingr bot. It is an http.Handler for the endpoint of the bot.
+type Bot struct {
+	Templates *Registry
+	Uploader  Uploader
+	// Lingr is the bot as registered on Lingr. When it is set, requests
+	// which do not carry its token are refused.
+	Lingr *LingrConfig
+	// NewContext returns the Context for a request. The default logs with
+	// the log package and uses an HTTP client with a 30 second timeout.
+	NewContext func(r *http.Request) Context
+	// Adapters are the other chat services the bot answers on, by the
+	// path of their endpoints.
+	Adapters map[string]ChatAdapter
+
+	commands map[string]*builtin
+	queue    *queue
+	irc      *ircClient
+}
+
+// New loads the templates and the upload backend given by config.
+func New(config *Config) (*Bot, error) {
+	filename := config.Templates
+	if filename == "" {
+		filename = "templates.json"
 	}
-	part, err := mp.CreateFormFile("imagedata", "upload.gyazo.com")
+	templates, err := LoadRegistry(filename)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	err = png.Encode(part, rgba)
+	uploader, err := NewUploader(config)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	err = mp.Close()
-	if err != nil {
-		return nil, "", err
+	bot := &Bot{
+		Templates:  templates,
+		Uploader:   uploader,
+		Lingr:      config.Lingr,
+		NewContext: NewLogContext,
+		Adapters:   make(map[string]ChatAdapter),
 	}
-	return b.Bytes(), mp.FormDataContentType(), nil
-}
-
-func upload(c appengine.Context, b []byte, ct string) (string, error) {
-	req, err := http.NewRequest("POST", "https://upload.gyazo.com/upload.cgi", bytes.NewReader(b))
-	if err != nil {
-		return "", err
+	if config.Slack != nil {
+		bot.Adapters["/slack"] = config.Slack
 	}
-	req.Header.Set("Content-Type", ct)
-	req.Header.Set("User-Agent", "Gyagowin/1.0")
-	res, err := urlfetch.Client(c).Do(req)
-	if err != nil {
-		return "", err
+	if config.Discord != nil {
+		bot.Adapters["/discord"] = config.Discord
 	}
-	defer res.Body.Close()
-	if res.StatusCode == 200 || res.StatusCode == 201 {
-		content, err := ioutil.ReadAll(res.Body)
-		c.Infof("debug %v", string(content))
-		if err != nil {
-			return "", err
-		}
-		gyazoUrl := string(content)
-		if len(gyazoUrl) > 4 && gyazoUrl[:4] == "http" {
-			return gyazoUrl + ".png\n", nil
-		}
+	if config.Mattermost != nil {
+		bot.Adapters["/mattermost"] = config.Mattermost
 	}
-	return "", nil
-}
-
-func imageNormal(lines []string) ([]byte, string, error) {
-	maxWidth := 0
-	for _, line := range lines {
-		width := strWidth(line)
-		if maxWidth < width {
-			maxWidth = width
-		}
+	if config.JSON != nil {
+		bot.Adapters["/json"] = config.JSON
 	}
-	rgba := image.NewRGBA(image.Rect(0, 0, maxWidth*11+70, len(lines)*20+20))
-	draw.Draw(rgba, rgba.Bounds(), image.White, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(21)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
-
-	pt := freetype.Pt(10, 10+int(fc.PointToFix32(21)>>8))
-	for _, line := range lines {
-		_, err := fc.DrawString(line, pt)
-		if err != nil {
-			return nil, "", err
-		}
-		pt.Y += fc.PointToFix32(11 * 1.8)
+	if config.Async {
+		bot.startQueue(config.Workers, config.Queue)
 	}
-
-	return makedata(rgba)
+	if config.IRC != nil {
+		bot.irc = newIRCClient(bot, config.IRC)
+		go bot.irc.run()
+	}
+	return bot, nil
 }
 
-func imageNormalP(lines []string) ([]byte, string, error) {
-	maxWidth := 0
-	for _, line := range lines {
-		width := strWidth(line)
-		if maxWidth < width {
-			maxWidth = width
-		}
+// Handler returns the handler for all the routes of the bot.
+func (bot *Bot) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if local, ok := bot.Uploader.(*LocalUploader); ok {
+		mux.Handle("/i/", local)
 	}
-	rgba := image.NewRGBA(image.Rect(0, 0, maxWidth*11+70, len(lines)*20+20))
-	draw.Draw(rgba, rgba.Bounds(), image.White, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font2)
-	fc.SetFontSize(21)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
-
-	pt := freetype.Pt(10, 10+int(fc.PointToFix32(21)>>8))
-	for _, line := range lines {
-		_, err := fc.DrawString(line, pt)
-		if err != nil {
-			return nil, "", err
-		}
-		pt.Y += fc.PointToFix32(11 * 1.8)
+	for path, a := range bot.Adapters {
+		mux.Handle(path, bot.Chat(a))
 	}
-
-	return makedata(rgba)
+	mux.Handle("/", bot)
+	return mux
 }
 
-func imageKomei(lines []string) ([]byte, string, error) {
-	pngf, _ := os.Open("image/komei.png")
-	pngi, _ := png.Decode(pngf)
-	rgba := image.NewRGBA(image.Rect(0, 0, pngi.Bounds().Dx(), pngi.Bounds().Dy()))
-	draw.Draw(rgba, rgba.Bounds(), pngi, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(18)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
-
-	pt := freetype.Pt(pngi.Bounds().Dx()-25, 20)
-	for _, line := range lines {
-		for _, r := range []rune(line) {
-			_, err := fc.DrawString(string(r), pt)
-			if err != nil {
-				return nil, "", err
-			}
-			pt.Y += fc.PointToFix32(11 * 1.8)
-		}
-		pt.Y = fc.PointToFix32(20)
-		pt.X -= fc.PointToFix32(11 * 1.8)
-	}
-
-	return makedata(rgba)
+// RenderError reports that a template could not draw the text. Panic is
+// set if drawing panicked, when Err has the stack.
+type RenderError struct {
+	Template string
+	Err      error
+	Panic    bool
 }
 
-func imageYuno(lines []string) ([]byte, string, error) {
-	pngf, _ := os.Open("image/yuno.png")
-	pngi, _ := png.Decode(pngf)
-	rgba := image.NewRGBA(image.Rect(0, 0, pngi.Bounds().Dx(), pngi.Bounds().Dy()))
-	draw.Draw(rgba, rgba.Bounds(), pngi, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(22)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.White)
-
-	pt := freetype.Pt(25, 25+int(fc.PointToFix32(21)>>8))
-	for _, line := range lines {
-		_, err := fc.DrawString(line, pt)
-		if err != nil {
-			return nil, "", err
-		}
-		pt.Y += fc.PointToFix32(22 * 1.8)
-	}
-
-	return makedata(rgba)
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%s: render failed: %v", e.Template, e.Err)
 }
 
-func imageDeris(lines []string) ([]byte, string, error) {
-	maxWidth := 0
-	for _, line := range lines {
-		width := strWidth(line)
-		if maxWidth < width {
-			maxWidth = width
-		}
-	}
-	width := maxWidth*11 + 80
-	if width < 200 {
-		width = 200
-	}
-	pngf, _ := os.Open("image/deris.png")
-	pngi, _ := png.Decode(pngf)
-	rgba := image.NewRGBA(image.Rect(0, 0, width, len(lines)*21+50))
-	gc := draw2d.NewGraphicContext(rgba)
-	gc.SetFillColor(image.White)
-	paths := &draw2d.PathStorage{}
-	paths.MoveTo(0, 0)
-	paths.LineTo(float64(rgba.Bounds().Dx())-1, 0)
-	paths.LineTo(float64(rgba.Bounds().Dx())-1, float64(rgba.Bounds().Dy())-1)
-	paths.LineTo(0, float64(rgba.Bounds().Dy())-1)
-	paths.LineTo(0, 0)
-	gc.Fill(paths.Close())
-	draw.Draw(rgba, rgba.Bounds(), pngi, image.ZP, draw.Src)
-	gc.SetStrokeColor(image.Black)
-	gc.Stroke(paths.Close())
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(21)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
+// failureReply is posted in the room when an image could not be made.
+const failureReply = "画像の生成に失敗しました: "
 
-	pt := freetype.Pt(70, 35+int(fc.PointToFix32(21)>>8))
-	for _, line := range lines {
-		_, err := fc.DrawString(line, pt)
-		if err != nil {
-			return nil, "", err
-		}
-		pt.Y += fc.PointToFix32(11 * 1.8)
+func (bot *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Content-Type", "text/html; charset=utf8")
+		b, _ := ioutil.ReadFile("index.html")
+		w.Write(b)
+		return
 	}
 
-	return makedata(rgba)
+	bot.serveChat(w, r, &LingrAdapter{Config: bot.Lingr, Async: bot.queue != nil})
 }
 
-func imageGolgo(lines []string) ([]byte, string, error) {
-	pngf, _ := os.Open("image/golgo.png")
-	pngi, _ := png.Decode(pngf)
-	rgba := image.NewRGBA(image.Rect(0, 0, pngi.Bounds().Dx(), pngi.Bounds().Dy()))
-	draw.Draw(rgba, rgba.Bounds(), pngi, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(18)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
-
-	pt := freetype.Pt(pngi.Bounds().Dx()-25, 25)
-	for _, line := range lines {
-		for _, r := range []rune(line) {
-			_, err := fc.DrawString(string(r), pt)
-			if err != nil {
-				return nil, "", err
-			}
-			pt.Y += fc.PointToFix32(11 * 1.8)
-		}
-		pt.Y = fc.PointToFix32(25)
-		pt.X -= fc.PointToFix32(11 * 1.8)
+// message returns the replies to m, if it is a command.
+func (bot *Bot) message(c Context, m *ChatMessage) []string {
+	cmd, ok := ParseCommand(m.Text)
+	if !ok {
+		return nil
 	}
-
-	return makedata(rgba)
+	c.Infof("event %s: %s", m.Id, m.Text)
+	return bot.route(c, m, cmd)
 }
 
-func imageSeikai(lines []string) ([]byte, string, error) {
-	pngf, _ := os.Open("image/seikai.png")
-	pngi, _ := png.Decode(pngf)
-	rgba := image.NewRGBA(image.Rect(0, 0, pngi.Bounds().Dx(), pngi.Bounds().Dy()))
-	draw.Draw(rgba, rgba.Bounds(), pngi, image.ZP, draw.Src)
-	fc := freetype.NewContext()
-	fc.SetDPI(72)
-	fc.SetFont(font1)
-	fc.SetFontSize(18)
-	fc.SetClip(rgba.Bounds())
-	fc.SetDst(rgba)
-	fc.SetSrc(image.Black)
-
-	pt := freetype.Pt(80, pngi.Bounds().Dy()-30)
-	for _, line := range lines {
-		_, err := fc.DrawString(line, pt)
-		if err != nil {
-			return nil, "", err
+// template returns the URL of the image of text drawn with t. If m can be
+// replied to later, in the async mode the image is said then, and nothing
+// is returned unless the queue is full.
+func (bot *Bot) template(c Context, m *ChatMessage, t *Template, text string) []string {
+	if bot.queue != nil && m.Say != nil {
+		if !bot.enqueue(job{id: m.Id, t: t, text: text, say: m.Say}) {
+			c.Errorf("event %s: queue is full", m.Id)
+			return []string{busyReply}
 		}
-		pt.Y += fc.PointToFix32(11 * 1.8)
+		m.queued++
+		return nil
 	}
-
-	return makedata(rgba)
-}
-
-var (
-	font1 *truetype.Font
-	font2 *truetype.Font
-)
-
-func init() {
-	fontBytes1, err := ioutil.ReadFile("font/ipag-mona.ttf")
+	url, err := bot.image(c, t, text)
 	if err != nil {
-		log.Println(err)
-		return
+		c.Errorf("event %s: %v", m.Id, err)
+		return []string{failureReply + reason(err)}
 	}
-	font1, err = freetype.ParseFont(fontBytes1)
+	c.Infof("event %s: %s", m.Id, url)
+	return []string{url}
+}
+
+// image renders text with t and uploads it, and returns the URL of the
+// image.
+func (bot *Bot) image(c Context, t *Template, text string) (string, error) {
+	b, err := render(t, text)
 	if err != nil {
-		log.Println(err)
-		return
+		return "", err
 	}
-	fontBytes2, err := ioutil.ReadFile("font/ipagp-mona.ttf")
-	if err != nil {
-		log.Println(err)
-		return
+	return bot.Uploader.Upload(c.Client(), b)
+}
+
+// render draws text with t and returns the PNG. A panic while drawing is
+// returned as a RenderError too.
+func render(t *Template, text string) (b []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = &RenderError{Template: t.Name, Err: fmt.Errorf("panic: %v\n%s", e, debug.Stack()), Panic: true}
+		}
+	}()
+	rgba, err := t.Render(text)
+	if err == nil {
+		b, err = makedata(rgba)
 	}
-	font2, err = freetype.ParseFont(fontBytes2)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, &RenderError{Template: t.Name, Err: err}
 	}
+	return b, nil
+}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/" {
-			if r.Method == "POST" {
-				var status Status
-
-				c := appengine.NewContext(r)
-				defer func() {
-					if err := recover(); err != nil {
-						c.Errorf("%s", fmt.Sprint(err))
-					}
-				}()
-				e := json.NewDecoder(r.Body).Decode(&status)
-				if e != nil {
-					c.Errorf("%s", e.Error())
-					return
-				}
-				results := ""
-
-				tables := []struct {
-					pat       *regexp.Regexp
-					landscape bool
-					f         func([]string) ([]byte, string, error)
-				}{
-					{reToken, false, imageNormal},
-					{reTokenP, false, imageNormalP},
-					{reKomei, true, imageKomei},
-					{reYuno, true, imageYuno},
-					{reDeris, true, imageDeris},
-					{reGolgo, true, imageGolgo},
-					{reSeikai, true, imageSeikai},
-				}
-				for _, event := range status.Events {
-					for _, t := range tables {
-						tokens := t.pat.FindStringSubmatch(event.Message.Text)
-						if len(tokens) == 3 {
-							c.Infof("debug %v", event.Message.Text)
-							var lines []string
-							if t.landscape {
-								lines = strings.Split(strings.Replace(tokens[2], "ー", "｜", -1), "\n")
-							} else {
-								lines = strings.Split(tokens[2], "\n")
-							}
-							b, ct, err := t.f(lines)
-							if err != nil {
-								c.Errorf("%s", e.Error())
-							}
-							c.Infof("debug %v %v", ct, len(b))
-							res, err := upload(c, b, ct)
-							c.Infof("debug %v", res)
-							if err != nil {
-								c.Errorf("%s", e.Error())
-							}
-							results += res
-						}
-					}
-				}
-				if len(results) > 0 {
-					w.Header().Set("Content-Type", "text/plain; charset=utf8")
-					results = strings.TrimRight(results, "\n")
-					if runes := []rune(results); len(runes) > 1000 {
-						results = string(runes[0:999])
-					}
-					w.Write([]byte(results))
-				}
-			} else {
-				w.Header().Set("Content-Type", "text/html; charset=utf8")
-				b, _ := ioutil.ReadFile("index.html")
-				w.Write(b)
-			}
-		} else {
-			http.NotFound(w, r)
+// reason returns what to tell the room about err: not the details of the
+// backend, which are in the log.
+func reason(err error) string {
+	switch e := err.(type) {
+	case *RenderError:
+		if e.Panic {
+			return "render failed"
 		}
-	})
+		return e.Err.Error()
+	case *UploadError:
+		if e.StatusCode != 0 {
+			return fmt.Sprintf("upload failed: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+		}
+		return "upload failed"
+	}
+	return err.Error()
 }
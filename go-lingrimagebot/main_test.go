@@ -0,0 +1,40 @@
+package lingrimagebot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&RenderError{Template: "komei", Err: errors.New("font: bad glyph")}, "font: bad glyph"},
+		{&RenderError{Template: "komei", Err: errors.New("panic: runtime error: index out of range\ngoroutine 1"), Panic: true}, "render failed"},
+		{&UploadError{Backend: "s3", StatusCode: 500, Body: "secret"}, "upload failed: 500 Internal Server Error"},
+		{&UploadError{Backend: "s3", Body: "dial tcp: s3.internal:443"}, "upload failed"},
+	}
+	for _, tt := range tests {
+		if got := reason(tt.err); got != tt.want {
+			t.Errorf("reason(%v): got %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestRenderPanic checks that a panic while drawing is returned as an
+// error, which does not tell the room about it.
+func TestRenderPanic(t *testing.T) {
+	_, err := render(&Template{Name: "broken"}, "text")
+	e, ok := err.(*RenderError)
+	if !ok || !e.Panic {
+		t.Fatalf("got %v, want a RenderError for a panic", err)
+	}
+	if !strings.Contains(e.Err.Error(), "goroutine") {
+		t.Errorf("got %q, want the stack", e.Err)
+	}
+	if got := reason(err); strings.Contains(got, "panic") {
+		t.Errorf("reason: got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// MattermostAdapter is the ChatAdapter of Mattermost outgoing webhooks.
+// Set the trigger words of the webhook to the commands, such as "!komei".
+type MattermostAdapter struct {
+	// Token is the token of the outgoing webhook.
+	Token string `json:"token"`
+}
+
+func (a *MattermostAdapter) Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error) {
+	var req struct {
+		Token       string `json:"token"`
+		PostId      string `json:"post_id"`
+		ChannelName string `json:"channel_name"`
+		UserName    string `json:"user_name"`
+		Text        string `json:"text"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		req.Token = r.PostForm.Get("token")
+		req.PostId = r.PostForm.Get("post_id")
+		req.ChannelName = r.PostForm.Get("channel_name")
+		req.UserName = r.PostForm.Get("user_name")
+		req.Text = r.PostForm.Get("text")
+	}
+	if !checkToken(req.Token, a.Token) {
+		return nil, errForbidden("invalid token")
+	}
+	return []*ChatMessage{{
+		Id:      req.PostId,
+		Channel: req.ChannelName,
+		User:    req.UserName,
+		Text:    req.Text,
+	}}, nil
+}
+
+func (a *MattermostAdapter) Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string) {
+	if len(replies) > 0 {
+		writeJSON(w, map[string]string{"text": strings.Join(replies, "\n")})
+	}
+}
@@ -0,0 +1,69 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMattermost(t *testing.T) {
+	bot := &Bot{
+		Templates:  testRegistry(t),
+		Uploader:   uploaderFunc(testUploader),
+		NewContext: NewLogContext,
+	}
+	h := bot.Chat(&MattermostAdapter{Token: "token"})
+	form := func(token, text string) *http.Request {
+		v := url.Values{"token": {token}, "post_id": {"p1"}, "channel_name": {"town-square"}, "user_name": {"alice"}, "text": {text}}
+		r := httptest.NewRequest("POST", "/mattermost", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	jsonRequest := func(token, text string) *http.Request {
+		b, _ := json.Marshal(map[string]string{"token": token, "post_id": "p1", "channel_name": "town-square", "user_name": "alice", "text": text})
+		r := httptest.NewRequest("POST", "/mattermost", strings.NewReader(string(b)))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	tests := []struct {
+		name string
+		r    *http.Request
+		code int
+		want string
+	}{
+		{"form", form("token", "!komei hello"), http.StatusOK, "https://example.com/"},
+		{"json", jsonRequest("token", "!komei hello"), http.StatusOK, "https://example.com/"},
+		{"wrong token", form("wrong", "!komei hello"), http.StatusForbidden, ""},
+		{"no token", jsonRequest("", "!komei hello"), http.StatusForbidden, ""},
+		{"no command", form("token", "hello"), http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, tt.r)
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if tt.want == "" {
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: got %q, want no reply", tt.name, w.Body)
+			}
+			continue
+		}
+		var res struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !strings.HasPrefix(res.Text, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, res.Text, tt.want)
+		}
+	}
+}
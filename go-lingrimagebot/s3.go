@@ -0,0 +1,139 @@
+package lingrimagebot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Uploader puts images into an S3 compatible object storage. Requests
+// are signed with AWS Signature Version 4 and use path-style URLs, so that
+// it also works with MinIO, Ceph and so on.
+type S3Uploader struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	ACL       string `json:"acl"`
+	// PublicURL is the base of the URL returned to the room. The object
+	// URL on Endpoint is used if it is empty.
+	PublicURL string `json:"public_url"`
+}
+
+func (u *S3Uploader) Upload(client *http.Client, b []byte) (string, error) {
+	endpoint := u.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+	}
+	region := u.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	key := u.Prefix + fmt.Sprintf("%x.png", sha1.Sum(b))
+	objectURL := strings.TrimRight(endpoint, "/") + "/" + u.Bucket + "/" + key
+
+	req, err := http.NewRequest("PUT", objectURL, bytes.NewReader(b))
+	if err != nil {
+		return "", &UploadError{Backend: "s3", Body: err.Error()}
+	}
+	req.ContentLength = int64(len(b))
+	req.Header.Set("Content-Type", "image/png")
+	if u.ACL != "" {
+		req.Header.Set("X-Amz-Acl", u.ACL)
+	}
+	signS3(req, b, region, u.AccessKey, u.SecretKey, time.Now().UTC())
+	res, err := client.Do(req)
+	if err != nil {
+		return "", &UploadError{Backend: "s3", Body: err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return "", responseError("s3", res)
+	}
+	if u.PublicURL != "" {
+		return strings.TrimRight(u.PublicURL, "/") + "/" + key, nil
+	}
+	return objectURL, nil
+}
+
+// signS3 adds the AWS Signature Version 4 headers to req.
+// See http://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signS3(req *http.Request, payload []byte, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// All the headers set so far are signed. Host is not in req.Header, so
+	// it has to be added by hand.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
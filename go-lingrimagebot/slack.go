@@ -0,0 +1,192 @@
+package lingrimagebot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// SlackAdapter is the ChatAdapter of Slack. It takes slash commands, such
+// as "/komei text" or "/image !komei text", and messages of the Events API.
+type SlackAdapter struct {
+	// SigningSecret checks that requests come from Slack.
+	SigningSecret string `json:"signing_secret"`
+	// BotToken is needed to answer messages of the Events API, with
+	// chat.postMessage.
+	BotToken string `json:"bot_token"`
+	// URL is chat.postMessage. The default is that of slack.com.
+	URL string `json:"url"`
+
+	// seen holds the recent messages, by channel and ts, in order. A
+	// mention comes both as a message and as an app_mention, and is
+	// answered only once.
+	mu   sync.Mutex
+	seen map[string]bool
+	ids  []string
+}
+
+// slackSeen is the number of messages SlackAdapter remembers.
+const slackSeen = 256
+
+// slackMention is the mention of the bot at the head of an app_mention.
+var slackMention = regexp.MustCompile(`^<@[A-Z0-9]+>\s*`)
+
+func (a *SlackAdapter) Decode(c Context, w http.ResponseWriter, r *http.Request) ([]*ChatMessage, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if !a.verify(r, body) {
+		return nil, errForbidden("invalid signature")
+	}
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		// The first delivery is still being answered.
+		return nil, nil
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return a.command(r)
+	}
+
+	var req struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		EventId   string `json:"event_id"`
+		Event     struct {
+			Type    string `json:"type"`
+			Subtype string `json:"subtype"`
+			BotId   string `json:"bot_id"`
+			User    string `json:"user"`
+			Channel string `json:"channel"`
+			Text    string `json:"text"`
+			Ts      string `json:"ts"`
+		} `json:"event"`
+	}
+	if err = json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	switch req.Type {
+	case "url_verification":
+		writeJSON(w, map[string]string{"challenge": req.Challenge})
+		return nil, nil
+	case "event_callback":
+	default:
+		return nil, nil
+	}
+	e := req.Event
+	if (e.Type != "message" && e.Type != "app_mention") || e.Subtype != "" || e.BotId != "" {
+		return nil, nil
+	}
+	if a.isSeen(e.Channel + "/" + e.Ts) {
+		return nil, nil
+	}
+	return []*ChatMessage{{
+		Id:      req.EventId,
+		Channel: e.Channel,
+		User:    e.User,
+		Text:    slackMention.ReplaceAllString(e.Text, ""),
+		SayOnly: true,
+		Say: func(c Context, text string) error {
+			return a.post(c, e.Channel, text)
+		},
+	}}, nil
+}
+
+// isSeen reports whether the message id has been decoded before, and
+// remembers it.
+func (a *SlackAdapter) isSeen(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.seen[id] {
+		return true
+	}
+	if a.seen == nil {
+		a.seen = make(map[string]bool)
+	}
+	if len(a.ids) == slackSeen {
+		delete(a.seen, a.ids[0])
+		a.ids = a.ids[1:]
+	}
+	a.seen[id] = true
+	a.ids = append(a.ids, id)
+	return false
+}
+
+// command returns the message of a slash command. A command with text
+// which does not start with "!" calls the template of its name.
+func (a *SlackAdapter) command(r *http.Request) ([]*ChatMessage, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(r.PostForm.Get("text"))
+	if !strings.HasPrefix(text, "!") {
+		text = "!" + strings.TrimPrefix(r.PostForm.Get("command"), "/") + " " + text
+	}
+	responseURL := r.PostForm.Get("response_url")
+	m := &ChatMessage{
+		Id:      r.PostForm.Get("trigger_id"),
+		Channel: r.PostForm.Get("channel_id"),
+		User:    r.PostForm.Get("user_name"),
+		Text:    text,
+	}
+	if responseURL != "" {
+		m.Say = func(c Context, text string) error {
+			return postJSON(c.Client(), responseURL, nil, slackResponse(text), nil)
+		}
+	}
+	return []*ChatMessage{m}, nil
+}
+
+// verify reports whether the signature of the request with body is right,
+// and it was made in the last five minutes.
+func (a *SlackAdapter) verify(r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := time.Since(time.Unix(t, 0)); d > 5*time.Minute || d < -5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(a.SigningSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return checkToken(r.Header.Get("X-Slack-Signature"), "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (a *SlackAdapter) Reply(c Context, w http.ResponseWriter, msgs []*ChatMessage, replies []string) {
+	if len(replies) > 0 {
+		writeJSON(w, slackResponse(strings.Join(replies, "\n")))
+	}
+}
+
+func slackResponse(text string) map[string]string {
+	return map[string]string{"response_type": "in_channel", "text": text}
+}
+
+// post says text in channel with chat.postMessage.
+func (a *SlackAdapter) post(c Context, channel, text string) error {
+	u := a.URL
+	if u == "" {
+		u = slackPostMessageURL
+	}
+	header := http.Header{"Authorization": {"Bearer " + a.BotToken}}
+	var res struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	err := postJSON(c.Client(), u, header, map[string]string{"channel": channel, "text": text}, &res)
+	if err == nil && !res.Ok {
+		err = fmt.Errorf("slack: %s", res.Error)
+	}
+	return err
+}
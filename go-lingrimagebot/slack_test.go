@@ -0,0 +1,58 @@
+package lingrimagebot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slackRequest returns an Events API request with body, signed with
+// secret.
+func slackRequest(secret, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	r := httptest.NewRequest("POST", "/slack", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+// TestSlackMention checks that a mention, which comes both as a message and
+// as an app_mention, is answered once.
+func TestSlackMention(t *testing.T) {
+	a := &SlackAdapter{SigningSecret: "secret"}
+	events := []struct {
+		body string
+		want bool
+	}{
+		{`{"type": "event_callback", "event_id": "Ev1", "event": {"type": "message", "user": "U1", "channel": "C1", "text": "<@UBOT> !komei a", "ts": "1.000001"}}`, true},
+		{`{"type": "event_callback", "event_id": "Ev2", "event": {"type": "app_mention", "user": "U1", "channel": "C1", "text": "<@UBOT> !komei a", "ts": "1.000001"}}`, false},
+		{`{"type": "event_callback", "event_id": "Ev3", "event": {"type": "app_mention", "user": "U1", "channel": "C2", "text": "<@UBOT> !komei a", "ts": "1.000001"}}`, true},
+		{`{"type": "event_callback", "event_id": "Ev4", "event": {"type": "message", "user": "U1", "channel": "C2", "text": "<@UBOT> !komei a", "ts": "1.000001"}}`, false},
+		{`{"type": "event_callback", "event_id": "Ev5", "event": {"type": "message", "user": "U1", "channel": "C1", "text": "!komei b", "ts": "2.000001"}}`, true},
+	}
+	for _, e := range events {
+		msgs, err := a.Decode(NewLogContext(nil), httptest.NewRecorder(), slackRequest("secret", e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(msgs) == 1; got != e.want {
+			t.Errorf("%s: got %d messages, want answered %v", e.body, len(msgs), e.want)
+		}
+		if len(msgs) == 1 && !strings.HasPrefix(msgs[0].Text, "!komei ") {
+			t.Errorf("%s: got %q", e.body, msgs[0].Text)
+		}
+	}
+
+	if _, err := a.Decode(NewLogContext(nil), httptest.NewRecorder(), slackRequest("wrong", events[0].body)); err == nil {
+		t.Error("wrong signature: got no error")
+	}
+}
@@ -0,0 +1,241 @@
+package lingrimagebot
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when there is no such image.
+var ErrNotFound = errors.New("image not found")
+
+// Store keeps images under the SHA-1 hash of their content, so the same
+// image is stored only once.
+type Store interface {
+	// Put stores b and returns its hash. Putting an image which already
+	// exists refreshes its modification time.
+	Put(b []byte) (string, error)
+	// Get returns the image and the time it was stored.
+	Get(hash string) ([]byte, time.Time, error)
+	// Expire removes images stored before t and returns how many were
+	// removed.
+	Expire(t time.Time) (int, error)
+}
+
+func hashOf(b []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(b))
+}
+
+func validHash(hash string) bool {
+	if len(hash) != 2*sha1.Size {
+		return false
+	}
+	for _, c := range hash {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// FileStore is a Store on the local file system. Images are put into
+// sub directories named by the first two characters of the hash.
+type FileStore struct {
+	Dir string
+}
+
+// tmpSuffix follows the hash in the names of temporary files.
+const tmpSuffix = ".tmp"
+
+func (s *FileStore) path(hash string) string {
+	return filepath.Join(s.Dir, hash[:2], hash+".png")
+}
+
+func (s *FileStore) Put(b []byte) (string, error) {
+	hash := hashOf(b)
+	name := s.path(hash)
+	if _, err := os.Stat(name); err == nil {
+		now := time.Now()
+		return hash, os.Chtimes(name, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first, so that a reader never sees a
+	// partially written image.
+	f, err := ioutil.TempFile(filepath.Dir(name), hash+tmpSuffix)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *FileStore) Get(hash string) ([]byte, time.Time, error) {
+	if !validHash(hash) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	name := s.path(hash)
+	fi, err := os.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return b, fi.ModTime(), nil
+}
+
+// Expire removes the images stored before t. Only files laid out by the
+// store, <2 characters>/<hash>.png, are removed, so that Dir may be shared
+// with other files. Temporary files left by an interrupted Put are removed
+// too once they are an hour old.
+func (s *FileStore) Expire(t time.Time) (int, error) {
+	dirs, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	tmpBefore := time.Now().Add(-time.Hour)
+	if t.Before(tmpBefore) {
+		tmpBefore = t
+	}
+	n := 0
+	for _, dir := range dirs {
+		prefix := dir.Name()
+		if !dir.IsDir() || len(prefix) != 2 {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(s.Dir, prefix))
+		if err != nil {
+			return n, err
+		}
+		for _, fi := range files {
+			name := fi.Name()
+			if fi.IsDir() || len(name) < 2*sha1.Size || name[:2] != prefix || !validHash(name[:2*sha1.Size]) {
+				continue
+			}
+			ext := name[2*sha1.Size:]
+			tmp := strings.HasPrefix(ext, tmpSuffix)
+			if ext != ".png" && !tmp {
+				continue
+			}
+			if tmp && !fi.ModTime().Before(tmpBefore) || !tmp && !fi.ModTime().Before(t) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(s.Dir, prefix, name)); err != nil && !os.IsNotExist(err) {
+				return n, err
+			}
+			if !tmp {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+type memoryEntry struct {
+	b     []byte
+	mtime time.Time
+}
+
+// DefaultMemoryStoreSize is the size of a MemoryStore with no MaxBytes.
+const DefaultMemoryStoreSize = 64 << 20
+
+// MemoryStore is a Store in memory, for when the file system is read-only.
+// Images are lost on restart, and each process has its own, so it only
+// works when the bot runs as a single instance: on App Engine, with manual
+// scaling of one instance. When the images take more than MaxBytes, the
+// ones stored least recently are dropped.
+type MemoryStore struct {
+	MaxBytes int
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	bytes   int
+}
+
+func (s *MemoryStore) Put(b []byte) (string, error) {
+	hash := hashOf(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]*memoryEntry)
+	}
+	if e, ok := s.entries[hash]; ok {
+		e.mtime = time.Now()
+		return hash, nil
+	}
+	max := s.MaxBytes
+	if max <= 0 {
+		max = DefaultMemoryStoreSize
+	}
+	if len(b) > max {
+		return "", fmt.Errorf("image of %d bytes is larger than the store", len(b))
+	}
+	for s.bytes+len(b) > max {
+		s.dropOldest()
+	}
+	s.entries[hash] = &memoryEntry{b, time.Now()}
+	s.bytes += len(b)
+	return hash, nil
+}
+
+// dropOldest removes the image stored least recently.
+func (s *MemoryStore) dropOldest() {
+	var oldest string
+	var t time.Time
+	for hash, e := range s.entries {
+		if oldest == "" || e.mtime.Before(t) {
+			oldest, t = hash, e.mtime
+		}
+	}
+	s.bytes -= len(s.entries[oldest].b)
+	delete(s.entries, oldest)
+}
+
+func (s *MemoryStore) Get(hash string) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[hash]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return e.b, e.mtime, nil
+}
+
+func (s *MemoryStore) Expire(t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for hash, e := range s.entries {
+		if e.mtime.Before(t) {
+			s.bytes -= len(e.b)
+			delete(s.entries, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,118 @@
+package lingrimagebot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	s := &FileStore{Dir: t.TempDir()}
+	hash, err := s.Put(testPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hashOf(testPNG); hash != want {
+		t.Errorf("got %s, want %s", hash, want)
+	}
+	b, _, err := s.Get(hash)
+	if err != nil || !bytes.Equal(b, testPNG) {
+		t.Errorf("Get: got %q, %v", b, err)
+	}
+	for _, h := range []string{"0000000000000000000000000000000000000000", "../../etc/passwd", ""} {
+		if _, _, err := s.Get(h); err != ErrNotFound {
+			t.Errorf("Get(%q): got %v, want ErrNotFound", h, err)
+		}
+	}
+}
+
+// TestFileStoreExpire checks that Expire removes only old images and
+// temporary files of the store, and leaves the other files in Dir.
+func TestFileStoreExpire(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileStore{Dir: dir}
+	oldHash, err := s.Put([]byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHash, err := s.Put([]byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	tmp := filepath.Join(dir, oldHash[:2], oldHash+tmpSuffix+"123456")
+	others := []string{
+		filepath.Join(dir, "image", "komei.png"),
+		filepath.Join(dir, "testdata", "golden", "komei-cjk.png"),
+		filepath.Join(dir, "ab", "notahash.png"),
+		filepath.Join(dir, "top.png"),
+	}
+	for _, name := range append(others, tmp) {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range append(others, tmp, s.path(oldHash)) {
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.Expire(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d removed, want 1", n)
+	}
+	if _, _, err := s.Get(oldHash); err != ErrNotFound {
+		t.Errorf("old image: got %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Get(newHash); err != nil {
+		t.Errorf("new image: %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s is removed: %v", name, err)
+		}
+	}
+}
+
+func TestMemoryStoreMaxBytes(t *testing.T) {
+	s := &MemoryStore{MaxBytes: 10}
+	first, err := s.Put([]byte("aaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	second, _ := s.Put([]byte("bbbb"))
+	time.Sleep(time.Millisecond)
+	// Putting the first again makes the second the least recent one.
+	s.Put([]byte("aaaa"))
+	time.Sleep(time.Millisecond)
+	third, _ := s.Put([]byte("cccc"))
+
+	if _, _, err := s.Get(second); err != ErrNotFound {
+		t.Errorf("second: got %v, want ErrNotFound", err)
+	}
+	for _, h := range []string{first, third} {
+		if _, _, err := s.Get(h); err != nil {
+			t.Errorf("%s: %v", h, err)
+		}
+	}
+	if s.bytes != 8 {
+		t.Errorf("got %d bytes, want 8", s.bytes)
+	}
+	if _, err := s.Put([]byte("too large image")); err == nil {
+		t.Error("got no error for an image larger than the store")
+	}
+}
@@ -0,0 +1,535 @@
+package lingrimagebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"code.google.com/p/draw2d/draw2d"
+	"code.google.com/p/freetype-go/freetype"
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// Point is a pixel position in a template. Negative values are measured
+// from the right or bottom edge of the canvas. As the origin of the text,
+// it is the start of the baseline of the first line, or the top left
+// corner of the first character for vertical templates.
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func (p Point) in(r image.Rectangle) image.Point {
+	x, y := p.X, p.Y
+	if x < 0 {
+		x += r.Dx()
+	}
+	if y < 0 {
+		y += r.Dy()
+	}
+	return image.Pt(x, y)
+}
+
+// Box is the rectangle text is drawn into.
+type Box struct {
+	Point
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (b *Box) in(r image.Rectangle) image.Rectangle {
+	p := b.Point.in(r)
+	return image.Rect(p.X, p.Y, p.X+b.Width, p.Y+b.Height).Intersect(r)
+}
+
+// Fallback is a font used for characters the template's font does not
+// have.
+type Fallback struct {
+	Font string `json:"font"`
+	// Baseline moves the glyphs of the font down by this fraction of an
+	// em, to line them up with the template's font.
+	Baseline float64 `json:"baseline"`
+}
+
+// Canvas describes a canvas which grows with the text instead of taking
+// the size of the background image. The width is the width of the longest
+// line plus PaddingX, and the height is LineHeight times the number of
+// lines plus PaddingY. LineHeight defaults to the pitch of the template.
+// Neither is more than maxCanvas, and text beyond it is cut off.
+type Canvas struct {
+	LineHeight int `json:"line_height"`
+	PaddingX   int `json:"padding_x"`
+	PaddingY   int `json:"padding_y"`
+	MinWidth   int `json:"min_width"`
+}
+
+// maxCanvas is the largest width and height of a canvas in pixels, so that
+// a long text at a big size can not take too much memory.
+const maxCanvas = 2048
+
+func (c *Canvas) bounds(lines []string, measure func(string) float64) image.Rectangle {
+	maxWidth := 0.0
+	for _, line := range lines {
+		width := measure(line)
+		if maxWidth < width {
+			maxWidth = width
+		}
+	}
+	width := int(math.Ceil(maxWidth)) + c.PaddingX
+	if width < c.MinWidth {
+		width = c.MinWidth
+	}
+	height := len(lines)*c.LineHeight + c.PaddingY
+	if width > maxCanvas {
+		width = maxCanvas
+	}
+	if height > maxCanvas {
+		height = maxCanvas
+	}
+	return image.Rect(0, 0, width, height)
+}
+
+// Outline is an outline drawn around the characters, Width points wide.
+type Outline struct {
+	Width float64 `json:"width"`
+	Color string  `json:"color"`
+
+	color *image.Uniform
+}
+
+func (o *Outline) set(fc *freetype.Context) {
+	if o != nil {
+		fc.SetOutline(o.Width, o.color)
+	}
+}
+
+// Shadow is a shadow under the characters and their outline, X points
+// right and Y points down from them, and blurred over Blur points.
+type Shadow struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Blur  float64 `json:"blur"`
+	Color string  `json:"color"`
+
+	color *image.Uniform
+}
+
+// set sets the shadow of fc. If turned, the text is to be turned 90
+// degrees clockwise after it is drawn, and the shadow is turned the other
+// way so that it falls the same way.
+func (s *Shadow) set(fc *freetype.Context, turned bool) {
+	if s == nil {
+		return
+	}
+	x, y := s.X, s.Y
+	if turned {
+		x, y = y, -x
+	}
+	fc.SetShadow(x, y, s.Blur, s.color)
+}
+
+// Template is a meme template loaded from the manifest.
+type Template struct {
+	Name       string     `json:"name"`
+	Aliases    []string   `json:"aliases"`
+	Image      string     `json:"image"`
+	Font       string     `json:"font"`
+	Fallback   []Fallback `json:"fallback"`
+	Size       float64    `json:"size"`
+	MinSize    float64    `json:"min_size"`
+	Color      string     `json:"color"`
+	Background string     `json:"background"`
+	Border     string     `json:"border"`
+	Vertical   bool       `json:"vertical"`
+	Features   []string   `json:"features"`
+	Bold       bool       `json:"bold"`
+	Italic     bool       `json:"italic"`
+	Outline    *Outline   `json:"outline"`
+	Shadow     *Shadow    `json:"shadow"`
+	Pitch      float64    `json:"pitch"`
+	Origin     Point      `json:"origin"`
+	Box        *Box       `json:"box"`
+	Canvas     *Canvas    `json:"canvas"`
+	Replace    []string   `json:"replace"`
+	// Description is shown by !help.
+	Description string `json:"description"`
+	// Options are the options of the command, by default size, color
+	// and font.
+	Options []string `json:"options"`
+
+	replacer   *strings.Replacer
+	image      image.Image
+	fonts      freetype.FontSet
+	color      *image.Uniform
+	background *image.Uniform
+	border     *image.Uniform
+}
+
+// Registry holds the templates in the order of the manifest.
+type Registry struct {
+	templates []*Template
+	names     map[string]*Template
+	// fonts are the fonts of the templates, by file name.
+	fonts map[string]*truetype.Font
+}
+
+// LoadRegistry reads the manifest and loads the images and fonts it refers
+// to. Relative paths are resolved against the working directory.
+func LoadRegistry(filename string) (*Registry, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var templates []*Template
+	if err = json.Unmarshal(b, &templates); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	r := &Registry{
+		names: make(map[string]*Template),
+		fonts: make(map[string]*truetype.Font),
+	}
+	for _, t := range templates {
+		if err = t.init(r.fonts); err != nil {
+			return nil, fmt.Errorf("%s: template %q: %v", filename, t.Name, err)
+		}
+		for _, name := range t.names() {
+			if name == "help" {
+				return nil, fmt.Errorf("%s: template name %q is reserved", filename, name)
+			}
+			if _, ok := r.names[name]; ok {
+				return nil, fmt.Errorf("%s: duplicated template name %q", filename, name)
+			}
+			r.names[name] = t
+		}
+		r.templates = append(r.templates, t)
+	}
+	if err = r.checkFontNames(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return r, nil
+}
+
+// Templates returns the templates in the order of the manifest.
+func (r *Registry) Templates() []*Template {
+	return r.templates
+}
+
+// Lookup returns the template for the name or alias, or nil.
+func (r *Registry) Lookup(name string) *Template {
+	return r.names[name]
+}
+
+func (t *Template) names() []string {
+	return append([]string{t.Name}, t.Aliases...)
+}
+
+func (t *Template) init(fonts map[string]*truetype.Font) error {
+	if t.Name == "" {
+		return fmt.Errorf("name is missing")
+	}
+	for _, o := range t.Options {
+		switch o {
+		case "size", "color", "font":
+		default:
+			return fmt.Errorf("unknown option: %q", o)
+		}
+	}
+	if len(t.Replace)%2 != 0 {
+		return fmt.Errorf("replace must be pairs of old and new")
+	}
+	if len(t.Replace) > 0 {
+		t.replacer = strings.NewReplacer(t.Replace...)
+	}
+
+	var err error
+	if t.Image != "" {
+		if t.image, err = loadImage(t.Image); err != nil {
+			return err
+		}
+	} else if t.Canvas == nil {
+		return fmt.Errorf("either image or canvas is required")
+	}
+	if t.Box != nil && t.Canvas != nil {
+		return fmt.Errorf("box can not be used with canvas")
+	}
+	font, err := cachedFont(fonts, t.Font)
+	if err != nil {
+		return err
+	}
+	t.fonts = freetype.NewFontSet(font)
+	for _, f := range t.Fallback {
+		if font, err = cachedFont(fonts, f.Font); err != nil {
+			return err
+		}
+		t.fonts = append(t.fonts, freetype.Face{Font: font, Baseline: f.Baseline})
+	}
+	if t.Size <= 0 {
+		return fmt.Errorf("bad size: %v", t.Size)
+	}
+	if t.Pitch <= 0 {
+		t.Pitch = lineHeight(t.fonts[0].Font, t.Size)
+	}
+	if t.Canvas != nil && t.Canvas.LineHeight <= 0 {
+		t.Canvas.LineHeight = int(math.Ceil(t.Pitch))
+	}
+	if t.color, err = parseColor(t.Color); err != nil {
+		return err
+	}
+	if t.Background != "" {
+		if t.background, err = parseColor(t.Background); err != nil {
+			return err
+		}
+	}
+	if t.Border != "" {
+		if t.border, err = parseColor(t.Border); err != nil {
+			return err
+		}
+	}
+	if t.Outline != nil {
+		if t.Outline.color, err = parseColor(t.Outline.Color); err != nil {
+			return err
+		}
+	}
+	if t.Shadow != nil {
+		if t.Shadow.color, err = parseColor(t.Shadow.Color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadImage(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// cachedFont loads a font once however many templates use it.
+func cachedFont(fonts map[string]*truetype.Font, filename string) (*truetype.Font, error) {
+	if font, ok := fonts[filename]; ok {
+		return font, nil
+	}
+	font, err := loadFont(filename)
+	if err != nil {
+		return nil, err
+	}
+	fonts[filename] = font
+	return font, nil
+}
+
+// loadFont loads a TrueType font. A face of a TrueType Collection is chosen
+// by its index or full name after '#', as in "msgothic.ttc#MS PGothic";
+// the first face is used by default.
+func loadFont(filename string) (*truetype.Font, error) {
+	face := ""
+	if i := strings.LastIndex(filename, "#"); i >= 0 {
+		filename, face = filename[:i], filename[i+1:]
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c, err := truetype.ParseCollection(b)
+	if err != nil {
+		return nil, err
+	}
+	if face == "" {
+		return c.Font(0)
+	}
+	if i, err := strconv.Atoi(face); err == nil {
+		return c.Font(i)
+	}
+	names, err := c.Names()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if name == face {
+			return c.Font(i)
+		}
+	}
+	return nil, fmt.Errorf("%s: no face named %q", filename, face)
+}
+
+func parseColor(s string) (*image.Uniform, error) {
+	switch s {
+	case "", "black":
+		return image.Black, nil
+	case "white":
+		return image.White, nil
+	}
+	if len(s) == 7 && s[0] == '#' {
+		if v, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+			return image.NewUniform(color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}), nil
+		}
+	}
+	return nil, fmt.Errorf("bad color: %q", s)
+}
+
+// glyphCache is shared by the templates, so that the glyphs of one request
+// are not rasterized again for the next.
+var glyphCache = freetype.NewGlyphCache(16 << 20)
+
+// GlyphCacheStats returns the statistics of the glyph cache.
+func GlyphCacheStats() freetype.GlyphCacheStats {
+	return glyphCache.Stats()
+}
+
+func (t *Template) newContext(size float64) *freetype.Context {
+	fc := freetype.NewContext()
+	fc.SetGlyphCache(glyphCache)
+	fc.SetDPI(72)
+	fc.SetFontSet(t.fonts)
+	fc.SetFontSize(size)
+	fc.SetShapeOptions(t.shapeOptions(false))
+	if t.Bold {
+		fc.SetEmbolden(truetype.EmboldenStrength)
+	}
+	if t.Italic {
+		fc.SetOblique(truetype.ObliqueSlant)
+	}
+	return fc
+}
+
+// shapeOptions returns the OpenType features to draw text with. Text is
+// taken to be Japanese.
+func (t *Template) shapeOptions(vertical bool) truetype.ShapeOptions {
+	return truetype.ShapeOptions{Language: "JAN", Features: t.Features, Vertical: vertical}
+}
+
+// measure returns a function which returns the width of a line in pixels,
+// when drawn at size.
+func (t *Template) measure(size float64) func(string) float64 {
+	fc := t.newContext(size)
+	return func(s string) float64 {
+		e, err := fc.MeasureString(s)
+		if err != nil {
+			return 0
+		}
+		return float64(e.Advance) / 256
+	}
+}
+
+// advances returns a function which returns the advance of each character
+// of a string in pixels, when drawn at the size of the template. Each
+// character is measured once, by itself, so kerning between characters is
+// left out.
+func (t *Template) advances() func(string) []float64 {
+	measure := t.measure(t.Size)
+	cache := make(map[rune]float64)
+	return func(s string) []float64 {
+		adv := make([]float64, 0, len(s))
+		for _, r := range s {
+			a, ok := cache[r]
+			if !ok {
+				if !truetype.IsVariationSelector(r) {
+					a = measure(string(r))
+				}
+				cache[r] = a
+			}
+			adv = append(adv, a)
+		}
+		return adv
+	}
+}
+
+// maxText is the number of characters of text which Render draws at most.
+// The rest is cut off, so that a long text can not keep it busy.
+const maxText = 1000
+
+// Render draws text onto the template.
+func (t *Template) Render(text string) (*image.RGBA, error) {
+	if t.replacer != nil {
+		text = t.replacer.Replace(text)
+	}
+	if utf8.RuneCountInString(text) > maxText {
+		text = string([]rune(text)[:maxText])
+	}
+	lines := strings.Split(text, "\n")
+
+	var rgba *image.RGBA
+	if t.Canvas != nil {
+		rgba = image.NewRGBA(t.Canvas.bounds(lines, t.measure(t.Size)))
+	} else {
+		rgba = image.NewRGBA(image.Rect(0, 0, t.image.Bounds().Dx(), t.image.Bounds().Dy()))
+	}
+	if t.border != nil {
+		gc := draw2d.NewGraphicContext(rgba)
+		paths := &draw2d.PathStorage{}
+		paths.MoveTo(0, 0)
+		paths.LineTo(float64(rgba.Bounds().Dx())-1, 0)
+		paths.LineTo(float64(rgba.Bounds().Dx())-1, float64(rgba.Bounds().Dy())-1)
+		paths.LineTo(0, float64(rgba.Bounds().Dy())-1)
+		paths.LineTo(0, 0)
+		if t.background != nil {
+			gc.SetFillColor(t.background)
+			gc.Fill(paths.Close())
+		}
+		if t.image != nil {
+			draw.Draw(rgba, rgba.Bounds(), t.image, image.ZP, draw.Src)
+		}
+		gc.SetStrokeColor(t.border)
+		gc.Stroke(paths.Close())
+	} else {
+		if t.background != nil {
+			draw.Draw(rgba, rgba.Bounds(), t.background, image.ZP, draw.Src)
+		}
+		if t.image != nil {
+			draw.Draw(rgba, rgba.Bounds(), t.image, image.ZP, draw.Src)
+		}
+	}
+
+	l := t.layout(lines, rgba.Bounds())
+
+	fc := t.newContext(l.size)
+	clip := rgba.Bounds()
+	if t.Box != nil {
+		clip = t.Box.in(clip)
+	}
+	fc.SetClip(clip)
+	fc.SetDst(rgba)
+	fc.SetSrc(t.color)
+	t.Outline.set(fc)
+	t.Shadow.set(fc, false)
+
+	origin := t.Origin.in(rgba.Bounds())
+	if t.Vertical {
+		v := newVertical(t.fonts, l.size, l.pitch/l.size, t.shapeOptions(true))
+		v.shadow = t.Shadow
+		x := float64(origin.X)
+		for _, line := range l.lines {
+			y := float64(origin.Y)
+			for _, c := range v.cells(line) {
+				err := v.draw(fc, rgba, clip, c, x, y)
+				if err != nil {
+					return nil, err
+				}
+				y += v.advance(c)
+			}
+			x -= l.pitch
+		}
+		return rgba, nil
+	}
+	pitch := fc.PointToFix32(l.pitch)
+	pt := freetype.Pt(origin.X, origin.Y)
+	for _, line := range l.lines {
+		_, err := fc.DrawString(line, pt)
+		if err != nil {
+			return nil, err
+		}
+		pt.Y += pitch
+	}
+	return rgba, nil
+}
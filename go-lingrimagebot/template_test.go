@@ -0,0 +1,78 @@
+package lingrimagebot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testCollection = "../code.google.com/p/freetype-go/freetype/truetype/testdata/collection.ttc"
+	testFont       = "../code.google.com/p/freetype-go/freetype/truetype/testdata/shaping.ttf"
+)
+
+func TestLoadFontFace(t *testing.T) {
+	tests := []struct {
+		filename, want string
+	}{
+		{testCollection, "Shaping Regular"},
+		{testCollection + "#", "Shaping Regular"},
+		{testCollection + "#0", "Shaping Regular"},
+		{testCollection + "#1", "Shaping Bold"},
+		{testCollection + "#Shaping Bold", "Shaping Bold"},
+	}
+	for _, tt := range tests {
+		f, err := loadFont(tt.filename)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filename, err)
+			continue
+		}
+		if got := f.Info().FullName; got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+	for _, name := range []string{testCollection + "#2", testCollection + "#-1", testCollection + "#Shaping Italic"} {
+		if _, err := loadFont(name); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+// TestLoadRegistryFontNames checks that two fonts of the same name for the
+// font option are refused, unless they are the same file.
+func TestLoadRegistryFontNames(t *testing.T) {
+	dir := t.TempDir()
+	b, err := ioutil.ReadFile(testFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "shaping.ttf")
+	if err = ioutil.WriteFile(other, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	load := func(font1, font2 string) (*Registry, error) {
+		manifest := filepath.Join(dir, "templates.json")
+		json := fmt.Sprintf(`[{"name": "a", "font": %q, "size": 20, "canvas": {}}, {"name": "b", "font": %q, "size": 20, "canvas": {}}]`, font1, font2)
+		if err := ioutil.WriteFile(manifest, []byte(json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return LoadRegistry(manifest)
+	}
+
+	if _, err := load(testFont, other); err == nil || !strings.Contains(err.Error(), `both named "shaping"`) {
+		t.Errorf("two shaping.ttf: got %v", err)
+	}
+	r, err := load(testFont, "./"+testFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := r.fontNames(); len(names) != 1 || names[0] != "shaping" {
+		t.Errorf("got names %q", names)
+	}
+	// A face of a collection has a name of its own.
+	if _, err = load(testCollection, testCollection+"#1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,296 @@
+package lingrimagebot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Uploader stores a rendered PNG somewhere and returns the URL to show in
+// the room.
+type Uploader interface {
+	Upload(client *http.Client, b []byte) (string, error)
+}
+
+// UploadError reports that the upload backend rejected the image, or could
+// not be reached.
+type UploadError struct {
+	Backend    string
+	StatusCode int
+	Body       string
+}
+
+func (e *UploadError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s: upload failed: %s", e.Backend, e.Body)
+	}
+	return fmt.Sprintf("%s: upload failed: %d %s: %s",
+		e.Backend, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// responseError makes an UploadError from an unexpected response.
+func responseError(backend string, res *http.Response) error {
+	content, _ := ioutil.ReadAll(res.Body)
+	body := strings.TrimSpace(string(content))
+	if runes := []rune(body); len(runes) > 200 {
+		body = string(runes[:200])
+	}
+	return &UploadError{Backend: backend, StatusCode: res.StatusCode, Body: body}
+}
+
+// NewUploader returns the uploader selected by the configuration.
+func NewUploader(config *Config) (Uploader, error) {
+	switch config.Uploader {
+	case "", "gyazo":
+		if config.Gyazo == nil {
+			return &GyazoUploader{}, nil
+		}
+		return config.Gyazo, nil
+	case "s3":
+		if config.S3 == nil {
+			return nil, fmt.Errorf("uploader s3 is not configured")
+		}
+		return config.S3, nil
+	case "webhook":
+		if config.Webhook == nil || config.Webhook.URL == "" {
+			return nil, fmt.Errorf("uploader webhook is not configured")
+		}
+		return config.Webhook, nil
+	case "local":
+		if config.Local == nil || config.Local.BaseURL == "" {
+			// The URLs are posted in rooms, so they must be absolute.
+			return nil, fmt.Errorf("uploader local needs base_url")
+		}
+		if err := config.Local.init(); err != nil {
+			return nil, err
+		}
+		return config.Local, nil
+	}
+	return nil, fmt.Errorf("unknown uploader: %q", config.Uploader)
+}
+
+const gyazoURL = "https://upload.gyazo.com/upload.cgi"
+
+// GyazoUploader uploads images to Gyazo.
+type GyazoUploader struct {
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent"`
+}
+
+func (u *GyazoUploader) Upload(client *http.Client, b []byte) (string, error) {
+	body, ct, err := multipartBody(map[string]string{
+		"id": time.Now().Format("20060102030405"),
+	}, "imagedata", "upload.gyazo.com", b)
+	if err != nil {
+		return "", &UploadError{Backend: "gyazo", Body: err.Error()}
+	}
+	url := u.URL
+	if url == "" {
+		url = gyazoURL
+	}
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return "", &UploadError{Backend: "gyazo", Body: err.Error()}
+	}
+	req.Header.Set("Content-Type", ct)
+	if u.UserAgent != "" {
+		req.Header.Set("User-Agent", u.UserAgent)
+	} else {
+		req.Header.Set("User-Agent", "go-lingrimagebot/1.0")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", &UploadError{Backend: "gyazo", Body: err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 && res.StatusCode != 201 {
+		return "", responseError("gyazo", res)
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", &UploadError{Backend: "gyazo", Body: err.Error()}
+	}
+	gyazoUrl := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(gyazoUrl, "http") {
+		return "", &UploadError{Backend: "gyazo", StatusCode: res.StatusCode, Body: gyazoUrl}
+	}
+	return gyazoUrl + ".png", nil
+}
+
+// WebhookUploader posts images as multipart/form-data to an arbitrary URL.
+// The response must be either the URL of the image or a JSON object with
+// "url" in it.
+type WebhookUploader struct {
+	URL     string            `json:"url"`
+	Field   string            `json:"field"`
+	Headers map[string]string `json:"headers"`
+}
+
+func (u *WebhookUploader) Upload(client *http.Client, b []byte) (string, error) {
+	field := u.Field
+	if field == "" {
+		field = "file"
+	}
+	body, ct, err := multipartBody(nil, field, "image.png", b)
+	if err != nil {
+		return "", &UploadError{Backend: "webhook", Body: err.Error()}
+	}
+	req, err := http.NewRequest("POST", u.URL, body)
+	if err != nil {
+		return "", &UploadError{Backend: "webhook", Body: err.Error()}
+	}
+	req.Header.Set("Content-Type", ct)
+	for k, v := range u.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", &UploadError{Backend: "webhook", Body: err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return "", responseError("webhook", res)
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", &UploadError{Backend: "webhook", Body: err.Error()}
+	}
+	var result struct {
+		URL string `json:"url"`
+	}
+	if json.Unmarshal(content, &result) == nil && result.URL != "" {
+		return result.URL, nil
+	}
+	if s := strings.TrimSpace(string(content)); strings.HasPrefix(s, "http") {
+		return s, nil
+	}
+	return "", &UploadError{Backend: "webhook", StatusCode: res.StatusCode, Body: "no url in response"}
+}
+
+// LocalUploader keeps images in a Store and serves them by itself under
+// BaseURL/i/<hash>.png. The store is a FileStore on Dir, or a MemoryStore
+// of MaxMemory bytes if Dir is empty. Images which have not been rendered
+// again within TTL are removed.
+type LocalUploader struct {
+	Dir       string `json:"dir"`
+	BaseURL   string `json:"base_url"`
+	TTL       string `json:"ttl"`
+	MaxMemory int    `json:"max_memory"`
+
+	store  Store
+	ttl    time.Duration
+	mu     sync.Mutex
+	lastGC time.Time
+}
+
+const defaultTTL = 7 * 24 * time.Hour
+
+func (u *LocalUploader) init() error {
+	u.ttl = defaultTTL
+	if u.TTL != "" {
+		ttl, err := time.ParseDuration(u.TTL)
+		if err != nil {
+			return fmt.Errorf("bad ttl: %v", err)
+		}
+		u.ttl = ttl
+	}
+	if u.Dir == "" {
+		u.store = &MemoryStore{MaxBytes: u.MaxMemory}
+		return nil
+	}
+	if err := os.MkdirAll(u.Dir, 0755); err != nil {
+		return err
+	}
+	u.store = &FileStore{Dir: u.Dir}
+	return nil
+}
+
+func (u *LocalUploader) Upload(client *http.Client, b []byte) (string, error) {
+	hash, err := u.store.Put(b)
+	if err != nil {
+		return "", &UploadError{Backend: "local", Body: err.Error()}
+	}
+	u.gc()
+	return strings.TrimRight(u.BaseURL, "/") + "/i/" + hash + ".png", nil
+}
+
+// gc removes expired images, at most once an hour.
+func (u *LocalUploader) gc() {
+	if u.ttl <= 0 {
+		return
+	}
+	u.mu.Lock()
+	now := time.Now()
+	if now.Sub(u.lastGC) < time.Hour {
+		u.mu.Unlock()
+		return
+	}
+	u.lastGC = now
+	u.mu.Unlock()
+	if n, err := u.store.Expire(now.Add(-u.ttl)); err != nil {
+		log.Println(err)
+	} else if n > 0 {
+		log.Printf("expired %d images", n)
+	}
+}
+
+// ServeHTTP serves /i/<hash>.png.
+func (u *LocalUploader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	if r.URL.Path != "/i/"+name || !strings.HasSuffix(name, ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	hash := strings.TrimSuffix(name, ".png")
+	b, mtime, err := u.store.Get(hash)
+	if err == ErrNotFound || err == nil && u.ttl > 0 && time.Since(mtime) > u.ttl {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	maxAge := 365 * 24 * time.Hour
+	if u.ttl > 0 {
+		maxAge = u.ttl - time.Since(mtime)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge/time.Second)))
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Last-Modified", mtime.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == `"`+hash+`"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(b)
+}
+
+func multipartBody(fields map[string]string, name, filename string, b []byte) (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	mp := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mp.WriteField(k, v); err != nil {
+			return nil, "", err
+		}
+	}
+	part, err := mp.CreateFormFile(name, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(b); err != nil {
+		return nil, "", err
+	}
+	if err = mp.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, mp.FormDataContentType(), nil
+}
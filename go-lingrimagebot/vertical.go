@@ -0,0 +1,333 @@
+package lingrimagebot
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"unicode/utf8"
+
+	"code.google.com/p/freetype-go/freetype"
+	"code.google.com/p/freetype-go/freetype/raster"
+	"code.google.com/p/freetype-go/freetype/truetype"
+)
+
+// verticalForms maps characters to their vertical presentation forms,
+// which are used when the font has them but no vertical glyphs for the
+// characters themselves.
+var verticalForms = map[rune]rune{
+	'、': '︑', '。': '︒', '，': '︐', '：': '︓', '；': '︔', '！': '︕', '？': '︖',
+	'「': '﹁', '」': '﹂', '『': '﹃', '』': '﹄', '（': '︵', '）': '︶',
+	'｛': '︷', '｝': '︸', '〔': '︹', '〕': '︺', '【': '︻', '】': '︼',
+	'《': '︽', '》': '︾', '〈': '︿', '〉': '﹀', '［': '﹇', '］': '﹈',
+	'〖': '︗', '〗': '︘', '…': '︙', '‥': '︰', '—': '︱', '–': '︲', '＿': '︳',
+}
+
+// Characters which are drawn in other ways than upright when the font
+// has no vertical glyph or form for them.
+const (
+	// rotated characters are turned 90 degrees clockwise.
+	rotated = "ー－〜～…‥—–―＝＿「」『』（）［］｛｝〔〕【】《》〈〉〖〗()[]{}<>-=~_"
+	// shifted characters move from the bottom left to the top right.
+	shifted = "、。，．"
+	// small kana move a little to the top right.
+	small = "ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ"
+)
+
+const (
+	cellUpright = iota
+	cellRotated
+	cellShifted
+	cellSmall
+	// cellTateChuYoko is a few digits set horizontally in one cell.
+	cellTateChuYoko
+)
+
+// A cell takes one place in a column.
+type cell struct {
+	s    string
+	kind int
+}
+
+// vertical lays out text from top to bottom, using the vertical metrics
+// of the font. Columns go from right to left. The co-ordinates are of the
+// top left corner of a cell, whose width is 1 em.
+type vertical struct {
+	fonts freetype.FontSet
+	// em is 1 em in pixels, and scale is it in 26.6 fixed point units.
+	em    float64
+	scale int32
+	// spacing is multiplied to the advances of the characters.
+	spacing float64
+	// ascent is from the top of a cell to the baseline of a horizontal
+	// glyph put in it, in 26.6 fixed point units.
+	ascent int32
+	buf    *truetype.GlyphBuf
+	// shaping has the vert feature on, which gives the vertical glyphs.
+	shaping *truetype.ShapeOptions
+	// shadow is the shadow of the template, which has to be turned for
+	// rotated cells.
+	shadow *Shadow
+	// runeCells and glyphs keep what cells and lookupCell found, so that
+	// each character is shaped once.
+	runeCells map[rune]cell
+	glyphs    map[string]cellGlyph
+}
+
+// cellGlyph is the font and the glyph of an upright cell.
+type cellGlyph struct {
+	face  int
+	index truetype.Index
+}
+
+func newVertical(fonts freetype.FontSet, size, spacing float64, shaping truetype.ShapeOptions) *vertical {
+	v := &vertical{
+		fonts:     fonts,
+		em:        size,
+		scale:     int32(size * 64),
+		spacing:   spacing,
+		buf:       truetype.NewGlyphBuf(),
+		shaping:   &shaping,
+		runeCells: make(map[rune]cell),
+		glyphs:    make(map[string]cellGlyph),
+	}
+	// Ideographs are designed to fill the em box, so the top of one is
+	// as good as the top of the box.
+	v.ascent = v.scale * 88 / 100
+	if i := fonts[0].Font.Index('水'); i != 0 {
+		v.ascent = v.top(fonts[0].Font, i)
+	}
+	return v
+}
+
+// top returns the distance from the top of the cell to the baseline of an
+// upright glyph, from the vertical metrics.
+func (v *vertical) top(font *truetype.Font, i truetype.Index) int32 {
+	if err := v.buf.Load(font, v.scale, i, truetype.NoHinting); err != nil || len(v.buf.Point) == 0 {
+		return v.ascent
+	}
+	return font.VMetric(v.scale, i).TopSideBearing + v.buf.B.YMax
+}
+
+// lookup returns the face of the font set for r and the glyph in it.
+func (v *vertical) lookup(r rune) (freetype.Face, truetype.Index) {
+	face, i := v.fonts.Lookup(r)
+	return v.fonts[face], i
+}
+
+// lookupCell returns the position in the font set of the font for the
+// character of an upright cell, and its vertical glyph in the font. The
+// glyph is the variant chosen by a variation selector after the character.
+func (v *vertical) lookupCell(s string) (int, truetype.Index) {
+	if g, ok := v.glyphs[s]; ok {
+		return g.face, g.index
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	g := cellGlyph{}
+	g.face, _ = v.fonts.Lookup(r)
+	if glyphs := v.fonts[g.face].Font.Shape(v.scale, s, v.shaping); len(glyphs) > 0 {
+		g.index = glyphs[0].Index
+	}
+	v.glyphs[s] = g
+	return g.face, g.index
+}
+
+// hasVertical returns whether the font has a vertical glyph for r, other
+// than its horizontal one.
+func (v *vertical) hasVertical(r rune) bool {
+	face, i := v.lookup(r)
+	glyphs := face.Font.Shape(v.scale, string(r), v.shaping)
+	return len(glyphs) == 1 && glyphs[0].Index != i
+}
+
+// cells splits line into cells, replacing characters by their vertical
+// forms.
+func (v *vertical) cells(line string) []cell {
+	var cells []cell
+	for len(line) > 0 {
+		if n := digits(line); n > 0 {
+			if n <= 2 {
+				cells = append(cells, cell{line[:n], cellTateChuYoko})
+			} else {
+				for _, r := range line[:n] {
+					cells = append(cells, cell{string(r), cellUpright})
+				}
+			}
+			line = line[n:]
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(line)
+		line = line[n:]
+		// A variation selector belongs to the cell before it.
+		if truetype.IsVariationSelector(r) {
+			if len(cells) > 0 {
+				cells[len(cells)-1].s += string(r)
+			}
+			continue
+		}
+		cells = append(cells, v.runeCell(r))
+	}
+	return cells
+}
+
+// runeCell returns the cell of r, replaced by its vertical form.
+func (v *vertical) runeCell(r rune) cell {
+	if c, ok := v.runeCells[r]; ok {
+		return c
+	}
+	c := cell{string(r), cellUpright}
+	switch f, ok := verticalForms[r]; {
+	case v.hasVertical(r):
+		// The vertical glyph is drawn upright.
+	case ok && v.fonts.Has(f):
+		c.s = string(f)
+	case strings.ContainsRune(shifted, r):
+		c.kind = cellShifted
+	case strings.ContainsRune(rotated, r):
+		c.kind = cellRotated
+	case strings.ContainsRune(small, r):
+		c.kind = cellSmall
+	}
+	v.runeCells[r] = c
+	return c
+}
+
+// digits returns the length of the run of ASCII digits at the start of s.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+func (v *vertical) hAdvance(s string) int32 {
+	w := int32(0)
+	for _, r := range s {
+		if truetype.IsVariationSelector(r) {
+			continue
+		}
+		face, i := v.lookup(r)
+		w += face.Font.HMetric(v.scale, i).AdvanceWidth
+	}
+	return w
+}
+
+// advance returns how far c goes down the column, in pixels.
+func (v *vertical) advance(c cell) float64 {
+	var a int32
+	switch c.kind {
+	case cellRotated:
+		a = v.hAdvance(c.s)
+	case cellTateChuYoko:
+		a = v.scale
+	default:
+		face, i := v.lookupCell(c.s)
+		a = v.fonts[face].Font.VMetric(v.scale, i).AdvanceHeight
+	}
+	return float64(a) / 64 * v.spacing
+}
+
+// advances returns how far each character of s goes down the column, in
+// pixels. A cell of several characters advances by its first one.
+func (v *vertical) advances(s string) []float64 {
+	adv := make([]float64, 0, len(s))
+	for _, c := range v.cells(s) {
+		adv = append(adv, v.advance(c))
+		for n := utf8.RuneCountInString(c.s); n > 1; n-- {
+			adv = append(adv, 0)
+		}
+	}
+	// cells drops variation selectors at the start of s.
+	for n := utf8.RuneCountInString(s) - len(adv); n > 0; n-- {
+		adv = append([]float64{0}, adv...)
+	}
+	return adv
+}
+
+func fix(x float64) raster.Fix32 {
+	return raster.Fix32(x * 256)
+}
+
+// draw draws c with its top left corner at x, y. fc draws onto dst,
+// clipped to clip.
+func (v *vertical) draw(fc *freetype.Context, dst draw.Image, clip image.Rectangle, c cell, x, y float64) error {
+	em := fix(v.em)
+	switch c.kind {
+	case cellRotated:
+		return v.drawRotated(fc, dst, clip, c.s, x, y)
+	case cellTateChuYoko:
+		w := raster.Fix32(v.hAdvance(c.s) << 2)
+		_, err := fc.DrawString(c.s, raster.Point{
+			X: fix(x) + (em-w)/2,
+			Y: fix(y) + raster.Fix32(v.ascent<<2),
+		})
+		return err
+	}
+	fi, i := v.lookupCell(c.s)
+	face := v.fonts[fi]
+	// The vertical metrics of the font place the glyph, so undo the
+	// baseline adjustment DrawGlyphs makes.
+	p := raster.Point{
+		X: fix(x),
+		Y: fix(y) + raster.Fix32(v.top(face.Font, i)<<2) - fix(face.Baseline*v.em),
+	}
+	switch c.kind {
+	case cellShifted:
+		p.X += em * 6 / 10
+		p.Y -= em * 6 / 10
+	case cellSmall:
+		p.X += em / 10
+		p.Y -= em / 10
+	default:
+		// Center narrow characters in the column.
+		if w := raster.Fix32(face.Font.HMetric(v.scale, i).AdvanceWidth << 2); w < em {
+			p.X += (em - w) / 2
+		}
+	}
+	_, err := fc.DrawGlyphs(fi, []truetype.GlyphPos{{Index: i}}, p)
+	return err
+}
+
+// drawRotated draws s turned 90 degrees clockwise, with the top left
+// corner of the result at x, y.
+func (v *vertical) drawRotated(fc *freetype.Context, dst draw.Image, clip image.Rectangle, s string, x, y float64) error {
+	w := int(v.hAdvance(s)+63) >> 6
+	h := int(v.scale+63) >> 6
+	if w == 0 || h == 0 {
+		return nil
+	}
+	v.shadow.set(fc, true)
+	defer v.shadow.set(fc, false)
+	// Draw s horizontally, then turn the picture. Its outline and shadow
+	// may reach out of the cell.
+	origin := raster.Point{Y: raster.Fix32(v.ascent << 2)}
+	e, err := fc.MeasureString(s)
+	if err != nil {
+		return err
+	}
+	b := image.Rect(0, 0, w, h).Union(image.Rect(
+		int(origin.X+e.Min.X)>>8, int(origin.Y+e.Min.Y)>>8,
+		int(origin.X+e.Max.X+0xff)>>8, int(origin.Y+e.Max.Y+0xff)>>8))
+	a := image.NewRGBA(b)
+	fc.SetDst(a)
+	fc.SetClip(b)
+	_, err = fc.DrawString(s, origin)
+	fc.SetDst(dst)
+	fc.SetClip(clip)
+	if err != nil {
+		return err
+	}
+	// (ax, ay) goes to (h-1-ay, ax).
+	turned := image.NewRGBA(image.Rect(h-b.Max.Y, b.Min.X, h-b.Min.Y, b.Max.X))
+	for ay := b.Min.Y; ay < b.Max.Y; ay++ {
+		for ax := b.Min.X; ax < b.Max.X; ax++ {
+			copy(turned.Pix[turned.PixOffset(h-1-ay, ax):][:4], a.Pix[a.PixOffset(ax, ay):][:4])
+		}
+	}
+	p := image.Pt(int(x+0.5), int(y+0.5))
+	dr := clip.Intersect(turned.Bounds().Add(p))
+	if !dr.Empty() {
+		draw.Draw(dst, dr, turned, dr.Min.Sub(p), draw.Over)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package lingrimagebot
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+// TestVerticalAdvances checks that every character gets an advance, and
+// that a cell advances by its first character.
+func TestVerticalAdvances(t *testing.T) {
+	tmpl := testRegistry(t).Lookup("komei")
+	v := newVertical(tmpl.fonts, tmpl.Size, 1, tmpl.shapeOptions(true))
+	for _, s := range []string{"12月3日と100年", "\U000E0100葛\U000E0100城", "「あっ」ー、。"} {
+		adv := v.advances(s)
+		if len(adv) != utf8.RuneCountInString(s) {
+			t.Errorf("%q: got %d advances, want %d", s, len(adv), utf8.RuneCountInString(s))
+			continue
+		}
+		want, got := 0.0, 0.0
+		for _, c := range v.cells(s) {
+			want += v.advance(c)
+		}
+		for _, a := range adv {
+			got += a
+		}
+		if got != want {
+			t.Errorf("%q: got %g in total, want %g", s, got, want)
+		}
+	}
+	if len(v.runeCells) == 0 || len(v.glyphs) == 0 {
+		t.Error("cells are not cached")
+	}
+}